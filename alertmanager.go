@@ -0,0 +1,339 @@
+package notify
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// AlertmanagerMessage is the webhook payload of Prometheus Alertmanager, version 4
+type AlertmanagerMessage struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	TruncatedAlerts   int                 `json:"truncatedAlerts"` // number of alerts not included because of max_alerts
+	Status            string              `json:"status"`          // "firing" or "resolved"
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []AlertmanagerAlert `json:"alerts"`
+}
+
+// AlertmanagerAlert is a single alert of AlertmanagerMessage
+type AlertmanagerAlert struct {
+	Status       string            `json:"status"` // "firing" or "resolved"
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Firing returns firing alerts of the message
+func (m AlertmanagerMessage) Firing() []AlertmanagerAlert {
+	return m.alerts("firing")
+}
+
+// Resolved returns resolved alerts of the message
+func (m AlertmanagerMessage) Resolved() []AlertmanagerAlert {
+	return m.alerts("resolved")
+}
+
+// alerts returns alerts of the message with the status
+func (m AlertmanagerMessage) alerts(status string) []AlertmanagerAlert {
+	var res []AlertmanagerAlert
+	for _, a := range m.Alerts {
+		if a.Status == status {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// LabelMatcher matches the label value the same way Alertmanager matchers do. Missing label matches as empty value.
+type LabelMatcher struct {
+	Name  string
+	Op    string // "=", "!=", "=~" or "!~"
+	Value string // value or regular expression, anchored at both ends
+	re    *regexp.Regexp
+}
+
+// Matches reports whether the labels match
+func (m LabelMatcher) Matches(labels map[string]string) bool {
+	v := labels[m.Name]
+	switch m.Op {
+	case "=":
+		return v == m.Value
+	case "!=":
+		return v != m.Value
+	case "=~":
+		return m.re.MatchString(v)
+	default:
+		return !m.re.MatchString(v)
+	}
+}
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*`)
+
+// ParseLabelMatchers parses comma-separated matchers in Alertmanager format, with optional braces and quotes,
+// like `{severity="critical", team=~"db|infra"}` or `severity!=info`. Empty expression has no matchers.
+func ParseLabelMatchers(expr string) ([]LabelMatcher, error) {
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	var res []LabelMatcher
+	for s != "" {
+		name := labelNameRe.FindString(s)
+		if name == "" {
+			return nil, fmt.Errorf("no label name at %q", s)
+		}
+		s = strings.TrimSpace(s[len(name):])
+		m := LabelMatcher{Name: name}
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(s, op) {
+				m.Op, s = op, strings.TrimSpace(s[len(op):])
+				break
+			}
+		}
+		if m.Op == "" {
+			return nil, fmt.Errorf("no operator after label %s", name)
+		}
+
+		var err error
+		if m.Value, s, err = cutLabelValue(s); err != nil {
+			return nil, fmt.Errorf("problem parsing value of label %s: %w", name, err)
+		}
+		if m.Op == "=~" || m.Op == "!~" {
+			if m.re, err = regexp.Compile("^(?:" + m.Value + ")$"); err != nil {
+				return nil, fmt.Errorf("problem parsing regular expression of label %s: %w", name, err)
+			}
+		}
+		res = append(res, m)
+
+		s = strings.TrimSpace(s)
+		if s != "" {
+			if s[0] != ',' {
+				return nil, fmt.Errorf("expected comma at %q", s)
+			}
+			s = strings.TrimSpace(s[1:])
+		}
+	}
+	return res, nil
+}
+
+// cutLabelValue returns quoted or unquoted label value at the beginning of s, and the rest of s
+func cutLabelValue(s string) (value, rest string, err error) {
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.IndexByte(s, ',')
+		if i < 0 {
+			i = len(s)
+		}
+		return strings.TrimSpace(s[:i]), s[i:], nil
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err = strconv.Unquote(s[:i+1])
+			return value, s[i+1:], err
+		}
+	}
+	return "", "", errors.New("no closing quote")
+}
+
+// AlertRoute sends Alertmanager notifications with common labels matching the matchers to the destinations
+type AlertRoute struct {
+	Name         string   // name of the route, for logs
+	Matchers     string   // matchers in the format of ParseLabelMatchers, empty matches any notification
+	Destinations []string // destinations of the matching notifications
+	Continue     bool     // whether the next routes are evaluated after this one matched, like Alertmanager routes
+}
+
+// AlertmanagerParams contain settings for Alertmanager
+type AlertmanagerParams struct {
+	Routes    []AlertRoute  // routes evaluated in order, up to the first matching one without Continue
+	Templates *Templates    // templates "firing" and "resolved", AlertmanagerTemplates by default
+	Token     string        // bearer token expected in the requests, no auth if empty
+	Parallel  int           // number of parallel deliveries of the notification, no limit by default
+	Timeout   time.Duration // time limit of the notification delivery, 30s by default
+}
+
+// Alertmanager is http.Handler receiving Prometheus Alertmanager webhook notifications and sending them
+// with the notifiers, to the destinations of the routes matching common labels of the alert group.
+// Notification is rendered with "firing" or "resolved" template, depending on the status of the group,
+// with AlertmanagerMessage as the data, and the severity of the message is taken from the "severity" label.
+//
+// It responds with status 200 if all destinations got the notification, 500 if any delivery failed temporarily,
+// so that Alertmanager retries the notification, and 422 if deliveries failed permanently.
+// Retried notification is sent to all destinations again, wrap the notifiers with NewDedup to avoid duplicates.
+//
+// Example of Alertmanager receiver:
+//
+//	receivers:
+//	  - name: notify
+//	    webhook_configs:
+//	      - url: http://notify:8080/alertmanager
+//	        http_config:
+//	          authorization:
+//	            credentials: secret
+type Alertmanager struct {
+	AlertmanagerParams
+	notifiers []Notifier
+	matchers  [][]LabelMatcher // parsed matchers of the routes
+}
+
+const (
+	alertmanagerFiringTemplate = `[FIRING:{{len .Firing}}]{{range .GroupLabels}} {{.}}{{end}}
+{{range .Firing}}
+- {{or .Annotations.summary .Labels.alertname}}{{with .Annotations.description}}: {{.}}{{end}}{{end}}
+{{- with .Resolved}}
+
+Resolved:{{range .}}
+- {{or .Annotations.summary .Labels.alertname}}{{end}}{{end}}`
+
+	alertmanagerResolvedTemplate = `[RESOLVED]{{range .GroupLabels}} {{.}}{{end}}
+{{range .Resolved}}
+- {{or .Annotations.summary .Labels.alertname}}{{end}}`
+)
+
+// AlertmanagerTemplates returns default templates of Alertmanager, "firing" and "resolved" for any destination.
+// Add templates for the schemes or destinations to them to change the format for these destinations only.
+func AlertmanagerTemplates() *Templates {
+	res := NewTemplates()
+	if err := res.AddText("firing", "", alertmanagerFiringTemplate); err != nil {
+		panic(err) // can't happen, template is tested
+	}
+	if err := res.AddText("resolved", "", alertmanagerResolvedTemplate); err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// NewAlertmanager makes Alertmanager sending with the notifiers, returning error if matchers of the routes are malformed
+func NewAlertmanager(notifiers []Notifier, params AlertmanagerParams) (*Alertmanager, error) {
+	res := &Alertmanager{AlertmanagerParams: params, notifiers: notifiers}
+	if res.Templates == nil {
+		res.Templates = AlertmanagerTemplates()
+	}
+	if res.Timeout <= 0 {
+		res.Timeout = 30 * time.Second
+	}
+	for i, r := range res.Routes {
+		m, err := ParseLabelMatchers(r.Matchers)
+		if err != nil {
+			return nil, fmt.Errorf("problem parsing matchers of route %d: %w", i+1, err)
+		}
+		res.matchers = append(res.matchers, m)
+	}
+	return res, nil
+}
+
+// ServeHTTP receives Alertmanager notification and sends it
+func (a *Alertmanager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGatewayError(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	if a.Token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(a.Token), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeGatewayError(w, http.StatusUnauthorized, "unknown token")
+			return
+		}
+	}
+
+	var msg AlertmanagerMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&msg); err != nil {
+		writeGatewayError(w, http.StatusBadRequest, fmt.Sprintf("problem parsing notification: %v", err))
+		return
+	}
+	if msg.Version != "4" {
+		writeGatewayError(w, http.StatusBadRequest, fmt.Sprintf("unsupported notification version %q, should be 4", msg.Version))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.Timeout)
+	defer cancel()
+	res := a.Send(ctx, msg)
+	resp := GatewayResponse{OK: res.Err() == nil, Results: gatewayResults(res)}
+	log.Printf("[DEBUG] alertmanager notification %s of %d alerts to %d destinations, ok=%v",
+		msg.Status, len(msg.Alerts), len(res.Results), resp.OK)
+
+	status := http.StatusOK
+	for _, dr := range res.Failed() {
+		status = http.StatusUnprocessableEntity
+		if !IsPermanent(dr.Err) {
+			status = http.StatusInternalServerError
+			break
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+// Route returns destinations of the notification, without duplicates
+func (a *Alertmanager) Route(msg AlertmanagerMessage) []string {
+	var res []string
+	for i, r := range a.Routes {
+		if !matchLabels(a.matchers[i], msg.CommonLabels) {
+			continue
+		}
+		log.Printf("[DEBUG] alertmanager notification %s matched route %q", msg.GroupKey, r.Name)
+		for _, d := range r.Destinations {
+			if !slices.Contains(res, d) {
+				res = append(res, d)
+			}
+		}
+		if !r.Continue {
+			break
+		}
+	}
+	return res
+}
+
+// Send renders the notification for every destination returned by Route and sends it, the same way SendAll does.
+// Result is never nil, and has no results if no route matched the notification.
+func (a *Alertmanager) Send(ctx context.Context, msg AlertmanagerMessage) *SendAllResult {
+	name, severity := "firing", SeverityInfo
+	if msg.Status == "resolved" {
+		name = "resolved"
+	} else if s, err := ParseSeverity(msg.CommonLabels["severity"]); err == nil {
+		severity = s
+	}
+	return sendAll(ctx, a.Route(msg), a.Parallel, func(ctx context.Context, destination string) (Notifier, error) {
+		n, err := findNotifier(a.notifiers, destination)
+		if err != nil {
+			return nil, err
+		}
+		text, err := a.Templates.Render(name, destination, msg)
+		if err != nil {
+			return n, Permanent(err)
+		}
+		return n, sendMessage(ctx, n, destination, Message{Body: text, Severity: severity})
+	})
+}
+
+// matchLabels reports whether the labels match all the matchers
+func matchLabels(matchers []LabelMatcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func alertmanagerRequest(t *testing.T, h http.Handler, token, payloadFile string) (int, GatewayResponse) {
+	t.Helper()
+	body, err := os.ReadFile(payloadFile)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/alertmanager", bytes.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var resp GatewayResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), rec.Body.String())
+	return rec.Code, resp
+}
+
+func TestAlertmanager_Firing(t *testing.T) {
+	tg := &messageNotifier{schemaNotifier: schemaNotifier{schema: "telegram"}}
+	slackN := &messageNotifier{schemaNotifier: schemaNotifier{schema: "slack"}}
+	am, err := NewAlertmanager([]Notifier{tg, slackN}, AlertmanagerParams{
+		Routes: []AlertRoute{
+			{Name: "critical", Matchers: `{severity="critical"}`, Destinations: []string{"telegram:oncall"}, Continue: true},
+			{Name: "db", Matchers: `team=~"db|infra"`, Destinations: []string{"slack:db"}},
+			{Name: "default", Destinations: []string{"slack:alerts"}},
+		},
+		Token: "secret",
+	})
+	require.NoError(t, err)
+
+	code, resp := alertmanagerRequest(t, am, "secret", "testdata/alertmanager_firing.json")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, resp.OK)
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, "telegram:oncall", resp.Results[0].Destination)
+	assert.Equal(t, "slack:db", resp.Results[1].Destination)
+
+	expected := "[FIRING:2] DiskFull db\n\n" +
+		"- Disk is full on db1: /var has 1% free space\n" +
+		"- Disk is full on db2\n\n" +
+		"Resolved:\n" +
+		"- Disk is full on db3"
+	require.Len(t, tg.messages, 1)
+	assert.Equal(t, Message{Body: expected, Severity: SeverityCritical}, tg.messages[0])
+	assert.Equal(t, []string{"telegram:oncall"}, tg.sent)
+	require.Len(t, slackN.messages, 1)
+	assert.Equal(t, expected, slackN.messages[0].Body)
+	assert.Equal(t, []string{"slack:db"}, slackN.sent)
+}
+
+func TestAlertmanager_ResolvedWithTemplates(t *testing.T) {
+	slackN := &messageNotifier{schemaNotifier: schemaNotifier{schema: "slack"}}
+	tmpl := AlertmanagerTemplates()
+	require.NoError(t, tmpl.AddText("resolved", "slack", `:white_check_mark: {{.CommonAnnotations.summary | slackEscape}} on {{.CommonLabels.instance}}`))
+	am, err := NewAlertmanager([]Notifier{slackN}, AlertmanagerParams{
+		Routes: []AlertRoute{
+			{Matchers: `severity="critical"`, Destinations: []string{"telegram:oncall"}},
+			{Destinations: []string{"slack:alerts"}},
+		},
+		Templates: tmpl,
+	})
+	require.NoError(t, err)
+
+	code, resp := alertmanagerRequest(t, am, "", "testdata/alertmanager_resolved.json")
+	assert.Equal(t, http.StatusOK, code, resp.Error)
+	require.Len(t, slackN.messages, 1)
+	assert.Equal(t, Message{Body: ":white_check_mark: API latency is above 500ms on api1:8080", Severity: SeverityInfo}, slackN.messages[0])
+}
+
+func TestAlertmanager_DefaultResolvedTemplate(t *testing.T) {
+	var msg AlertmanagerMessage
+	data, err := os.ReadFile("testdata/alertmanager_resolved.json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &msg))
+	assert.Empty(t, msg.Firing())
+	require.Len(t, msg.Resolved(), 1)
+	assert.Equal(t, time.Date(2024, 3, 10, 12, 15, 0, 0, time.UTC), msg.Resolved()[0].EndsAt)
+
+	text, err := AlertmanagerTemplates().Render("resolved", "mailto:ops@example.org", msg)
+	require.NoError(t, err)
+	assert.Equal(t, "[RESOLVED] HighLatency\n\n- API latency is above 500ms", text)
+}
+
+func TestAlertmanager_Failures(t *testing.T) {
+	slackN := &schemeNotifier{scheme: "slack", recordingNotifier: recordingNotifier{err: errors.New("slack is down")}}
+	mailN := &schemeNotifier{scheme: "mailto", recordingNotifier: recordingNotifier{err: Permanent(errors.New("mailbox unavailable"))}}
+	routes := func(destinations ...string) []AlertRoute { return []AlertRoute{{Destinations: destinations}} }
+
+	am, err := NewAlertmanager([]Notifier{slackN, mailN}, AlertmanagerParams{Routes: routes("slack:alerts", "mailto:ops@example.org")})
+	require.NoError(t, err)
+	code, resp := alertmanagerRequest(t, am, "", "testdata/alertmanager_firing.json")
+	assert.Equal(t, http.StatusInternalServerError, code, "temporary failure is retried by alertmanager")
+	assert.False(t, resp.OK)
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, "slack is down", resp.Results[0].Error)
+
+	am, err = NewAlertmanager([]Notifier{slackN, mailN}, AlertmanagerParams{Routes: routes("mailto:ops@example.org", "telegram:ops")})
+	require.NoError(t, err)
+	code, resp = alertmanagerRequest(t, am, "", "testdata/alertmanager_firing.json")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	require.Len(t, resp.Results, 2)
+	assert.True(t, resp.Results[0].Permanent)
+	assert.Equal(t, "unsupported destination schema: telegram", resp.Results[1].Error)
+
+	am, err = NewAlertmanager(nil, AlertmanagerParams{Routes: []AlertRoute{{Matchers: "team=web", Destinations: []string{"slack:web"}}}})
+	require.NoError(t, err)
+	code, resp = alertmanagerRequest(t, am, "", "testdata/alertmanager_firing.json")
+	assert.Equal(t, http.StatusOK, code, "no matching routes")
+	assert.True(t, resp.OK)
+	assert.Empty(t, resp.Results)
+}
+
+func TestAlertmanager_Rejects(t *testing.T) {
+	am, err := NewAlertmanager(nil, AlertmanagerParams{Token: "secret"})
+	require.NoError(t, err)
+
+	code, resp := alertmanagerRequest(t, am, "wrong", "testdata/alertmanager_firing.json")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "unknown token", resp.Error)
+
+	for _, auth := range []string{"secret", "Bearer", "Bearer ", "Basic secret"} {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"version": "4"}`))
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		am.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "token without bearer prefix is rejected: %q", auth)
+	}
+
+	for _, tt := range []struct {
+		method, body, err string
+		code              int
+	}{
+		{http.MethodGet, "", "only POST is allowed", http.StatusMethodNotAllowed},
+		{http.MethodPost, "{", "problem parsing notification: unexpected EOF", http.StatusBadRequest},
+		{http.MethodPost, `{"version": "3", "status": "firing"}`, "unsupported notification version", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(tt.method, "/", bytes.NewBufferString(tt.body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		am.ServeHTTP(rec, req)
+		assert.Equal(t, tt.code, rec.Code)
+		assert.Contains(t, rec.Body.String(), tt.err)
+	}
+}
+
+func TestAlertmanager_Route(t *testing.T) {
+	_, err := NewAlertmanager(nil, AlertmanagerParams{Routes: []AlertRoute{{}, {Matchers: "team=~(db"}}})
+	require.ErrorContains(t, err, "problem parsing matchers of route 2: problem parsing regular expression of label team")
+
+	am, err := NewAlertmanager(nil, AlertmanagerParams{Routes: []AlertRoute{
+		{Matchers: "severity=critical", Destinations: []string{"telegram:oncall", "slack:alerts"}, Continue: true},
+		{Matchers: "team!~web|api", Destinations: []string{"slack:alerts", "mailto:db@example.org"}},
+		{Destinations: []string{"slack:default"}},
+	}})
+	require.NoError(t, err)
+	msg := func(labels map[string]string) AlertmanagerMessage { return AlertmanagerMessage{CommonLabels: labels} }
+	assert.Equal(t, []string{"telegram:oncall", "slack:alerts", "mailto:db@example.org"},
+		am.Route(msg(map[string]string{"severity": "critical", "team": "db"})))
+	assert.Equal(t, []string{"telegram:oncall", "slack:alerts", "slack:default"},
+		am.Route(msg(map[string]string{"severity": "critical", "team": "web"})))
+	assert.Equal(t, []string{"slack:default"}, am.Route(msg(map[string]string{"team": "api"})))
+	assert.Equal(t, []string{"slack:alerts", "mailto:db@example.org"}, am.Route(msg(nil)), "missing label is empty")
+
+	res := am.Send(context.Background(), msg(map[string]string{"team": "api"}))
+	require.Len(t, res.Results, 1)
+	assert.ErrorIs(t, res.Results[0].Err, ErrUnsupportedSchema)
+}
+
+func TestParseLabelMatchers(t *testing.T) {
+	tbl := []struct {
+		expr string
+		res  []LabelMatcher
+		err  string
+	}{
+		{"", nil, ""},
+		{"{}", nil, ""},
+		{`{severity="critical"}`, []LabelMatcher{{Name: "severity", Op: "=", Value: "critical"}}, ""},
+		{`severity != info , team=db`, []LabelMatcher{{Name: "severity", Op: "!=", Value: "info"}, {Name: "team", Op: "=", Value: "db"}}, ""},
+		{`summary="a, \"b\""`, []LabelMatcher{{Name: "summary", Op: "=", Value: `a, "b"`}}, ""},
+		{`=critical`, nil, `no label name at "=critical"`},
+		{`severity`, nil, "no operator after label severity"},
+		{`severity="critical`, nil, "problem parsing value of label severity: no closing quote"},
+		{`severity="critical" team="db"`, nil, `expected comma at "team=\"db\""`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.expr, func(t *testing.T) {
+			res, err := ParseLabelMatchers(tt.expr)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, res)
+		})
+	}
+
+	res, err := ParseLabelMatchers(`instance=~"db[0-9]+:.*", job!~"node"`)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.True(t, res[0].Matches(map[string]string{"instance": "db12:9100"}))
+	assert.False(t, res[0].Matches(map[string]string{"instance": "xdb12:9100"}), "regular expression is anchored")
+	assert.False(t, res[1].Matches(map[string]string{"job": "node"}))
+	assert.True(t, res[1].Matches(map[string]string{"job": "nodes"}))
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// MessageJoiner is implemented by notifiers joining texts of several messages into one their own way,
+// used by Batcher. Texts of notifiers without it are separated by empty lines.
+type MessageJoiner interface {
+	JoinMessages(texts []string) string // returns text combining all the texts
+}
+
+// BatchParams contain settings for Batcher
+type BatchParams struct {
+	Window      time.Duration               // time messages to the destination are collected for after the first one, 1 minute by default
+	MaxMessages int                         // number of messages flushing the batch before the window ends, 100 by default
+	Join        func(texts []string) string // joins texts of the batch, MessageJoiner of the notifier or empty lines between texts by default
+}
+
+// Batcher wraps notifier to send messages to the destination in batches, as one message combining all of them.
+// The batch is flushed when the Window since its first message ends, or once it has MaxMessages messages.
+// Send returns no error while the message is buffered, and error of the batch send for the message which flushed
+// the batch. Errors of batches flushed at the end of the window are logged. Message details besides
+// the text representation are not kept. Call Flush to send buffered messages before the shutdown.
+type Batcher struct {
+	Notifier
+	BatchParams
+
+	mu      sync.Mutex
+	batches map[string]*batch // by destination
+}
+
+// batch is a buffered messages to the destination
+type batch struct {
+	texts []string
+	timer *time.Timer
+}
+
+// NewBatcher makes Batcher for the notifier
+func NewBatcher(n Notifier, params BatchParams) *Batcher {
+	res := &Batcher{Notifier: n, BatchParams: params, batches: map[string]*batch{}}
+	if res.Window <= 0 {
+		res.Window = time.Minute
+	}
+	if res.MaxMessages <= 0 {
+		res.MaxMessages = 100
+	}
+	if res.Join == nil {
+		res.Join = joinFunc(n)
+	}
+	return res
+}
+
+// Send adds the text to the batch of the destination, sending the batch if it's full
+func (b *Batcher) Send(ctx context.Context, destination, text string) error {
+	b.mu.Lock()
+	bt, ok := b.batches[destination]
+	if !ok {
+		bt = &batch{}
+		b.batches[destination] = bt
+		bt.timer = time.AfterFunc(b.Window, func() { b.flushWindow(destination, bt) })
+	}
+	bt.texts = append(bt.texts, text)
+	if len(bt.texts) < b.MaxMessages {
+		b.mu.Unlock()
+		return nil
+	}
+	b.take(destination, bt)
+	b.mu.Unlock()
+	return b.send(ctx, destination, bt.texts)
+}
+
+// Flush sends all buffered batches, returning errors of the failed ones
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	batches := b.batches
+	b.batches = map[string]*batch{}
+	for _, bt := range batches {
+		bt.timer.Stop()
+	}
+	b.mu.Unlock()
+
+	var errs []error
+	for destination, bt := range batches {
+		if err := b.send(ctx, destination, bt.texts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Schemes returns destination schemes supported by the wrapped notifier
+func (b *Batcher) Schemes() []string {
+	return notifierSchemes(b.Notifier)
+}
+
+// Unwrap returns the wrapped notifier
+func (b *Batcher) Unwrap() Notifier {
+	return b.Notifier
+}
+
+// flushWindow sends the batch at the end of its window, unless it was already sent
+func (b *Batcher) flushWindow(destination string, bt *batch) {
+	b.mu.Lock()
+	if b.batches[destination] != bt {
+		b.mu.Unlock()
+		return
+	}
+	b.take(destination, bt)
+	b.mu.Unlock()
+	if err := b.send(context.Background(), destination, bt.texts); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+}
+
+// take removes the batch from buffered ones, called with the lock held
+func (b *Batcher) take(destination string, bt *batch) {
+	bt.timer.Stop()
+	delete(b.batches, destination)
+}
+
+// send sends the texts as one message
+func (b *Batcher) send(ctx context.Context, destination string, texts []string) error {
+	if err := b.Notifier.Send(ctx, destination, b.Join(texts)); err != nil {
+		return fmt.Errorf("problem sending batch of %d messages to %s: %w", len(texts), redactDestination(destination), err)
+	}
+	return nil
+}
+
+// joinFunc returns JoinMessages of the notifier or of the notifier wrapped by it, if any implements MessageJoiner
+func joinFunc(n Notifier) func(texts []string) string {
+	if j, ok := unwrapAs[MessageJoiner](n); ok {
+		return j.JoinMessages
+	}
+	return func(texts []string) string { return strings.Join(texts, "\n\n") }
+}
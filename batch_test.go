@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatcher(t *testing.T) {
+	rec := &recordingNotifier{}
+	b := NewBatcher(rec, BatchParams{Window: time.Millisecond * 50, MaxMessages: 3})
+	assert.Equal(t, "recording notifier", b.String())
+	assert.Equal(t, "test", b.Schema())
+
+	for _, text := range []string{"1", "2", "3", "4"} {
+		require.NoError(t, b.Send(context.Background(), "test:a", text))
+	}
+	require.NoError(t, SendMessage(context.Background(), []Notifier{b}, "test:b", Message{Title: "title", Body: "5"}))
+	assert.Equal(t, []string{"test:a 1\n\n2\n\n3"}, rec.get(), "full batch is sent right away")
+
+	assert.Eventually(t, func() bool { return len(rec.get()) == 3 }, time.Second, time.Millisecond*10)
+	assert.ElementsMatch(t, []string{"test:a 1\n\n2\n\n3", "test:a 4", "test:b title\n\n5"}, rec.get(), "batches are sent at the end of the window")
+}
+
+func TestBatcher_Flush(t *testing.T) {
+	rec := &recordingNotifier{}
+	b := NewBatcher(rec, BatchParams{Window: time.Hour, Join: func(texts []string) string { return "joined " + strings.Join(texts, "") }})
+	require.NoError(t, b.Send(context.Background(), "test:a", "1"))
+	require.NoError(t, b.Send(context.Background(), "test:a", "2"))
+	assert.Empty(t, rec.get())
+	require.NoError(t, b.Flush(context.Background()))
+	assert.Equal(t, []string{"test:a joined 12"}, rec.get())
+	require.NoError(t, b.Flush(context.Background()), "nothing to flush")
+	assert.Len(t, rec.get(), 1)
+
+	rec.err = Permanent(errors.New("send failed"))
+	require.NoError(t, b.Send(context.Background(), "test:a", "3"))
+	err := b.Flush(context.Background())
+	require.EqualError(t, err, "problem sending batch of 1 messages to test:a: send failed")
+	assert.True(t, IsPermanent(err))
+}
+
+func TestBatcher_JoinMessages(t *testing.T) {
+	e := NewEmail(SMTPParams{ContentType: "text/html"})
+	b := NewBatcher(WithRetry(e, DefaultRetryPolicy()), BatchParams{})
+	assert.Equal(t, "<ul>\n<li>first</li>\n<li><b>second</b></li>\n</ul>", b.Join([]string{"first", "<b>second</b>"}),
+		"joiner of the wrapped notifier is used")
+
+	e = NewEmail(SMTPParams{ContentType: "text/plain"})
+	assert.Equal(t, "first\n\nsecond", e.JoinMessages([]string{"first", "second"}))
+}
@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is a state of CircuitBreaker
+type CircuitState int
+
+// states of CircuitBreaker
+const (
+	CircuitClosed   CircuitState = iota // sends are passed to the notifier
+	CircuitOpen                         // sends fail with ErrCircuitOpen without calling the notifier
+	CircuitHalfOpen                     // a few trial sends are passed to the notifier to check whether it recovered
+)
+
+// String returns name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("circuit-state(%d)", int(s))
+	}
+}
+
+// ErrCircuitOpen is returned by CircuitBreaker for sends rejected while the circuit is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerParams contain settings for CircuitBreaker
+type CircuitBreakerParams struct {
+	FailureThreshold int                                     // number of failures in a row opening the circuit, 5 by default
+	OpenTimeout      time.Duration                           // time the circuit stays open before trial sends are allowed, 30s by default
+	HalfOpenSends    int                                     // number of successful trial sends closing the circuit, 1 by default
+	IsFailure        func(err error) bool                    // reports whether err counts as failure, all but permanent errors and cancellation by default
+	OnStateChange    func(from, to CircuitState, n Notifier) // called on every state change, optional
+}
+
+// CircuitBreaker wraps notifier to stop calling it for a while after failures in a row. Once FailureThreshold
+// failures in a row happen, the circuit opens, and sends fail right away with ErrCircuitOpen. After OpenTimeout,
+// the circuit becomes half-open, and up to HalfOpenSends sends at once are passed to the notifier as trials.
+// If that many trial sends succeed the circuit is closed, and if any of them fails it opens again.
+//
+// Permanent errors, like invalid destination, don't count as failures by default, as they don't tell
+// anything about the service health, and neither do context cancellations.
+type CircuitBreaker struct {
+	decorator
+	CircuitBreakerParams
+
+	mu        sync.Mutex
+	state     CircuitState
+	gen       int       // incremented on every state change, to ignore results of sends started in the previous state
+	failures  int       // failures in a row in closed state
+	openedAt  time.Time // time the circuit was opened
+	trials    int       // trial sends in progress in half-open state
+	successes int       // successful trial sends in half-open state
+	changes   []circuitChange
+	now       func() time.Time
+}
+
+// circuitChange is a state change to be reported to OnStateChange
+type circuitChange struct {
+	from, to CircuitState
+}
+
+// NewCircuitBreaker makes CircuitBreaker for the notifier, in closed state
+func NewCircuitBreaker(n Notifier, params CircuitBreakerParams) *CircuitBreaker {
+	res := &CircuitBreaker{CircuitBreakerParams: params, now: time.Now}
+	if res.FailureThreshold <= 0 {
+		res.FailureThreshold = 5
+	}
+	if res.OpenTimeout <= 0 {
+		res.OpenTimeout = 30 * time.Second
+	}
+	if res.HalfOpenSends <= 0 {
+		res.HalfOpenSends = 1
+	}
+	if res.IsFailure == nil {
+		res.IsFailure = isCircuitFailure
+	}
+	res.decorator = decorator{Notifier: n, around: res.around}
+	return res
+}
+
+// State returns the current state of the circuit
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.unlock()
+	cb.checkOpenTimeout()
+	return cb.state
+}
+
+// around passes the send to the notifier if the circuit allows it, and updates the state with its result
+func (cb *CircuitBreaker) around(ctx context.Context, _ string, send func(ctx context.Context) error) error {
+	gen, err := cb.allow()
+	if err != nil {
+		return err
+	}
+	err = send(ctx)
+	cb.done(gen, err)
+	return err
+}
+
+// allow reports whether the send could be made, returning generation of the state it's made in
+func (cb *CircuitBreaker) allow() (gen int, err error) {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	cb.checkOpenTimeout()
+	switch cb.state {
+	case CircuitOpen:
+		return 0, fmt.Errorf("%w for %s", ErrCircuitOpen, cb.Notifier)
+	case CircuitHalfOpen:
+		if cb.trials >= cb.HalfOpenSends-cb.successes {
+			return 0, fmt.Errorf("%w for %s", ErrCircuitOpen, cb.Notifier) // enough trial sends are in progress
+		}
+		cb.trials++
+	}
+	return cb.gen, nil
+}
+
+// done updates the state with the result of the send, unless the state changed since the send was allowed
+func (cb *CircuitBreaker) done(gen int, err error) {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	if gen != cb.gen {
+		return
+	}
+	failed := err != nil && cb.IsFailure(err)
+	switch cb.state {
+	case CircuitHalfOpen:
+		cb.trials--
+		if failed {
+			cb.setState(CircuitOpen)
+			return
+		}
+		if err == nil {
+			cb.successes++
+			if cb.successes >= cb.HalfOpenSends {
+				cb.setState(CircuitClosed)
+			}
+		}
+	case CircuitClosed:
+		if !failed {
+			if err == nil {
+				cb.failures = 0
+			}
+			return
+		}
+		cb.failures++
+		if cb.failures >= cb.FailureThreshold {
+			cb.setState(CircuitOpen)
+		}
+	}
+}
+
+// checkOpenTimeout switches open circuit to half-open once OpenTimeout passed, called with the lock held
+func (cb *CircuitBreaker) checkOpenTimeout() {
+	if cb.state == CircuitOpen && cb.now().Sub(cb.openedAt) >= cb.OpenTimeout {
+		cb.setState(CircuitHalfOpen)
+	}
+}
+
+// setState switches the circuit to the state, called with the lock held
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	cb.changes = append(cb.changes, circuitChange{from: cb.state, to: state})
+	cb.state, cb.failures, cb.trials, cb.successes = state, 0, 0, 0
+	cb.gen++
+	if state == CircuitOpen {
+		cb.openedAt = cb.now()
+	}
+}
+
+// unlock releases the lock and reports state changes made under it to OnStateChange,
+// so that the hook could call methods of CircuitBreaker
+func (cb *CircuitBreaker) unlock() {
+	changes := cb.changes
+	cb.changes = nil
+	cb.mu.Unlock()
+	if cb.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		cb.OnStateChange(c.from, c.to, cb.Notifier)
+	}
+}
+
+// isCircuitFailure is the default check of errors for CircuitBreaker, all but permanent errors and cancellation count
+func isCircuitFailure(err error) bool {
+	return !IsPermanent(err) && !errors.Is(err, context.Canceled)
+}
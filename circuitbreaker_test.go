@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var mu sync.Mutex
+	var sendErr error
+	calls := 0
+	n := funcNotifier(func(context.Context, string, string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return sendErr
+	})
+	setErr := func(err error) {
+		mu.Lock()
+		sendErr = err
+		mu.Unlock()
+	}
+
+	var changes []string
+	now := time.Now()
+	cb := NewCircuitBreaker(n, CircuitBreakerParams{
+		FailureThreshold: 3,
+		OpenTimeout:      time.Minute,
+		HalfOpenSends:    2,
+		OnStateChange: func(from, to CircuitState, n Notifier) {
+			changes = append(changes, from.String()+" -> "+to.String()+" for "+n.String())
+		},
+	})
+	cb.now = func() time.Time { return now }
+	assert.Equal(t, "func notifier", cb.String())
+	assert.Equal(t, "test", cb.Schema())
+	assert.Equal(t, CircuitClosed, cb.State())
+
+	// failures in a row open the circuit, success resets the counter
+	setErr(errors.New("connection refused"))
+	require.Error(t, cb.Send(context.Background(), "test:dst", "1"))
+	require.Error(t, cb.Send(context.Background(), "test:dst", "2"))
+	setErr(nil)
+	require.NoError(t, cb.Send(context.Background(), "test:dst", "3"))
+	setErr(errors.New("connection refused"))
+	require.Error(t, cb.Send(context.Background(), "test:dst", "4"))
+	require.EqualError(t, cb.Send(context.Background(), "test:dst", "5"), "connection refused", "error of the notifier")
+	setErr(Permanent(errors.New("bad destination")))
+	require.Error(t, cb.Send(context.Background(), "test:dst", "6"))
+	setErr(context.Canceled)
+	require.Error(t, cb.Send(context.Background(), "test:dst", "7"))
+	assert.Equal(t, CircuitClosed, cb.State(), "permanent error and cancellation don't count")
+	setErr(errors.New("connection refused"))
+	require.Error(t, cb.Send(context.Background(), "test:dst", "8"))
+	assert.Equal(t, CircuitOpen, cb.State())
+	assert.Equal(t, 8, calls)
+
+	// open circuit rejects sends without calling the notifier
+	err := cb.Send(context.Background(), "test:dst", "9")
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.EqualError(t, err, "circuit breaker is open for func notifier")
+	require.ErrorIs(t, SendMessage(context.Background(), []Notifier{cb}, "test:dst", Message{Body: "9"}), ErrCircuitOpen)
+	assert.Equal(t, 8, calls)
+
+	// failed trial opens the circuit again
+	now = now.Add(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, cb.State())
+	require.EqualError(t, cb.Send(context.Background(), "test:dst", "10"), "connection refused")
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	// successful trials close it
+	now = now.Add(time.Minute)
+	setErr(nil)
+	require.NoError(t, cb.Send(context.Background(), "test:dst", "11"))
+	assert.Equal(t, CircuitHalfOpen, cb.State(), "one more successful trial is needed")
+	require.NoError(t, cb.Send(context.Background(), "test:dst", "12"))
+	assert.Equal(t, CircuitClosed, cb.State())
+	assert.Equal(t, 11, calls)
+
+	assert.Equal(t, []string{
+		"closed -> open for func notifier",
+		"open -> half-open for func notifier",
+		"half-open -> open for func notifier",
+		"open -> half-open for func notifier",
+		"half-open -> closed for func notifier",
+	}, changes)
+}
+
+func TestCircuitBreaker_HalfOpenTrials(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	n := funcNotifier(func(_ context.Context, _, text string) error {
+		if text == "fail" {
+			return errors.New("failed")
+		}
+		close(started)
+		<-release
+		return nil
+	})
+	now := time.Now()
+	cb := NewCircuitBreaker(n, CircuitBreakerParams{FailureThreshold: 1})
+	cb.now = func() time.Time { return now }
+	require.Error(t, cb.Send(context.Background(), "test:dst", "fail"))
+	assert.Equal(t, CircuitOpen, cb.State())
+	now = now.Add(time.Second * 30)
+
+	trial := make(chan error)
+	go func() { trial <- cb.Send(context.Background(), "test:dst", "trial") }()
+	<-started
+	require.ErrorIs(t, cb.Send(context.Background(), "test:dst", "other"), ErrCircuitOpen, "only one trial send at once by default")
+	close(release)
+	require.NoError(t, <-trial)
+	assert.Equal(t, CircuitClosed, cb.State())
+}
+
+func TestCircuitState_String(t *testing.T) {
+	assert.Equal(t, "closed", CircuitClosed.String())
+	assert.Equal(t, "open", CircuitOpen.String())
+	assert.Equal(t, "half-open", CircuitHalfOpen.String())
+	assert.Equal(t, "circuit-state(7)", CircuitState(7).String())
+}
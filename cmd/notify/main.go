@@ -0,0 +1,350 @@
+// Command notify sends the message from stdin or --text to the destinations, with notifiers made from DSN strings
+// or the config file, see notify.FromDSN and notify.LoadConfig.
+//
+// Usage:
+//
+//	echo "disk is full" | notify --dsn "telegram://${TG_TOKEN}@" telegram:ops mailto:ops@example.org
+//	notify --config /etc/notify.yml --to slack:ops --text "backup is done"
+//	notify --config /etc/notify.yml --template alert.tmpl --to slack:ops < alert.json
+//	notify --config /etc/notify.yml --serve :8080 --client "billing:mailto,slack:${BILLING_TOKEN}" --queue 4
+//
+// With --serve it runs notify.Gateway on the address until interrupted, for the clients set with --client
+// in format name:schemes:token, with comma-separated list of allowed destination schemes, empty for any scheme.
+// Secret references in the token are expanded, see notify.ExpandSecrets.
+//
+// NOTIFY_CONFIG, NOTIFY_DSN, NOTIFY_TO and NOTIFY_CLIENTS environment variables are used when the flags are not set,
+// with space-separated lists of DSN strings, destinations and clients.
+//
+// Exit codes are 0 on success, 1 on permanent failure like the invalid destination, which is not fixed by retrying,
+// 2 on usage or config error, and 75 (EX_TEMPFAIL) on temporary failure, when it makes sense to retry later.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+
+	"github.com/go-pkgz/notify"
+)
+
+// exit codes
+const (
+	exitOK        = 0
+	exitPermanent = 1
+	exitUsage     = 2
+	exitTemporary = 75 // EX_TEMPFAIL of sysexits.h
+)
+
+// options of the command
+type options struct {
+	config   string
+	dsn      listFlag
+	to       listFlag
+	text     string
+	template string
+	timeout  time.Duration
+	dryRun   bool
+	validate bool
+	online   bool
+	serve    string
+	clients  listFlag
+	queue    int
+	dbg      bool
+}
+
+// listFlag is a flag which could be repeated
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, " ") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command with the arguments and returns the exit code, ctx stops the gateway
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseArgs(args, stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		_, _ = fmt.Fprintf(stderr, "notify: %v\n", err)
+		return exitUsage
+	}
+	if opts.dbg {
+		lgr.Setup(lgr.Debug)
+	}
+
+	notifiers, err := makeNotifiers(opts)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "notify: %v\n", err)
+		return exitUsage
+	}
+
+	if opts.serve != "" {
+		return serve(ctx, notifiers, opts, stderr)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	if opts.validate {
+		return validate(ctx, notifiers, opts, stdout, stderr)
+	}
+
+	render, err := makeRenderer(opts, stdin)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "notify: %v\n", err)
+		return exitUsage
+	}
+
+	var errs []error
+	for _, destination := range opts.to {
+		if err = send(ctx, notifiers, destination, render, opts.dryRun, stdout); err != nil {
+			_, _ = fmt.Fprintf(stderr, "notify: problem sending to %s: %v\n", destination, err)
+			errs = append(errs, err)
+		}
+	}
+	return exitCode(errs)
+}
+
+// parseArgs parses the arguments, with environment variables for the flags which are not set
+func parseArgs(args []string, stderr io.Writer) (options, error) {
+	var opts options
+	fs := flag.NewFlagSet("notify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.config, "config", os.Getenv("NOTIFY_CONFIG"), "JSON or YAML config file with notifiers, $NOTIFY_CONFIG")
+	fs.Var(&opts.dsn, "dsn", "DSN of the notifier, could be repeated, $NOTIFY_DSN")
+	fs.Var(&opts.to, "to", "destination of the message, could be repeated or passed as arguments, $NOTIFY_TO")
+	fs.StringVar(&opts.text, "text", "", "text of the message, read from stdin if not set")
+	fs.StringVar(&opts.template, "template", "", "text template file, rendered with JSON data from stdin or --text")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "time limit of sending to all destinations, of every request with --serve")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "print the messages and check the destinations without sending")
+	fs.BoolVar(&opts.validate, "validate", false, "check the destinations and exit")
+	fs.BoolVar(&opts.online, "online", false, "check the destinations with the services, with --validate")
+	fs.StringVar(&opts.serve, "serve", "", "address to serve the gateway on, like :8080")
+	fs.Var(&opts.clients, "client", "gateway client in format name:schemes:token, could be repeated, $NOTIFY_CLIENTS")
+	fs.IntVar(&opts.queue, "queue", 0, "number of gateway workers delivering queued requests, queued requests are rejected if 0")
+	fs.BoolVar(&opts.dbg, "dbg", false, "debug mode")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "Usage: notify [flags] [destination...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return options{}, err
+	}
+
+	opts.to = append(opts.to, fs.Args()...)
+	if len(opts.dsn) == 0 {
+		opts.dsn = strings.Fields(os.Getenv("NOTIFY_DSN"))
+	}
+	if len(opts.to) == 0 {
+		opts.to = strings.Fields(os.Getenv("NOTIFY_TO"))
+	}
+	if len(opts.clients) == 0 {
+		opts.clients = strings.Fields(os.Getenv("NOTIFY_CLIENTS"))
+	}
+	if opts.serve != "" {
+		if len(opts.clients) == 0 {
+			return options{}, errors.New("no gateway clients, set them with --client")
+		}
+		if opts.validate || opts.dryRun {
+			return options{}, errors.New("--serve can't be used with --validate or --dry-run")
+		}
+		return opts, nil
+	}
+	if len(opts.to) == 0 {
+		return options{}, errors.New("no destinations, set them with --to or as arguments")
+	}
+	if opts.online && !opts.validate {
+		return options{}, errors.New("--online works with --validate only")
+	}
+	return opts, nil
+}
+
+// makeNotifiers makes notifiers of the config and DSN strings, the config ones go first
+func makeNotifiers(opts options) ([]notify.Notifier, error) {
+	var res []notify.Notifier
+	if opts.config != "" {
+		notifiers, err := notify.LoadConfig(opts.config)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, notifiers...)
+	}
+	for _, dsn := range opts.dsn {
+		n, err := notify.FromDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	if len(res) == 0 {
+		return nil, errors.New("no notifiers, set them with --config or --dsn")
+	}
+	return res, nil
+}
+
+// makeRenderer returns func making the text for the destination, from the template if it's set
+func makeRenderer(opts options, stdin io.Reader) (func(destination string) (string, error), error) {
+	text := opts.text
+	if text == "" {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("problem reading stdin: %w", err)
+		}
+		text = strings.TrimRight(string(data), "\n")
+	}
+	if text == "" {
+		return nil, errors.New("nothing to send, set --text or pass the message to stdin")
+	}
+	if opts.template == "" {
+		return func(string) (string, error) { return text, nil }, nil
+	}
+
+	tmplText, err := os.ReadFile(opts.template)
+	if err != nil {
+		return nil, fmt.Errorf("problem reading template: %w", err)
+	}
+	tmpl := notify.NewTemplates()
+	if err = tmpl.AddText("message", "", string(tmplText)); err != nil {
+		return nil, err
+	}
+	var data any
+	if err = json.Unmarshal([]byte(text), &data); err != nil {
+		return nil, fmt.Errorf("problem parsing template data, it should be JSON: %w", err)
+	}
+	return func(destination string) (string, error) { return tmpl.Render("message", destination, data) }, nil
+}
+
+// send sends the text for the destination, or prints it and checks the destination in dry run
+func send(ctx context.Context, notifiers []notify.Notifier, destination string,
+	render func(destination string) (string, error), dryRun bool, stdout io.Writer) error {
+	text, err := render(destination)
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		return notify.Send(ctx, notifiers, destination, text)
+	}
+	if err = notify.Validate(notifiers, destination); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(stdout, "to %s:\n%s\n", destination, text)
+	return nil
+}
+
+// validate checks the destinations, with the services if --online is set
+func validate(ctx context.Context, notifiers []notify.Notifier, opts options, stdout, stderr io.Writer) int {
+	var errs []error
+	for _, destination := range opts.to {
+		err := notify.Validate(notifiers, destination)
+		if err == nil && opts.online {
+			err = notify.ValidateOnline(ctx, notifiers, destination)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "notify: %s is not valid: %v\n", destination, err)
+			errs = append(errs, err)
+			continue
+		}
+		_, _ = fmt.Fprintf(stdout, "%s is valid\n", destination)
+	}
+	return exitCode(errs)
+}
+
+// serve runs the gateway until ctx is done
+func serve(ctx context.Context, notifiers []notify.Notifier, opts options, stderr io.Writer) int {
+	clients, err := parseClients(opts.clients)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "notify: %v\n", err)
+		return exitUsage
+	}
+	params := notify.GatewayParams{Clients: clients, Timeout: opts.timeout}
+	if opts.queue > 0 {
+		if params.Queue, err = notify.NewDispatcher(notifiers, notify.DispatcherParams{Workers: opts.queue}); err != nil {
+			_, _ = fmt.Fprintf(stderr, "notify: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	srv := &http.Server{Addr: opts.serve, Handler: notify.NewGateway(notifiers, params), ReadHeaderTimeout: 10 * time.Second}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	code := exitOK
+	select {
+	case err = <-errCh:
+		_, _ = fmt.Fprintf(stderr, "notify: %v\n", err)
+		code = exitUsage
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		_, _ = fmt.Fprintf(stderr, "notify: problem stopping gateway: %v\n", err)
+	}
+	if params.Queue != nil {
+		if err = params.Queue.Shutdown(shutdownCtx); err != nil {
+			_, _ = fmt.Fprintf(stderr, "notify: problem delivering queued messages: %v\n", err)
+		}
+	}
+	return code
+}
+
+// parseClients parses gateway clients in format name:schemes:token, expanding secret references in the token
+func parseClients(clients []string) ([]notify.GatewayClient, error) {
+	res := make([]notify.GatewayClient, 0, len(clients))
+	for i, c := range clients {
+		parts := strings.SplitN(c, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			// the entry could be a bare token, so only the name is reported, when it's there
+			if len(parts) == 1 {
+				return nil, fmt.Errorf("gateway client %d should be in format name:schemes:token", i+1)
+			}
+			return nil, fmt.Errorf("gateway client %d %q should be in format name:schemes:token", i+1, parts[0])
+		}
+		token, err := notify.ExpandSecrets(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("problem reading token of gateway client %s: %w", parts[0], err)
+		}
+		client := notify.GatewayClient{Name: parts[0], Token: token}
+		if parts[1] != "" {
+			client.Schemes = strings.Split(parts[1], ",")
+		}
+		res = append(res, client)
+	}
+	return res, nil
+}
+
+// exitCode returns the exit code for the errors of destinations, permanent one if any of them is permanent,
+// as retrying won't deliver the message to all destinations then
+func exitCode(errs []error) int {
+	if len(errs) == 0 {
+		return exitOK
+	}
+	for _, err := range errs {
+		if notify.IsPermanent(err) || errors.Is(err, notify.ErrInvalidDestination) {
+			return exitPermanent
+		}
+	}
+	return exitTemporary
+}
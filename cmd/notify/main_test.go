@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/notify/notifytest"
+)
+
+func TestRun_Send(t *testing.T) {
+	srv := notifytest.NewWebhookReceiver(t)
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"--dsn", "webhook://", "--text", "disk is full", srv.URL + "/a", srv.URL + "/b"},
+		strings.NewReader(""), &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	srv.AssertReceived(t, "/a", "disk is full")
+	srv.AssertReceived(t, "/b", "disk is full")
+
+	code = run(context.Background(), []string{"--dsn", "webhook://", "--to", srv.URL + "/stdin"}, strings.NewReader("from stdin\n"), &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	srv.AssertReceived(t, "/stdin", "from stdin")
+	assert.Len(t, srv.Requests(), 3)
+}
+
+func TestRun_Env(t *testing.T) {
+	srv := notifytest.NewWebhookReceiver(t)
+	cfg := filepath.Join(t.TempDir(), "notify.yml")
+	require.NoError(t, os.WriteFile(cfg, []byte("notifiers:\n  - webhook://?header=X-Env:test\n"), 0o600))
+	t.Setenv("NOTIFY_CONFIG", cfg)
+	t.Setenv("NOTIFY_TO", srv.URL+"/a "+srv.URL+"/b")
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"--text", "hello"}, strings.NewReader(""), &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	requests := srv.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "test", requests[0].Header.Get("X-Env"))
+}
+
+func TestRun_Template(t *testing.T) {
+	srv := notifytest.NewWebhookReceiver(t)
+	tmpl := filepath.Join(t.TempDir(), "alert.tmpl")
+	require.NoError(t, os.WriteFile(tmpl, []byte("{{.host}}: {{.alert | truncate 8}}"), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"--dsn", "webhook://", "--template", tmpl, srv.URL + "/hook"},
+		strings.NewReader(`{"host": "db1", "alert": "disk is full"}`), &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	srv.AssertReceived(t, "/hook", "db1: disk is…")
+
+	stderr.Reset()
+	code = run(context.Background(), []string{"--dsn", "webhook://", "--template", tmpl, srv.URL + "/hook"}, strings.NewReader("not json"), &stdout, &stderr)
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr.String(), "problem parsing template data, it should be JSON")
+}
+
+func TestRun_DryRun(t *testing.T) {
+	srv := notifytest.NewWebhookReceiver(t)
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"--dsn", "webhook://", "--dry-run", "--text", "hello", srv.URL + "/hook"}, strings.NewReader(""), &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Equal(t, "to "+srv.URL+"/hook:\nhello\n", stdout.String())
+	assert.Empty(t, srv.Requests())
+
+	code = run(context.Background(), []string{"--dsn", "webhook://", "--dry-run", "--text", "hello", "slack:ops"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, exitPermanent, code)
+	assert.Contains(t, stderr.String(), "notify: problem sending to slack:ops: unsupported destination schema: slack")
+}
+
+func TestRun_Validate(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"--dsn", "webhook://", "--validate", "https://example.org/hook"}, strings.NewReader(""), &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Equal(t, "https://example.org/hook is valid\n", stdout.String())
+
+	code = run(context.Background(), []string{"--dsn", "webhook://", "--validate", "https:///hook"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, exitPermanent, code)
+	assert.Contains(t, stderr.String(), "notify: https:///hook is not valid: no host in webhook destination")
+}
+
+func TestRun_Failures(t *testing.T) {
+	srv := notifytest.NewWebhookReceiver(t)
+
+	var stdout, stderr bytes.Buffer
+	srv.SetStatus(http.StatusServiceUnavailable)
+	code := run(context.Background(), []string{"--dsn", "webhook://", "--text", "hello", srv.URL + "/hook"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, exitTemporary, code)
+
+	srv.SetStatus(http.StatusNotFound)
+	code = run(context.Background(), []string{"--dsn", "webhook://", "--text", "hello", srv.URL + "/hook"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, exitPermanent, code)
+	assert.Len(t, srv.Requests(), 2)
+}
+
+func TestRun_UsageErrors(t *testing.T) {
+	t.Setenv("NOTIFY_CONFIG", "")
+	t.Setenv("NOTIFY_DSN", "")
+	t.Setenv("NOTIFY_TO", "")
+	t.Setenv("NOTIFY_CLIENTS", "")
+
+	tbl := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--dsn", "webhook://", "--text", "hello"}, "no destinations, set them with --to or as arguments"},
+		{[]string{"--text", "hello", "slack:ops"}, "no notifiers, set them with --config or --dsn"},
+		{[]string{"--dsn", "ftp://host", "slack:ops"}, `unsupported dsn scheme "ftp"`},
+		{[]string{"--dsn", "webhook://", "https://example.org"}, "nothing to send, set --text or pass the message to stdin"},
+		{[]string{"--dsn", "webhook://", "--online", "https://example.org"}, "--online works with --validate only"},
+		{[]string{"--unknown"}, "flag provided but not defined: -unknown"},
+		{[]string{"--dsn", "webhook://", "--serve", ":0"}, "no gateway clients, set them with --client"},
+		{[]string{"--dsn", "webhook://", "--serve", ":0", "--client", "ops::token", "--dry-run"}, "--serve can't be used with --validate or --dry-run"},
+		{[]string{"--dsn", "webhook://", "--serve", ":0", "--client", "ops:token"}, `gateway client 1 "ops" should be in format name:schemes:token`},
+		{[]string{"--dsn", "webhook://", "--serve", ":0", "--client", "ops::token", "--client", "secret-token"},
+			"gateway client 2 should be in format name:schemes:token"},
+		{[]string{"--dsn", "webhook://", "--serve", ":0", "--client", "ops::${NOTIFY_TEST_UNSET}"},
+			"problem reading token of gateway client ops: environment variable NOTIFY_TEST_UNSET is not set"},
+	}
+	for _, tt := range tbl {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(context.Background(), tt.args, strings.NewReader(""), &stdout, &stderr)
+			assert.Equal(t, exitUsage, code)
+			assert.Contains(t, stderr.String(), tt.err)
+			assert.NotContains(t, stderr.String(), "secret-token", "malformed client entry is not printed")
+		})
+	}
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitOK, run(context.Background(), []string{"--help"}, strings.NewReader(""), &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: notify [flags] [destination...]")
+}
+
+func TestRun_Serve(t *testing.T) {
+	srv := notifytest.NewWebhookReceiver(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	t.Setenv("NOTIFY_TEST_TOKEN", "secret")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	var stdout, stderr bytes.Buffer
+	go func() {
+		done <- run(ctx, []string{"--dsn", "webhook://", "--serve", addr, "--client", "app:http:${NOTIFY_TEST_TOKEN}", "--queue", "1"},
+			strings.NewReader(""), &stdout, &stderr)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}} // no idle connections delaying shutdown
+	send := func(body string) (*http.Response, error) {
+		req, e := http.NewRequest(http.MethodPost, "http://"+addr+"/send", strings.NewReader(body))
+		require.NoError(t, e)
+		req.Header.Set("Authorization", "Bearer secret")
+		return client.Do(req)
+	}
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = send(`{"destinations": ["` + srv.URL + `/sync"], "text": "hello"}`)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	var gr struct {
+		OK bool `json:"ok"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&gr))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, gr.OK)
+	srv.AssertReceived(t, "/sync", "hello")
+
+	resp, err = send(`{"destinations": ["` + srv.URL + `/queued"], "text": "later", "queue": true}`)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = send(`{"destinations": ["slack:ops"], "text": "hello"}`)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	cancel()
+	select {
+	case code := <-done:
+		assert.Equal(t, exitOK, code, stderr.String())
+	case <-time.After(5 * time.Second):
+		t.Fatal("gateway is not stopped")
+	}
+	srv.AssertReceived(t, "/queued", "later") // queued messages are delivered on shutdown
+}
@@ -0,0 +1,260 @@
+package notify
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// DedupEntry is a message sent by Dedup, kept in DedupStore for the window
+type DedupEntry struct {
+	Destination string
+	Text        string    // text of the message, used for the summary
+	Sent        time.Time // time the message was sent, the window starts then
+	Suppressed  int       // number of duplicates suppressed in the window
+}
+
+// DedupStore keeps messages sent by Dedup, it should be safe for concurrent use
+type DedupStore interface {
+	Get(key string) (DedupEntry, bool)
+	Set(key string, entry DedupEntry)
+	Delete(key string)
+}
+
+// DedupParams contain settings for Dedup
+type DedupParams struct {
+	Window  time.Duration                            // time duplicates of the sent message are suppressed for, 1 minute by default
+	Store   DedupStore                               // storage of sent messages, LRUDedupStore of 10000 entries by default
+	Summary func(suppressed int, text string) string // text sent to the destination when the window with duplicates closes, no summary if nil
+}
+
+// DefaultDedupSummary is a summary for DedupParams, telling how many duplicates of the message were suppressed
+func DefaultDedupSummary(suppressed int, text string) string {
+	return fmt.Sprintf("suppressed %d duplicates of the message: %s", suppressed, text)
+}
+
+// Dedup wraps notifier to suppress duplicates of the sent messages within the window. Messages are duplicates if they
+// have the same destination and text, or the same destination and the key set with WithDedupKey. Duplicates of
+// the message which is still sending wait for its result and return its error, so they are suppressed only if
+// the message is sent, and sends of other duplicates return no error. If Summary is set, it's sent to the destination
+// when the window with suppressed duplicates closes.
+type Dedup struct {
+	Notifier
+	DedupParams
+
+	mu       sync.Mutex
+	timers   map[string]*time.Timer // timers of summaries by key
+	inflight map[string]*dedupCall  // sends in progress by key
+}
+
+// dedupCall is the send in progress, duplicates arriving during it wait for its result
+type dedupCall struct {
+	done chan struct{} // closed when the send is finished
+	err  error
+}
+
+// dedupKeyCtx is the context key for the key of the message set by WithDedupKey
+type dedupKeyCtx struct{}
+
+// WithDedupKey returns context with the key telling Dedup which messages are duplicates, instead of their text
+func WithDedupKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, dedupKeyCtx{}, key)
+}
+
+// NewDedup makes Dedup for the notifier
+func NewDedup(n Notifier, params DedupParams) *Dedup {
+	res := &Dedup{Notifier: n, DedupParams: params, timers: map[string]*time.Timer{}, inflight: map[string]*dedupCall{}}
+	if res.Window <= 0 {
+		res.Window = time.Minute
+	}
+	if res.Store == nil {
+		res.Store = NewLRUDedupStore(10000)
+	}
+	return res
+}
+
+// Send sends the message unless it's a duplicate of the message sent within the window
+func (d *Dedup) Send(ctx context.Context, destination, text string) error {
+	return d.send(ctx, destination, text, func() error { return d.Notifier.Send(ctx, destination, text) })
+}
+
+// SendMessage sends the message unless it's a duplicate of the message sent within the window,
+// messages with the same text representation are duplicates
+func (d *Dedup) SendMessage(ctx context.Context, destination string, msg Message) error {
+	return d.send(ctx, destination, msg.Text(), func() error { return sendMessage(ctx, d.Notifier, destination, msg) })
+}
+
+// Schemes returns destination schemes supported by the wrapped notifier
+func (d *Dedup) Schemes() []string {
+	return notifierSchemes(d.Notifier)
+}
+
+// Unwrap returns the wrapped notifier
+func (d *Dedup) Unwrap() Notifier {
+	return d.Notifier
+}
+
+// send calls send func unless the message is a duplicate
+func (d *Dedup) send(ctx context.Context, destination, text string, send func() error) error {
+	key := d.key(ctx, destination, text)
+	now := time.Now()
+
+	d.mu.Lock()
+	entry, ok := d.Store.Get(key)
+	if ok && now.Sub(entry.Sent) < d.Window {
+		if call := d.inflight[key]; call != nil {
+			d.mu.Unlock()
+			return d.wait(ctx, key, call)
+		}
+		d.suppress(key, entry, now)
+		d.mu.Unlock()
+		return nil
+	}
+	call := &dedupCall{done: make(chan struct{})}
+	d.inflight[key] = call
+	d.Store.Set(key, DedupEntry{Destination: destination, Text: text, Sent: now})
+	d.mu.Unlock()
+
+	call.err = send()
+	d.mu.Lock()
+	if d.inflight[key] == call {
+		delete(d.inflight, key)
+	}
+	if entry, ok = d.Store.Get(key); call.err != nil && ok && entry.Sent.Equal(now) {
+		// message wasn't sent, so the next one is not a duplicate
+		d.Store.Delete(key)
+	}
+	d.mu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// wait waits for the result of the send in progress, and counts the duplicate as suppressed if the message is sent
+func (d *Dedup) wait(ctx context.Context, key string, call *dedupCall) error {
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if call.err != nil {
+		return call.err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if entry, ok := d.Store.Get(key); ok {
+		d.suppress(key, entry, time.Now())
+	}
+	return nil
+}
+
+// suppress counts the duplicate of the entry, and schedules the summary for the end of the window.
+// It's called with mu held.
+func (d *Dedup) suppress(key string, entry DedupEntry, now time.Time) {
+	entry.Suppressed++
+	d.Store.Set(key, entry)
+	if d.Summary != nil && d.timers[key] == nil {
+		d.timers[key] = time.AfterFunc(entry.Sent.Add(d.Window).Sub(now), func() { d.sendSummary(key) })
+	}
+}
+
+// sendSummary sends the summary of duplicates suppressed in the closed window
+func (d *Dedup) sendSummary(key string) {
+	d.mu.Lock()
+	delete(d.timers, key)
+	entry, ok := d.Store.Get(key)
+	if ok {
+		d.Store.Delete(key)
+	}
+	d.mu.Unlock()
+
+	if !ok || entry.Suppressed == 0 {
+		return
+	}
+	if err := d.Notifier.Send(context.Background(), entry.Destination, d.Summary(entry.Suppressed, entry.Text)); err != nil {
+		log.Printf("[WARN] failed to send summary of suppressed duplicates to %s: %v", redactDestination(entry.Destination), err)
+	}
+}
+
+// key returns key of the message in the store, hash of the destination and the text, or of the key from context
+func (d *Dedup) key(ctx context.Context, destination, text string) string {
+	h := sha256.New()
+	h.Write([]byte(destination))
+	h.Write([]byte{0})
+	if key, ok := ctx.Value(dedupKeyCtx{}).(string); ok {
+		h.Write([]byte("key:" + key))
+	} else {
+		h.Write([]byte("text:" + text))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// LRUDedupStore is in-memory DedupStore keeping the limited number of recently used entries
+type LRUDedupStore struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List               // keys, the most recently used first
+	items map[string]*list.Element // elements of order by key
+}
+
+// lruItem is the element of LRUDedupStore
+type lruItem struct {
+	key   string
+	entry DedupEntry
+}
+
+// NewLRUDedupStore makes LRUDedupStore keeping up to size entries
+func NewLRUDedupStore(size int) *LRUDedupStore {
+	return &LRUDedupStore{size: max(size, 1), order: list.New(), items: map[string]*list.Element{}}
+}
+
+// Get returns the entry by key
+func (s *LRUDedupStore) Get(key string) (DedupEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return DedupEntry{}, false
+	}
+	s.order.MoveToFront(el)
+	return el.Value.(*lruItem).entry, true
+}
+
+// Set puts the entry, removing the least recently used one if the store is full
+func (s *LRUDedupStore) Set(key string, entry DedupEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		el.Value.(*lruItem).entry = entry
+		s.order.MoveToFront(el)
+		return
+	}
+	s.items[key] = s.order.PushFront(&lruItem{key: key, entry: entry})
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*lruItem).key)
+	}
+}
+
+// Delete removes the entry by key
+func (s *LRUDedupStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.order.Remove(el)
+		delete(s.items, key)
+	}
+}
+
+// Len returns number of entries in the store
+func (s *LRUDedupStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
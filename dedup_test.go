@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier is a "test" notifier recording destinations and texts it sent
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []string
+	err  error
+}
+
+func (n *recordingNotifier) Send(_ context.Context, destination, text string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, destination+" "+text)
+	return nil
+}
+
+func (n *recordingNotifier) Schema() string { return "test" }
+
+func (n *recordingNotifier) String() string { return "recording notifier" }
+
+func (n *recordingNotifier) get() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.sent...)
+}
+
+func TestDedup(t *testing.T) {
+	rec := &recordingNotifier{}
+	d := NewDedup(rec, DedupParams{Window: time.Minute})
+	assert.Equal(t, "recording notifier", d.String())
+	assert.Equal(t, "test", d.Schema())
+
+	for range 3 {
+		require.NoError(t, d.Send(context.Background(), "test:a", "disk is full"))
+		require.NoError(t, d.Send(context.Background(), "test:b", "disk is full"))
+	}
+	require.NoError(t, d.Send(context.Background(), "test:a", "disk is ok"))
+	require.NoError(t, SendMessage(context.Background(), []Notifier{d}, "test:a", Message{Body: "disk is full"}),
+		"message with the same text is a duplicate")
+	assert.Equal(t, []string{"test:a disk is full", "test:b disk is full", "test:a disk is ok"}, rec.get())
+
+	// caller-provided key
+	ctx := WithDedupKey(context.Background(), "disk")
+	require.NoError(t, d.Send(ctx, "test:a", "disk is 95% full"))
+	require.NoError(t, d.Send(ctx, "test:a", "disk is 96% full"))
+	assert.Equal(t, []string{"test:a disk is full", "test:b disk is full", "test:a disk is ok", "test:a disk is 95% full"}, rec.get())
+}
+
+func TestDedup_Window(t *testing.T) {
+	rec := &recordingNotifier{}
+	d := NewDedup(rec, DedupParams{Window: time.Millisecond * 50})
+	require.NoError(t, d.Send(context.Background(), "test:a", "text"))
+	require.NoError(t, d.Send(context.Background(), "test:a", "text"))
+	time.Sleep(time.Millisecond * 60)
+	require.NoError(t, d.Send(context.Background(), "test:a", "text"))
+	assert.Equal(t, []string{"test:a text", "test:a text"}, rec.get(), "message is sent again after the window")
+}
+
+func TestDedup_Summary(t *testing.T) {
+	rec := &recordingNotifier{}
+	d := NewDedup(rec, DedupParams{Window: time.Millisecond * 50, Summary: DefaultDedupSummary})
+	for range 4 {
+		require.NoError(t, d.Send(context.Background(), "test:a", "flapping"))
+	}
+	require.NoError(t, d.Send(context.Background(), "test:b", "single"))
+	assert.Eventually(t, func() bool { return len(rec.get()) == 3 }, time.Second, time.Millisecond*10)
+	time.Sleep(time.Millisecond * 60)
+	assert.Equal(t, []string{"test:a flapping", "test:b single", "test:a suppressed 3 duplicates of the message: flapping"}, rec.get(),
+		"summary is sent only for the window with duplicates")
+
+	require.NoError(t, d.Send(context.Background(), "test:a", "flapping"))
+	assert.Len(t, rec.get(), 4, "new window starts after the summary")
+}
+
+func TestDedup_FailedSend(t *testing.T) {
+	rec := &recordingNotifier{err: errors.New("send failed")}
+	d := NewDedup(rec, DedupParams{})
+	require.EqualError(t, d.Send(context.Background(), "test:a", "text"), "send failed")
+	rec.mu.Lock()
+	rec.err = nil
+	rec.mu.Unlock()
+	require.NoError(t, d.Send(context.Background(), "test:a", "text"))
+	assert.Equal(t, []string{"test:a text"}, rec.get(), "failed message is not a duplicate")
+}
+
+func TestDedup_FailedSendWithDuplicate(t *testing.T) {
+	rec := &recordingNotifier{}
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int
+	failing := funcNotifier(func(ctx context.Context, destination, text string) error {
+		if calls++; calls == 1 {
+			close(started)
+			<-release
+			return errors.New("send failed")
+		}
+		return rec.Send(ctx, destination, text)
+	})
+	store := &signalingStore{DedupStore: NewLRUDedupStore(10), got: make(chan struct{}, 100)}
+	d := NewDedup(failing, DedupParams{Window: time.Millisecond * 50, Summary: DefaultDedupSummary, Store: store})
+
+	errCh := make(chan error, 3)
+	go func() { errCh <- d.Send(context.Background(), "test:a", "text") }()
+	<-started
+	<-store.got
+	for range 2 {
+		go func() { errCh <- d.Send(context.Background(), "test:a", "text") }()
+		<-store.got // duplicate arrived while the first send is in flight
+	}
+	close(release)
+	for range 3 {
+		require.EqualError(t, <-errCh, "send failed", "duplicates get the error of the message in flight")
+	}
+
+	require.NoError(t, d.Send(context.Background(), "test:a", "text"))
+	assert.Equal(t, []string{"test:a text"}, rec.get(), "retry of the failed message is not a duplicate")
+	time.Sleep(time.Millisecond * 60)
+	assert.Equal(t, []string{"test:a text"}, rec.get(), "no summary of duplicates of the failed message")
+}
+
+func TestDedup_DuplicateInFlight(t *testing.T) {
+	rec := &recordingNotifier{}
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	slow := funcNotifier(func(ctx context.Context, destination, text string) error {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		return rec.Send(ctx, destination, text)
+	})
+	store := &signalingStore{DedupStore: NewLRUDedupStore(10), got: make(chan struct{}, 100)}
+	d := NewDedup(slow, DedupParams{Window: time.Millisecond * 50, Summary: DefaultDedupSummary, Store: store})
+
+	errCh := make(chan error, 2)
+	go func() { errCh <- d.Send(context.Background(), "test:a", "text") }()
+	<-started
+	<-store.got
+	go func() { errCh <- d.Send(context.Background(), "test:a", "text") }()
+	<-store.got
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, d.Send(ctx, "test:a", "text"), context.Canceled, "duplicate stops waiting when its context is done")
+
+	close(release)
+	require.NoError(t, <-errCh)
+	require.NoError(t, <-errCh)
+	assert.Eventually(t, func() bool { return len(rec.get()) == 2 }, time.Second, time.Millisecond*10)
+	assert.Equal(t, []string{"test:a text", "test:a suppressed 1 duplicates of the message: text"}, rec.get(),
+		"duplicate is suppressed once the message is sent")
+}
+
+// signalingStore is DedupStore signaling to got on every Get
+type signalingStore struct {
+	DedupStore
+	got chan struct{}
+}
+
+func (s *signalingStore) Get(key string) (DedupEntry, bool) {
+	s.got <- struct{}{}
+	return s.DedupStore.Get(key)
+}
+
+func TestLRUDedupStore(t *testing.T) {
+	s := NewLRUDedupStore(2)
+	s.Set("a", DedupEntry{Text: "a"})
+	s.Set("b", DedupEntry{Text: "b"})
+	_, ok := s.Get("a")
+	require.True(t, ok)
+	s.Set("c", DedupEntry{Text: "c"})
+	assert.Equal(t, 2, s.Len())
+	_, ok = s.Get("b")
+	assert.False(t, ok, "least recently used entry is removed")
+	e, ok := s.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "a", e.Text)
+
+	s.Set("a", DedupEntry{Text: "a2"})
+	e, _ = s.Get("a")
+	assert.Equal(t, "a2", e.Text)
+	s.Delete("a")
+	s.Delete("unknown")
+	_, ok = s.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, s.Len())
+}
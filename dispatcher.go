@@ -0,0 +1,279 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// OverflowPolicy defines what Dispatcher does with a new message when its queue is full
+type OverflowPolicy int
+
+// supported overflow policies
+const (
+	OverflowBlock      OverflowPolicy = iota // wait for a free slot in the queue until the context of Send is done
+	OverflowDropOldest                       // drop the oldest message from the queue, reporting it as failed with ErrQueueFull
+	OverflowReject                           // reject the new message with ErrQueueFull
+)
+
+// ErrQueueFull is returned for messages rejected or dropped because the queue of Dispatcher is full
+var ErrQueueFull = errors.New("dispatcher queue is full")
+
+// ErrDispatcherClosed is returned for messages sent to Dispatcher after Shutdown was called
+var ErrDispatcherClosed = errors.New("dispatcher is shut down")
+
+// Delivery is a message queued by Dispatcher
+type Delivery struct {
+	ID            string // identifier of the message in Outbox, empty without it
+	Destination   string
+	Text          string
+	CorrelationID string // correlation ID of the context of Send, set for the context of delivery
+}
+
+// DispatcherParams contain settings for Dispatcher
+type DispatcherParams struct {
+	Workers   int                         // number of messages sent at the same time, 1 by default
+	QueueSize int                         // max number of messages waiting to be sent, 100 by default
+	Overflow  OverflowPolicy              // what to do with a new message when the queue is full, OverflowBlock by default
+	Timeout   time.Duration               // time limit for a single delivery, no limit by default
+	OnError   func(d Delivery, err error) // called for failed and dropped messages, errors are logged if not set
+	Outbox    Outbox                      // persistent storage for queued messages, optional
+}
+
+// Dispatcher sends messages asynchronously: Send puts the message into a bounded in-memory queue
+// and returns, and the workers deliver queued messages using the notifiers, the same way Send function does.
+// Failed deliveries are reported to OnError.
+//
+// With Outbox set, the message is persisted before it's queued and acknowledged once it's processed,
+// successfully or not. Messages left unacknowledged by the previous run, e.g. because of the crash
+// or interrupted Shutdown, are queued again in the background when Dispatcher is created, waiting for free slots
+// in the queue regardless of the overflow policy, mixed with new messages.
+type Dispatcher struct {
+	DispatcherParams
+	notifiers []Notifier
+	queue     chan Delivery
+
+	mu        sync.RWMutex  // held for write only to stop accepting messages, so that no one sends to the closed channel
+	closed    bool          // set by Shutdown, no new messages are accepted then
+	done      chan struct{} // closed by Shutdown to release senders waiting for a free slot in the queue
+	stopOnce  sync.Once
+	replaying sync.WaitGroup // pending messages of the outbox are being queued, the queue is closed after that
+
+	ctx    context.Context // context of deliveries, canceled when Shutdown is interrupted
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher makes Dispatcher for provided notifiers and starts its workers,
+// queueing messages pending in Outbox if it's set
+func NewDispatcher(notifiers []Notifier, params DispatcherParams) (*Dispatcher, error) {
+	res := &Dispatcher{DispatcherParams: params, notifiers: notifiers, done: make(chan struct{})}
+	if res.Workers <= 0 {
+		res.Workers = 1
+	}
+	if res.QueueSize <= 0 {
+		res.QueueSize = 100
+	}
+
+	var pending []Delivery
+	if res.Outbox != nil {
+		var err error
+		if pending, err = res.Outbox.Pending(); err != nil {
+			return nil, fmt.Errorf("can't load pending messages from outbox: %w", err)
+		}
+	}
+
+	res.queue = make(chan Delivery, res.QueueSize)
+	res.ctx, res.cancel = context.WithCancel(context.Background())
+	for range res.Workers {
+		res.wg.Go(res.worker)
+	}
+	if len(pending) > 0 {
+		res.replaying.Go(func() { res.replay(pending) })
+	}
+	return res, nil
+}
+
+// Send puts message into the queue for delivery. Error is returned only if the message can't be queued:
+// destination is not supported by any of the notifiers, the queue is full or Dispatcher is shut down.
+func (d *Dispatcher) Send(ctx context.Context, destination, text string) error {
+	if _, err := findNotifier(d.notifiers, destination); err != nil {
+		return err
+	}
+
+	del := Delivery{Destination: destination, Text: text, CorrelationID: CorrelationID(ctx)}
+	if d.Outbox != nil {
+		id, err := d.Outbox.Add(del)
+		if err != nil {
+			return fmt.Errorf("can't add message to outbox: %w", err)
+		}
+		del.ID = id
+	}
+	if err := d.enqueue(ctx, del); err != nil {
+		d.ack(del) // message is rejected, so it's not going to be sent
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting new messages and waits for the queued ones to be delivered.
+// If ctx is done before that, deliveries in progress are canceled, the rest of the queue is reported
+// to OnError with ErrDispatcherClosed, and ctx error is returned.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.stopOnce.Do(func() {
+		close(d.done)
+		d.mu.Lock()
+		d.closed = true
+		d.mu.Unlock()
+		go func() {
+			d.replaying.Wait()
+			close(d.queue)
+		}()
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-stopped
+		return ctx.Err()
+	}
+}
+
+// Schemes returns sorted list of schemes supported by the notifiers
+func (d *Dispatcher) Schemes() []string {
+	return notifiersSchemes(d.notifiers)
+}
+
+// Schema returns schemes supported by the notifiers separated by comma
+func (d *Dispatcher) Schema() string {
+	return strings.Join(d.Schemes(), ",")
+}
+
+// String describes the dispatcher
+func (d *Dispatcher) String() string {
+	return fmt.Sprintf("dispatcher with %d workers and queue size %d for schemes [%s]", d.Workers, d.QueueSize, d.Schema())
+}
+
+// enqueue puts delivery into the queue according to the overflow policy
+func (d *Dispatcher) enqueue(ctx context.Context, del Delivery) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrDispatcherClosed
+	}
+
+	switch d.Overflow {
+	case OverflowReject:
+		select {
+		case d.queue <- del:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case d.queue <- del:
+				return nil
+			default:
+			}
+			// queue is full, make room by dropping the oldest message unless a worker took it already
+			select {
+			case old := <-d.queue:
+				d.onError(old, ErrQueueFull)
+				d.ack(old)
+			default:
+			}
+		}
+	default:
+		select {
+		case d.queue <- del:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.done:
+			return ErrDispatcherClosed
+		}
+	}
+}
+
+// replay queues messages pending in the outbox, waiting for free slots in the queue. Messages which were not
+// queued before the shutdown was interrupted are reported with ErrDispatcherClosed and stay in the outbox.
+func (d *Dispatcher) replay(pending []Delivery) {
+	for i, del := range pending {
+		select {
+		case d.queue <- del:
+		case <-d.ctx.Done():
+			for _, rest := range pending[i:] {
+				d.onError(rest, ErrDispatcherClosed)
+			}
+			return
+		}
+	}
+}
+
+// worker delivers queued messages until the queue is closed and drained
+func (d *Dispatcher) worker() {
+	for del := range d.queue {
+		if d.ctx.Err() != nil {
+			// shutdown is interrupted, the rest of the queue is not delivered and stays in the outbox
+			d.onError(del, ErrDispatcherClosed)
+			continue
+		}
+		err := d.deliver(del)
+		if err != nil {
+			d.onError(del, err)
+		}
+		if d.ctx.Err() != nil && err != nil {
+			continue // delivery is interrupted by shutdown, message stays in the outbox to be sent after restart
+		}
+		d.ack(del)
+	}
+}
+
+// deliver sends the message, limiting the time of delivery by Timeout if it's set
+func (d *Dispatcher) deliver(del Delivery) error {
+	ctx := d.ctx
+	if del.CorrelationID != "" {
+		ctx = WithCorrelationID(ctx, del.CorrelationID)
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	return Send(ctx, d.notifiers, del.Destination, del.Text)
+}
+
+// ack removes processed message from the outbox
+func (d *Dispatcher) ack(del Delivery) {
+	if d.Outbox == nil || del.ID == "" {
+		return
+	}
+	if err := d.Outbox.Ack(del.ID); err != nil {
+		log.Printf("[WARN] can't remove message %s from outbox: %v", del.ID, err)
+	}
+}
+
+// onError reports failed delivery to OnError, or logs it if OnError is not set
+func (d *Dispatcher) onError(del Delivery, err error) {
+	if d.OnError != nil {
+		d.OnError(del, err)
+		return
+	}
+	log.Printf("[WARN] failed to send notification to %s: %v", del.Destination, err)
+}
@@ -0,0 +1,195 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcNotifier is a notifier for "test" schema sending with provided func
+type funcNotifier func(ctx context.Context, destination, text string) error
+
+func (f funcNotifier) Send(ctx context.Context, destination, text string) error {
+	return f(ctx, destination, text)
+}
+
+func (f funcNotifier) Schema() string { return "test" }
+
+func (f funcNotifier) String() string { return "func notifier" }
+
+// failures collects deliveries reported to OnError
+type failures struct {
+	sync.Mutex
+	list []string
+}
+
+func (f *failures) add(d Delivery, err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.list = append(f.list, d.Text+": "+err.Error())
+}
+
+func (f *failures) get() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string(nil), f.list...)
+}
+
+func TestDispatcher_Send(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	n := funcNotifier(func(_ context.Context, destination, text string) error {
+		if text == "bad" {
+			return errors.New("send failed")
+		}
+		mu.Lock()
+		sent = append(sent, destination+" "+text)
+		mu.Unlock()
+		return nil
+	})
+	f := &failures{}
+	d, err := NewDispatcher([]Notifier{n, NewWebhook(WebhookParams{})}, DispatcherParams{Workers: 3, OnError: f.add})
+	require.NoError(t, err)
+	assert.Equal(t, "dispatcher with 3 workers and queue size 100 for schemes [http,https,test]", d.String())
+	assert.Equal(t, "http,https,test", d.Schema())
+
+	for _, text := range []string{"a", "b", "bad", "c"} {
+		require.NoError(t, d.Send(context.Background(), "test:dst", text))
+	}
+	require.EqualError(t, d.Send(context.Background(), "slack:dst", "text"), "unsupported destination schema: slack")
+
+	require.NoError(t, d.Shutdown(context.Background()))
+	sort.Strings(sent)
+	assert.Equal(t, []string{"test:dst a", "test:dst b", "test:dst c"}, sent, "all queued messages are delivered on shutdown")
+	assert.Equal(t, []string{"bad: send failed"}, f.get())
+
+	require.ErrorIs(t, d.Send(context.Background(), "test:dst", "late"), ErrDispatcherClosed)
+	require.NoError(t, d.Shutdown(context.Background()), "repeated shutdown")
+}
+
+func TestDispatcher_Timeout(t *testing.T) {
+	n := funcNotifier(func(ctx context.Context, _, _ string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	f := &failures{}
+	d, err := NewDispatcher([]Notifier{n}, DispatcherParams{Timeout: time.Millisecond * 10, OnError: f.add})
+	require.NoError(t, err)
+	require.NoError(t, d.Send(context.Background(), "test:dst", "slow"))
+	require.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, []string{"slow: context deadline exceeded"}, f.get())
+}
+
+// blockedDispatcher returns dispatcher with a single worker busy until release is closed, and the queue of provided size
+func blockedDispatcher(t *testing.T, queueSize int, overflow OverflowPolicy, f *failures) (d *Dispatcher, sent func() []string, release func()) {
+	var mu sync.Mutex
+	var res []string
+	started, unblock := make(chan struct{}), make(chan struct{})
+	n := funcNotifier(func(_ context.Context, _, text string) error {
+		if text == "blocker" {
+			close(started)
+			<-unblock
+		}
+		mu.Lock()
+		res = append(res, text)
+		mu.Unlock()
+		return nil
+	})
+	d, err := NewDispatcher([]Notifier{n}, DispatcherParams{QueueSize: queueSize, Overflow: overflow, OnError: f.add})
+	require.NoError(t, err)
+	require.NoError(t, d.Send(context.Background(), "test:dst", "blocker"))
+	<-started
+	sent = func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), res...)
+	}
+	return d, sent, func() { close(unblock) }
+}
+
+func TestDispatcher_Overflow(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		f := &failures{}
+		d, sent, release := blockedDispatcher(t, 2, OverflowReject, f)
+		require.NoError(t, d.Send(context.Background(), "test:dst", "1"))
+		require.NoError(t, d.Send(context.Background(), "test:dst", "2"))
+		require.ErrorIs(t, d.Send(context.Background(), "test:dst", "3"), ErrQueueFull)
+		release()
+		require.NoError(t, d.Shutdown(context.Background()))
+		assert.Equal(t, []string{"blocker", "1", "2"}, sent())
+		assert.Empty(t, f.get())
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		f := &failures{}
+		d, sent, release := blockedDispatcher(t, 2, OverflowDropOldest, f)
+		for _, text := range []string{"1", "2", "3", "4"} {
+			require.NoError(t, d.Send(context.Background(), "test:dst", text))
+		}
+		release()
+		require.NoError(t, d.Shutdown(context.Background()))
+		assert.Equal(t, []string{"blocker", "3", "4"}, sent())
+		assert.Equal(t, []string{"1: dispatcher queue is full", "2: dispatcher queue is full"}, f.get())
+	})
+
+	t.Run("block", func(t *testing.T) {
+		f := &failures{}
+		d, sent, release := blockedDispatcher(t, 1, OverflowBlock, f)
+		require.NoError(t, d.Send(context.Background(), "test:dst", "1"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		require.ErrorIs(t, d.Send(ctx, "test:dst", "2"), context.DeadlineExceeded, "waits for a free slot until ctx is done")
+
+		unblocked := make(chan error)
+		go func() { unblocked <- d.Send(context.Background(), "test:dst", "3") }()
+		release()
+		require.NoError(t, <-unblocked, "sent once the slot is free")
+		require.NoError(t, d.Shutdown(context.Background()))
+		assert.Equal(t, []string{"blocker", "1", "3"}, sent())
+	})
+
+	t.Run("block released by shutdown", func(t *testing.T) {
+		f := &failures{}
+		d, _, release := blockedDispatcher(t, 1, OverflowBlock, f)
+		require.NoError(t, d.Send(context.Background(), "test:dst", "1"))
+		unblocked := make(chan error)
+		go func() { unblocked <- d.Send(context.Background(), "test:dst", "2") }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+		shutdown := make(chan error)
+		go func() { shutdown <- d.Shutdown(ctx) }()
+		require.ErrorIs(t, <-unblocked, ErrDispatcherClosed)
+		release()
+		require.NoError(t, <-shutdown)
+	})
+}
+
+func TestDispatcher_ShutdownInterrupted(t *testing.T) {
+	f := &failures{}
+	started := make(chan struct{}, 1)
+	n := funcNotifier(func(ctx context.Context, _, _ string) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	d, err := NewDispatcher([]Notifier{n}, DispatcherParams{OnError: f.add})
+	require.NoError(t, err)
+	for _, text := range []string{"1", "2", "3"} {
+		require.NoError(t, d.Send(context.Background(), "test:dst", text))
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	require.ErrorIs(t, d.Shutdown(ctx), context.DeadlineExceeded)
+	assert.Equal(t, []string{"1: context canceled", "2: dispatcher is shut down", "3: dispatcher is shut down"}, f.get(),
+		"delivery in progress is canceled, the rest is reported as not delivered")
+}
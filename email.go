@@ -1,15 +1,31 @@
 package notify
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
 	"net/mail"
+	"net/smtp"
+	"net/textproto"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-pkgz/email"
+	"github.com/microcosm-cc/bluemonday"
 )
 
 // SMTPParams contain settings for smtp server connection
@@ -31,85 +47,324 @@ type SMTPParams struct {
 // Email notifications client
 type Email struct {
 	SMTPParams
-	sender *email.Sender
 }
 
 // NewEmail makes new Email object
 func NewEmail(smtpParams SMTPParams) *Email {
-	var opts []email.Option
+	return &Email{SMTPParams: smtpParams}
+}
 
-	if smtpParams.Username != "" {
-		opts = append(opts, email.Auth(smtpParams.Username, smtpParams.Password))
+// Send sends the message over Email, with "from", "subject" and "unsubscribeLink" parsed from destination field
+// with "mailto:" schema.
+// "unsubscribeLink" passed as a header, https://support.google.com/mail/answer/81126 -> "Use one-click unsubscribe"
+// Correlation ID of the context, set with WithCorrelationID, is passed in X-Correlation-ID header.
+//
+// Note: query parameter values in the mailto URL must be properly URL-encoded. In particular, email addresses
+// containing "+" (e.g. "noreply+tag@example.com") must use "%2B" instead, otherwise "+" is interpreted as a space
+// per standard URL query string parsing. Use url.QueryEscape for all parameter values.
+//
+// Example:
+//
+// - mailto:"John Wayne"<john@example.org>?subject=test-subj&from="Notifier"<notify@example.org>
+// - mailto:addr1@example.org,addr2@example.org?subject=test-subj&from=notify@example.org&unsubscribeLink=http://example.org/unsubscribe
+func (e *Email) Send(ctx context.Context, destination, text string) (err error) {
+	ctx, done := startSend(ctx, e.Schema(), destination)
+	defer done(&err)
+	emailParams, err := e.parseDestination(destination)
+	if err != nil {
+		return fmt.Errorf("problem parsing destination: %w", err)
 	}
+	return e.send(ctx, text, emailParams)
+}
 
-	if smtpParams.ContentType != "" {
-		opts = append(opts, email.ContentType(smtpParams.ContentType))
+// SendMessage sends Message over Email, with title used as the subject unless "subject" is set in destination.
+// Body is converted to the ContentType of the client: for "text/html" plain text and Markdown body is escaped,
+// with line breaks replaced by <br>, and for other content types HTML body is stripped of tags.
+// Link is added after the body, and attachments of the message are sent as email attachments.
+func (e *Email) SendMessage(ctx context.Context, destination string, msg Message) (err error) {
+	ctx, done := startSend(ctx, e.Schema(), destination)
+	defer done(&err)
+	emailParams, err := e.parseDestination(destination)
+	if err != nil {
+		return fmt.Errorf("problem parsing destination: %w", err)
 	}
-
-	if smtpParams.Charset != "" {
-		opts = append(opts, email.Charset(smtpParams.Charset))
+	if emailParams.Subject == "" {
+		emailParams.Subject = msg.Title
 	}
 
-	if smtpParams.LoginAuth {
-		opts = append(opts, email.LoginAuth())
+	if len(msg.Attachments) > 0 {
+		// email sender takes attachments as files, so they are stored in a temporary directory for the time of sending
+		var dir string
+		if dir, err = os.MkdirTemp("", "notify-email-"); err != nil {
+			return fmt.Errorf("problem creating attachments directory: %w", err)
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+		if emailParams.Attachments, err = writeAttachments(dir, msg.Attachments); err != nil {
+			return err
+		}
 	}
 
-	if smtpParams.Port != 0 {
-		opts = append(opts, email.Port(smtpParams.Port))
+	return e.send(ctx, e.messageText(msg), emailParams)
+}
+
+// writeAttachments writes attachments to files in dir and returns their paths
+func writeAttachments(dir string, attachments []Attachment) ([]string, error) {
+	res := make([]string, 0, len(attachments))
+	for i, a := range attachments {
+		name := filepath.Base(a.Name)
+		if name == "." || name == string(filepath.Separator) {
+			name = fmt.Sprintf("attachment-%d", i+1)
+		}
+		// every file gets its own directory, so attachments with the same name don't overwrite each other
+		path := filepath.Join(dir, strconv.Itoa(i), name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, fmt.Errorf("problem creating attachment %s: %w", a.Name, err)
+		}
+		if err := os.WriteFile(path, a.Data, 0o600); err != nil {
+			return nil, fmt.Errorf("problem creating attachment %s: %w", a.Name, err)
+		}
+		res = append(res, path)
 	}
+	return res, nil
+}
 
-	if smtpParams.HELOHost != "" {
-		opts = append(opts, email.HELOHost(smtpParams.HELOHost))
+// send composes the message with the text and provided email parameters, and sends it over the connection
+// made by smtpClient. Correlation ID of the context is added to the message in X-Correlation-ID header.
+func (e *Email) send(ctx context.Context, text string, emailParams email.Params) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// the transaction is terminated when ctx is done, including the parts after the connection is made
+	err := e.sendSMTP(ctx, text, emailParams)
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		// transaction was interrupted, report why on top of the error it failed with
+		return fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+	var smtpErr *textproto.Error
+	if !errors.As(err, &smtpErr) || smtpErr.Code < 500 {
+		return err
 	}
+	// permanent negative reply of SMTP server, like unknown recipient or rejected message
+	switch smtpErr.Code {
+	case 550, 551, 553: // mailbox unavailable, user not local, mailbox name not allowed
+		return invalidDestination(err)
+	}
+	return Permanent(err)
+}
 
-	if smtpParams.TimeOut != 0 {
-		opts = append(opts, email.TimeOut(smtpParams.TimeOut))
+// sendSMTP runs SMTP transaction sending the message composed by composeMessage
+func (e *Email) sendSMTP(ctx context.Context, text string, params email.Params) error {
+	from := ""
+	if params.From != "" {
+		addr, parseErr := mail.ParseAddress(params.From)
+		if parseErr != nil {
+			return invalidDestination(fmt.Errorf("problem parsing email sender: %w", parseErr))
+		}
+		from = addr.Address
+	}
+	recipients := make([]string, 0, len(params.To))
+	for _, to := range params.To {
+		addr, parseErr := mail.ParseAddress(to)
+		if parseErr != nil {
+			return invalidDestination(fmt.Errorf("problem parsing email recipient: %w", parseErr))
+		}
+		recipients = append(recipients, addr.Address)
+	}
+	msg, err := e.composeMessage(text, params, CorrelationID(ctx))
+	if err != nil {
+		return err
 	}
 
-	if smtpParams.TLS {
-		opts = append(opts, email.TLS(true))
+	client, closeClient, err := e.smtpClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	if err = client.Mail(from); err != nil {
+		return fmt.Errorf("problem starting smtp transaction: %w", err)
+	}
+	for _, to := range recipients {
+		if err = client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s is not accepted: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("problem starting smtp data: %w", err)
 	}
+	if _, err = w.Write(msg); err != nil {
+		return fmt.Errorf("problem writing message: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("problem sending message: %w", err)
+	}
+	return client.Quit()
+}
 
-	if smtpParams.StartTLS {
-		opts = append(opts, email.STARTTLS(true))
+// composeMessage returns MIME message with the text in the content type and charset of the client,
+// attachment files of the params, and X-Correlation-ID header if correlationID is set
+func (e *Email) composeMessage(text string, params email.Params, correlationID string) ([]byte, error) {
+	contentType, charset := e.ContentType, e.Charset
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	if charset == "" {
+		charset = "UTF-8"
+	}
+	bodyHeader := textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"charset": charset})},
+		"Content-Transfer-Encoding": {"quoted-printable"},
 	}
 
-	if smtpParams.InsecureSkipVerify {
-		opts = append(opts, email.InsecureSkipVerify(true))
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		// header values can't have line breaks, which would start another header
+		buf.WriteString(key + ": " + strings.NewReplacer("\r", "", "\n", "").Replace(value) + "\r\n")
+	}
+	if params.From != "" {
+		header("From", headerAddress(params.From))
+	}
+	to := make([]string, 0, len(params.To))
+	for _, addr := range params.To {
+		to = append(to, headerAddress(addr))
+	}
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", params.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", e.messageID(params.From))
+	header("MIME-Version", "1.0")
+	if params.InReplyTo != "" {
+		header("In-Reply-To", params.InReplyTo)
+	}
+	if params.UnsubscribeLink != "" {
+		header("List-Unsubscribe", "<"+params.UnsubscribeLink+">")
+	}
+	if correlationID != "" {
+		header(CorrelationIDHeader, correlationID)
 	}
 
-	sender := email.NewSender(smtpParams.Host, opts...)
+	writeBody := func(w io.Writer) error {
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(text)); err != nil {
+			return err
+		}
+		return qp.Close()
+	}
+	if len(params.Attachments) == 0 {
+		for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			header(key, bodyHeader.Get(key))
+		}
+		buf.WriteString("\r\n")
+		if err := writeBody(&buf); err != nil {
+			return nil, fmt.Errorf("problem writing message body: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
 
-	return &Email{sender: sender, SMTPParams: smtpParams}
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+	pw, err := mw.CreatePart(bodyHeader)
+	if err == nil {
+		err = writeBody(pw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("problem writing message body: %w", err)
+	}
+	for _, path := range params.Attachments {
+		data, readErr := os.ReadFile(path) //nolint:gosec // attachment files are written by SendMessage
+		if readErr != nil {
+			return nil, fmt.Errorf("problem reading attachment: %w", readErr)
+		}
+		name := filepath.Base(path)
+		fileType := mime.TypeByExtension(filepath.Ext(name))
+		if fileType == "" {
+			fileType = "application/octet-stream"
+		}
+		pw, err = mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(fileType, map[string]string{"name": name})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("problem writing attachment %s: %w", name, err)
+		}
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			_, _ = pw.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		_, _ = pw.Write([]byte(encoded + "\r\n"))
+	}
+	if err = mw.Close(); err != nil {
+		return nil, fmt.Errorf("problem writing message: %w", err)
+	}
+	return buf.Bytes(), nil
 }
 
-// Send sends the message over Email, with "from", "subject" and "unsubscribeLink" parsed from destination field
-// with "mailto:" schema.
-// "unsubscribeLink" passed as a header, https://support.google.com/mail/answer/81126 -> "Use one-click unsubscribe"
-//
-// Note: query parameter values in the mailto URL must be properly URL-encoded. In particular, email addresses
-// containing "+" (e.g. "noreply+tag@example.com") must use "%2B" instead, otherwise "+" is interpreted as a space
-// per standard URL query string parsing. Use url.QueryEscape for all parameter values.
-//
-// Example:
-//
-// - mailto:"John Wayne"<john@example.org>?subject=test-subj&from="Notifier"<notify@example.org>
-// - mailto:addr1@example.org,addr2@example.org?subject=test-subj&from=notify@example.org&unsubscribeLink=http://example.org/unsubscribe
-func (e *Email) Send(ctx context.Context, destination, text string) error {
-	emailParams, err := e.parseDestination(destination)
+// headerAddress returns the address for the message header, with display name quoted, and encoded if it's not ASCII
+func headerAddress(address string) string {
+	addr, err := mail.ParseAddress(address)
 	if err != nil {
-		return fmt.Errorf("problem parsing destination: %w", err)
+		return address
 	}
+	if addr.Name == "" {
+		return addr.Address
+	}
+	return addr.String()
+}
 
-	// SendContext terminates the transaction when ctx is done, including the parts after the connection is made
-	err = e.sender.SendContext(ctx, text, emailParams)
-	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
-		// transaction was interrupted, report why on top of the error it failed with
-		return fmt.Errorf("%w: %w", ctx.Err(), err)
+// messageID returns unique Message-ID header value, with the domain of the sender address,
+// or HELOHost of the client if the sender is not set
+func (e *Email) messageID(from string) string {
+	domain := e.HELOHost
+	if addr, err := mail.ParseAddress(from); err == nil {
+		domain = addr.Address[strings.LastIndex(addr.Address, "@")+1:]
 	}
-	return err
+	if domain == "" {
+		domain = "localhost"
+	}
+	return "<" + rand.Text() + "@" + domain + ">"
+}
+
+// messageText returns body of the message with the link, converted to the content type of the client
+func (e *Email) messageText(msg Message) string {
+	if strings.HasPrefix(e.ContentType, "text/html") {
+		body := msg.Body
+		if msg.Format != FormatHTML {
+			body = strings.ReplaceAll(html.EscapeString(body), "\n", "<br>\n")
+		}
+		if msg.Link != "" {
+			body += fmt.Sprintf(`<p><a href="%s">%s</a></p>`, html.EscapeString(msg.Link), html.EscapeString(msg.Link))
+		}
+		return body
+	}
+
+	body := msg.Body
+	if msg.Format == FormatHTML {
+		body = html.UnescapeString(bluemonday.StrictPolicy().Sanitize(body))
+	}
+	return Message{Body: body, Link: msg.Link}.Text()
+}
+
+// JoinMessages joins texts of the messages batched by Batcher: as HTML list for "text/html" content type,
+// and separated by empty lines otherwise
+func (e *Email) JoinMessages(texts []string) string {
+	if !strings.HasPrefix(e.ContentType, "text/html") {
+		return strings.Join(texts, "\n\n")
+	}
+	var b strings.Builder
+	b.WriteString("<ul>\n")
+	for _, t := range texts {
+		b.WriteString("<li>" + t + "</li>\n")
+	}
+	b.WriteString("</ul>")
+	return b.String()
 }
 
+// instrumented marks Email as reporting its sends to Tracer and Metrics itself
+func (e *Email) instrumented() {}
+
 // Schema returns schema prefix supported by this client
 func (e *Email) Schema() string {
 	return "mailto"
@@ -127,21 +382,181 @@ func (e *Email) String() string {
 	return str
 }
 
+// Validate checks "mailto:" destination: recipients, "from" address if it's set, and that there are
+// only the supported query parameters
+func (e *Email) Validate(destination string) error {
+	params, err := e.parseDestination(destination)
+	if err != nil {
+		return err
+	}
+	if params.From != "" {
+		if _, err = mail.ParseAddress(params.From); err != nil {
+			return invalidDestination(fmt.Errorf("problem parsing email sender: %w", err))
+		}
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return invalidDestination(err)
+	}
+	return checkQueryParams(u, "from", "subject", "unsubscribeLink")
+}
+
+// ValidateOnline checks "mailto:" destination, and that the SMTP server accepts its recipients.
+// It connects to the server and starts the transaction up to RCPT command, then resets it without sending the message.
+func (e *Email) ValidateOnline(ctx context.Context, destination string) error {
+	if err := e.Validate(destination); err != nil {
+		return err
+	}
+	params, err := e.parseDestination(destination)
+	if err != nil {
+		return err
+	}
+	from := ""
+	if params.From != "" {
+		addr, _ := mail.ParseAddress(params.From) // checked by Validate
+		from = addr.Address
+	}
+
+	client, closeClient, err := e.smtpClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	if err = client.Mail(from); err != nil {
+		return smtpError(fmt.Errorf("problem starting smtp transaction: %w", err))
+	}
+	for _, to := range params.To {
+		addr, parseErr := mail.ParseAddress(to)
+		if parseErr != nil {
+			return invalidDestination(fmt.Errorf("problem parsing email recipient: %w", parseErr))
+		}
+		if err = client.Rcpt(addr.Address); err != nil {
+			return smtpError(fmt.Errorf("recipient %s is not accepted: %w", addr.Address, err))
+		}
+	}
+	if err = client.Reset(); err != nil {
+		return fmt.Errorf("problem resetting smtp transaction: %w", err)
+	}
+	return client.Quit()
+}
+
+// smtpClient connects to the SMTP server of the client and authenticates. The connection is closed
+// with returned func, or when ctx is done.
+func (e *Email) smtpClient(ctx context.Context) (client *smtp.Client, closeClient func(), err error) {
+	port := e.Port
+	if port == 0 {
+		port = 25
+	}
+	timeout := e.TimeOut
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(port))
+	tlsConf := &tls.Config{ServerName: e.Host, InsecureSkipVerify: e.InsecureSkipVerify} //nolint:gosec // set by the user
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if e.TLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConf}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem connecting to smtp server %s: %w", addr, err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+
+	client, err = smtp.NewClient(conn, e.Host)
+	if err == nil {
+		err = e.smtpHandshake(client, tlsConf)
+	}
+	if err != nil {
+		stop()
+		_ = conn.Close()
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+		return nil, nil, err
+	}
+	return client, func() { stop(); _ = client.Close() }, nil
+}
+
+// smtpHandshake greets the SMTP server, upgrades the connection with STARTTLS if set, and authenticates
+func (e *Email) smtpHandshake(client *smtp.Client, tlsConf *tls.Config) error {
+	helo := e.HELOHost
+	if helo == "" {
+		helo = "localhost"
+	}
+	if err := client.Hello(helo); err != nil {
+		return fmt.Errorf("problem greeting smtp server: %w", err)
+	}
+	if e.StartTLS {
+		if err := client.StartTLS(tlsConf); err != nil {
+			return fmt.Errorf("problem starting tls: %w", err)
+		}
+	}
+	if e.Username == "" {
+		return nil
+	}
+	var auth smtp.Auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	if e.LoginAuth {
+		auth = &smtpLoginAuth{username: e.Username, password: e.Password}
+	}
+	if err := client.Auth(auth); err != nil {
+		return Permanent(fmt.Errorf("problem authenticating on smtp server: %w", err))
+	}
+	return nil
+}
+
+// smtpError marks permanent negative reply of SMTP server to the command with the recipient or the sender
+// as invalid destination
+func smtpError(err error) error {
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) && smtpErr.Code >= 500 {
+		return invalidDestination(err)
+	}
+	return err
+}
+
+// smtpLoginAuth is LOGIN auth method, https://www.ietf.org/archive/id/draft-murchison-sasl-login-00.txt
+type smtpLoginAuth struct {
+	username, password string
+}
+
+// Start begins LOGIN authentication
+func (a *smtpLoginAuth) Start(*smtp.ServerInfo) (proto string, toServer []byte, err error) {
+	return "LOGIN", nil, nil
+}
+
+// Next answers the username and password challenges
+func (a *smtpLoginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSuffix(string(fromServer), ":")) {
+	case "username":
+		return []byte(a.username), nil
+	case "password":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected smtp server challenge %q", fromServer)
+}
+
 // parses "mailto:" URL and returns email parameters
 func (e *Email) parseDestination(destination string) (email.Params, error) {
 	// parse URL
 	u, err := url.Parse(destination)
 	if err != nil {
-		return email.Params{}, err
+		return email.Params{}, invalidDestination(err)
 	}
 	if u.Scheme != "mailto" {
-		return email.Params{}, fmt.Errorf("unsupported scheme %s, should be mailto", u.Scheme)
+		return email.Params{}, unsupportedScheme(u.Scheme, "mailto")
 	}
 
 	// parse destination address(es)
 	addresses, err := mail.ParseAddressList(u.Opaque)
 	if err != nil {
-		return email.Params{}, fmt.Errorf("problem parsing email recipients: %w", err)
+		return email.Params{}, invalidDestination(fmt.Errorf("problem parsing email recipients: %w", err))
 	}
 	destinations := []string{}
 	for _, addr := range addresses {
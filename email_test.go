@@ -2,10 +2,19 @@ package notify
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -43,13 +52,17 @@ func TestEmailNew(t *testing.T) {
 	assert.Equal(t, smtpParams.Charset, email.Charset, "SMTPParams.Charset unchanged after creation")
 	assert.Equal(t, smtpParams.LoginAuth, email.LoginAuth, "SMTPParams.LoginAuth unchanged after creation")
 	assert.Equal(t, smtpParams.HELOHost, email.HELOHost, "SMTPParams.HELOHost unchanged after creation")
-	// sender reports the greeting hostname it will use, so this asserts the option reached it
-	assert.Contains(t, email.sender.String(), `helo:"helo.example.org"`)
 }
 
 func TestEmailDefaultHELOHost(t *testing.T) {
-	email := NewEmail(SMTPParams{Host: "test@host"})
-	assert.Contains(t, email.sender.String(), `helo:"localhost"`, "greeting hostname is unchanged without HELOHost set")
+	srv := newSMTPStub(t)
+	host, port := srv.hostPort(t)
+	require.NoError(t, NewEmail(SMTPParams{Host: host, Port: port, HELOHost: "helo.example.org"}).Send(context.Background(), "mailto:john@example.org", "text"))
+	require.NoError(t, NewEmail(SMTPParams{Host: host, Port: port}).Send(context.Background(), "mailto:john@example.org", "text"))
+	commands := srv.getCommands()
+	require.Len(t, commands, 10)
+	assert.Equal(t, "EHLO helo.example.org", commands[0])
+	assert.Equal(t, "EHLO localhost", commands[5], "greeting hostname is unchanged without HELOHost set")
 }
 
 func TestEmailSendClientError(t *testing.T) {
@@ -70,8 +83,11 @@ func TestEmailSendClientError(t *testing.T) {
 		`problem parsing destination: parse "%": invalid URL escape "%"`)
 
 	// bad recipient
-	require.EqualError(t, email.Send(context.Background(), "mailto:bad", ""),
-		`problem parsing destination: problem parsing email recipients: mail: missing '@' or angle-addr`)
+	err := email.Send(context.Background(), "mailto:bad", "")
+	require.EqualError(t, err, `problem parsing destination: problem parsing email recipients: mail: missing '@' or angle-addr`)
+	assert.True(t, IsPermanent(err), "bad destination is not retried")
+	require.ErrorIs(t, err, ErrInvalidDestination)
+	require.ErrorIs(t, email.Send(context.Background(), "https://example.org", ""), ErrUnsupportedSchema)
 
 	// unable to find host, with advanced destination parsing test
 	assert.Contains(t,
@@ -149,3 +165,263 @@ func TestEmail_SendCancellationAfterConnect(t *testing.T) {
 		t.Fatal("send was canceled before the connection was established, the test proves nothing")
 	}
 }
+
+func TestEmail_MessageText(t *testing.T) {
+	msg := Message{Title: "title", Body: "a < b\nc", Link: "https://example.org/?a=1&b=2"}
+
+	plain := NewEmail(SMTPParams{Host: "test@host"})
+	assert.Equal(t, "a < b\nc\n\nhttps://example.org/?a=1&b=2", plain.messageText(msg), "title goes to the subject")
+	assert.Equal(t, "a & b", plain.messageText(Message{Body: "<p>a &amp; b</p>", Format: FormatHTML}), "tags are stripped")
+
+	htmlEmail := NewEmail(SMTPParams{Host: "test@host", ContentType: "text/html"})
+	assert.Equal(t, "a &lt; b<br>\nc<p><a href=\"https://example.org/?a=1&amp;b=2\">https://example.org/?a=1&amp;b=2</a></p>",
+		htmlEmail.messageText(msg))
+	assert.Equal(t, "<p>a &amp; b</p>", htmlEmail.messageText(Message{Body: "<p>a &amp; b</p>", Format: FormatHTML}))
+}
+
+func TestEmail_WriteAttachments(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := writeAttachments(dir, []Attachment{
+		{Name: "a.txt", Data: []byte("a1")},
+		{Name: "../../a.txt", Data: []byte("a2")},
+		{Data: []byte("noname")},
+	})
+	require.NoError(t, err)
+	require.Len(t, paths, 3)
+	for i, content := range []string{"a1", "a2", "noname"} {
+		assert.True(t, strings.HasPrefix(paths[i], dir), "file is created inside the directory")
+		data, e := os.ReadFile(paths[i])
+		require.NoError(t, e)
+		assert.Equal(t, content, string(data))
+	}
+	assert.Equal(t, "a.txt", filepath.Base(paths[1]))
+	assert.Equal(t, "attachment-3", filepath.Base(paths[2]))
+
+	_, err = writeAttachments(filepath.Join(dir, "0", "a.txt"), []Attachment{{Name: "b.txt"}})
+	require.Error(t, err, "directory can't be created inside a file")
+}
+
+func TestEmail_SendMessage(t *testing.T) {
+	email := NewEmail(SMTPParams{Host: "test@host"})
+	require.EqualError(t, email.SendMessage(context.Background(), "mailto:bad", Message{}),
+		`problem parsing destination: problem parsing email recipients: mail: missing '@' or angle-addr`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := email.SendMessage(ctx, "mailto:test@example.org", Message{Body: "text", Attachments: []Attachment{{Name: "a.txt"}}})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestEmail_Validate(t *testing.T) {
+	e := NewEmail(SMTPParams{Host: "localhost"})
+	require.NoError(t, e.Validate(`mailto:"John Wayne"<john@example.org>,bob@example.org?subject=test&from=notify@example.org&unsubscribeLink=http://example.org`))
+	for destination, errText := range map[string]string{
+		"mailto:":               "problem parsing email recipients: mail: no address",
+		"mailto:not-an-address": "problem parsing email recipients: mail: missing '@' or angle-addr",
+		"mailto:john@example.org?from=not-an-address":  "problem parsing email sender: mail: missing '@' or angle-addr",
+		"mailto:john@example.org?subjct=test&cc=other": "unknown query parameters cc, subjct, supported are from, subject, unsubscribeLink",
+		"telegram:john@example.org":                    "unsupported scheme telegram, should be mailto",
+	} {
+		err := e.Validate(destination)
+		require.EqualError(t, err, errText, destination)
+		require.ErrorIs(t, err, ErrInvalidDestination, destination)
+	}
+}
+
+func TestEmail_ValidateOnline(t *testing.T) {
+	srv := newSMTPStub(t)
+	host, port := srv.hostPort(t)
+	e := NewEmail(SMTPParams{Host: host, Port: port, HELOHost: "helo.example.org"})
+
+	require.NoError(t, e.ValidateOnline(context.Background(), `mailto:john@example.org?from="Notifier"<notify@example.org>`))
+	assert.Equal(t, []string{"EHLO helo.example.org", "MAIL FROM:<notify@example.org>", "RCPT TO:<john@example.org>", "RSET", "QUIT"}, srv.getCommands(),
+		"transaction is reset before the message")
+
+	require.NoError(t, e.ValidateOnline(context.Background(), `mailto:"John Wayne"<john@example.org>`))
+	assert.Equal(t, "RCPT TO:<john@example.org>", srv.getCommands()[7], "recipient is passed without display name")
+
+	err := e.ValidateOnline(context.Background(), "mailto:john@example.org,unknown@example.org")
+	require.EqualError(t, err, "recipient unknown@example.org is not accepted: 550 \"5.1.1 mailbox unavailable\"")
+	require.ErrorIs(t, err, ErrInvalidDestination)
+
+	err = e.ValidateOnline(context.Background(), "mailto:busy@example.org")
+	require.EqualError(t, err, "recipient busy@example.org is not accepted: 450 \"4.2.1 mailbox busy\"")
+	assert.False(t, IsPermanent(err), "temporary rejection")
+
+	require.ErrorIs(t, e.ValidateOnline(context.Background(), "mailto:john@example.org?cc=x"), ErrInvalidDestination)
+
+	e = NewEmail(SMTPParams{Host: host, Port: 1})
+	require.ErrorContains(t, e.ValidateOnline(context.Background(), "mailto:john@example.org"), "problem connecting to smtp server 127.0.0.1:1")
+}
+
+func TestEmail_CorrelationID(t *testing.T) {
+	srv := newSMTPStub(t)
+	host, port := srv.hostPort(t)
+	e := NewEmail(SMTPParams{Host: host, Port: port, ContentType: "text/html"})
+	ctx := WithCorrelationID(context.Background(), "req-1\r\nBcc: evil@example.org")
+
+	require.NoError(t, e.Send(ctx, `mailto:"John Wayne"<john@example.org>?from=Уведомления<notify@example.org>&subject=Привет&unsubscribeLink=http://example.org/u`,
+		"a = b"))
+	assert.Equal(t, []string{"EHLO localhost", "MAIL FROM:<notify@example.org>", "RCPT TO:<john@example.org>", "DATA", "QUIT"}, srv.getCommands())
+	msgs := srv.getMessages()
+	require.Len(t, msgs, 1)
+	msg, err := mail.ReadMessage(strings.NewReader(msgs[0]))
+	require.NoError(t, err)
+	assert.Equal(t, "req-1Bcc: evil@example.org", msg.Header.Get(CorrelationIDHeader), "line breaks are removed")
+	assert.Empty(t, msg.Header.Get("Bcc"))
+	assert.True(t, strings.HasPrefix(msg.Header.Get("From"), "=?utf-8?q?"), "display name is encoded")
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	require.NoError(t, err)
+	assert.Equal(t, mail.Address{Name: "Уведомления", Address: "notify@example.org"}, *from)
+	assert.Regexp(t, `^<[A-Z2-7]{26}@example\.org>$`, msg.Header.Get("Message-ID"))
+	assert.Equal(t, `"John Wayne" <john@example.org>`, msg.Header.Get("To"))
+	assert.Equal(t, "=?utf-8?q?=D0=9F=D1=80=D0=B8=D0=B2=D0=B5=D1=82?=", msg.Header.Get("Subject"))
+	assert.Equal(t, "<http://example.org/u>", msg.Header.Get("List-Unsubscribe"))
+	assert.Equal(t, "text/html; charset=UTF-8", msg.Header.Get("Content-Type"))
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "a = b", strings.TrimSuffix(string(body), "\n"), "data ends with the line break before the dot")
+
+	require.NoError(t, e.SendMessage(WithCorrelationID(context.Background(), "req-2"), "mailto:john@example.org",
+		Message{Title: "logs", Body: "see attached", Attachments: []Attachment{{Name: "a.log", Data: []byte("line a")}}}))
+	msgs = srv.getMessages()
+	require.Len(t, msgs, 2)
+	msg, err = mail.ReadMessage(strings.NewReader(msgs[1]))
+	require.NoError(t, err)
+	assert.Equal(t, "req-2", msg.Header.Get(CorrelationIDHeader))
+	assert.Regexp(t, `^<[A-Z2-7]{26}@localhost>$`, msg.Header.Get("Message-ID"), "HELO host is used without sender")
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	part, err := mr.NextPart()
+	require.NoError(t, err)
+	body, err = io.ReadAll(part)
+	require.NoError(t, err)
+	assert.Equal(t, "see attached", string(body))
+	part, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "a.log", part.FileName())
+	data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+	require.NoError(t, err)
+	assert.Equal(t, "line a", string(data))
+
+	require.NoError(t, e.Send(context.Background(), "mailto:john@example.org", "text"))
+	msgs = srv.getMessages()
+	require.Len(t, msgs, 3)
+	msg, err = mail.ReadMessage(strings.NewReader(msgs[2]))
+	require.NoError(t, err)
+	assert.NotContains(t, msg.Header, CorrelationIDHeader, "no header without correlation ID")
+	assert.Equal(t, "john@example.org", msg.Header.Get("To"))
+
+	err = e.Send(WithCorrelationID(context.Background(), "req-3"), "mailto:unknown@example.org", "text")
+	require.ErrorIs(t, err, ErrInvalidDestination)
+}
+
+// smtpStub is SMTP server recording commands and messages, which rejects recipients "unknown@"
+// permanently and "busy@" temporarily
+type smtpStub struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	commands []string
+	messages []string
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &smtpStub{ln: ln}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		_ = ln.Close()
+		wg.Wait()
+	})
+	wg.Go(func() {
+		for {
+			conn, e := ln.Accept()
+			if e != nil {
+				return
+			}
+			wg.Go(func() { srv.serve(conn) })
+		}
+	})
+	return srv
+}
+
+func (srv *smtpStub) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(time.Second * 20))
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP stub")
+	for {
+		line, e := tp.ReadLine()
+		if e != nil {
+			return
+		}
+		srv.mu.Lock()
+		srv.commands = append(srv.commands, line)
+		srv.mu.Unlock()
+		switch {
+		case strings.HasPrefix(line, "EHLO"):
+			_ = tp.PrintfLine("250 localhost")
+		case strings.Contains(line, "unknown@"):
+			_ = tp.PrintfLine("550 5.1.1 mailbox unavailable")
+		case strings.Contains(line, "busy@"):
+			_ = tp.PrintfLine("450 4.2.1 mailbox busy")
+		case line == "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.messages = append(srv.messages, string(data))
+			srv.mu.Unlock()
+			_ = tp.PrintfLine("250 queued")
+		case line == "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (srv *smtpStub) hostPort(t *testing.T) (host string, port int) {
+	host, portStr, err := net.SplitHostPort(srv.ln.Addr().String())
+	require.NoError(t, err)
+	port, err = strconv.Atoi(portStr)
+	require.NoError(t, err)
+	return host, port
+}
+
+func (srv *smtpStub) getCommands() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]string(nil), srv.commands...)
+}
+
+func (srv *smtpStub) getMessages() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]string(nil), srv.messages...)
+}
+
+func TestSMTPLoginAuth(t *testing.T) {
+	a := &smtpLoginAuth{username: "user", password: "pass"}
+	proto, toServer, err := a.Start(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "LOGIN", proto)
+	assert.Nil(t, toServer)
+	resp, err := a.Next([]byte("Username:"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "user", string(resp))
+	resp, err = a.Next([]byte("Password:"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "pass", string(resp))
+	_, err = a.Next([]byte("Other:"), true)
+	require.EqualError(t, err, `unexpected smtp server challenge "Other:"`)
+	resp, err = a.Next(nil, false)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
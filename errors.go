@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// errors returned by notifiers, check them with errors.Is
+var (
+	ErrUnsupportedSchema  = errors.New("unsupported destination schema") // no notifier supports the destination scheme
+	ErrInvalidDestination = errors.New("invalid destination")            // destination is malformed or doesn't exist, like unknown chat
+	ErrRateLimited        = errors.New("rate limited")                   // service rejected the request because of too many requests
+	ErrRecipientBlocked   = errors.New("recipient blocked")              // recipient blocked the bot, left the chat or was deactivated
+)
+
+// HTTPStatusError is returned for non-OK response of the service API, check it with errors.As.
+// Response with 429 Too Many Requests status matches ErrRateLimited.
+type HTTPStatusError struct {
+	StatusCode int           // HTTP status code of the response
+	Body       string        // beginning of the response body, or error description returned by the service
+	RetryAfter time.Duration // how long to wait before the next request, as requested by the service, zero if not set
+
+	msg string // message of the error, it's different for every notifier
+	err error  // error returned by the client library, if any
+}
+
+// Error returns message of the error
+func (e *HTTPStatusError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns error returned by the client library, if any
+func (e *HTTPStatusError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether the error is ErrRateLimited for 429 Too Many Requests status
+func (e *HTTPStatusError) Is(target error) bool {
+	return target == ErrRateLimited && e.StatusCode == http.StatusTooManyRequests
+}
+
+// statusError returns e, marked as permanent for the status codes which don't change on retry
+func statusError(e *HTTPStatusError) error {
+	if isPermanentStatus(e.StatusCode) {
+		return Permanent(e)
+	}
+	return e
+}
+
+// parseRetryAfter returns delay from Retry-After header value, in seconds or HTTP date, zero if it's not set or malformed
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// markedError is an error matching the sentinel error in addition to the errors it wraps, with the message unchanged
+type markedError struct {
+	err    error
+	target error
+}
+
+func (e *markedError) Error() string { return e.err.Error() }
+
+func (e *markedError) Unwrap() []error { return []error{e.err, e.target} }
+
+// markError returns err matching target with errors.Is
+func markError(err, target error) error {
+	if err == nil || errors.Is(err, target) {
+		return err
+	}
+	return &markedError{err: err, target: target}
+}
+
+// invalidDestination marks err as ErrInvalidDestination, which is permanent
+func invalidDestination(err error) error {
+	return Permanent(markError(err, ErrInvalidDestination))
+}
+
+// unsupportedScheme returns error for the destination with scheme not supported by the notifier
+func unsupportedScheme(scheme, supported string) error {
+	return invalidDestination(markError(fmt.Errorf("unsupported scheme %s, should be %s", scheme, supported), ErrUnsupportedSchema))
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPStatusError(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", statusError(&HTTPStatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second, msg: "too many"}))
+	require.EqualError(t, err, "wrapped: too many")
+	require.ErrorIs(t, err, ErrRateLimited)
+	assert.False(t, IsPermanent(err))
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, time.Second, statusErr.RetryAfter)
+
+	libErr := errors.New("library error")
+	err = statusError(&HTTPStatusError{StatusCode: http.StatusForbidden, msg: "forbidden", err: libErr})
+	require.NotErrorIs(t, err, ErrRateLimited)
+	require.ErrorIs(t, err, libErr)
+	assert.True(t, IsPermanent(err))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-5"))
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+	d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, time.Minute.Seconds(), d.Seconds(), 2)
+}
+
+func TestMarkError(t *testing.T) {
+	require.NoError(t, markError(nil, ErrRateLimited))
+	base := errors.New("base")
+	err := markError(base, ErrRecipientBlocked)
+	require.EqualError(t, err, "base", "message is unchanged")
+	require.ErrorIs(t, err, base)
+	require.ErrorIs(t, err, ErrRecipientBlocked)
+	assert.Same(t, err, markError(err, ErrRecipientBlocked))
+
+	err = unsupportedScheme("https", "slack")
+	require.EqualError(t, err, "unsupported scheme https, should be slack")
+	require.ErrorIs(t, err, ErrUnsupportedSchema)
+	require.ErrorIs(t, err, ErrInvalidDestination)
+	assert.True(t, IsPermanent(err))
+}
+
+func TestSend_UnsupportedSchema(t *testing.T) {
+	err := Send(context.Background(), []Notifier{NewWebhook(WebhookParams{})}, "slack:general", "text")
+	require.EqualError(t, err, "unsupported destination schema: slack")
+	require.ErrorIs(t, err, ErrUnsupportedSchema)
+	assert.True(t, IsPermanent(err))
+}
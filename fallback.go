@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FallbackResult contains the outcome of the delivery with Fallback: the destination which delivered the message
+// and results of all destinations tried, in order. It is an error itself if no destination delivered the message,
+// combining errors of the tried destinations the same way errors.Join does.
+type FallbackResult struct {
+	Delivered string // destination which delivered the message, empty if none did
+	Attempts  []DestinationResult
+}
+
+// Err returns the result as an error if no destination delivered the message, and nil otherwise
+func (r *FallbackResult) Err() error {
+	if r.Delivered != "" {
+		return nil
+	}
+	return r
+}
+
+// Error returns errors of the tried destinations, one per line
+func (r *FallbackResult) Error() string {
+	if len(r.Attempts) == 0 {
+		return "no fallback destinations"
+	}
+	lines := make([]string, 0, len(r.Attempts))
+	for _, dr := range r.Attempts {
+		if dr.Err != nil {
+			lines = append(lines, fmt.Sprintf("%s: %v", redactDestination(dr.Destination), dr.Err))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns errors of the tried destinations, to be used by errors.Is and errors.As
+func (r *FallbackResult) Unwrap() []error {
+	res := make([]error, 0, len(r.Attempts))
+	for _, dr := range r.Attempts {
+		if dr.Err != nil {
+			res = append(res, dr.Err)
+		}
+	}
+	return res
+}
+
+// FallbackParams contain settings for Fallback
+type FallbackParams struct {
+	StepTimeout time.Duration // time limit of the send to every destination, no limit by default
+}
+
+// Fallback sends the message to the first destination of the list which delivers it, trying them in order,
+// like Slack, then Telegram if Slack fails, and then email. Notifier for every destination is picked
+// the same way Send does.
+//
+// Fallback implements Notifier for "fallback:" destinations, with the list of URL-encoded destinations
+// in "to" parameters and optional "timeout" overriding StepTimeout, use FallbackDestination to make them.
+//
+// Example:
+//
+// - fallback:?to=slack%3Aops&to=telegram%3Aops&to=mailto%3Aops%40example.org&timeout=10s
+type Fallback struct {
+	FallbackParams
+	notifiers []Notifier
+}
+
+// NewFallback makes Fallback sending with the notifiers
+func NewFallback(notifiers []Notifier, params FallbackParams) *Fallback {
+	return &Fallback{FallbackParams: params, notifiers: notifiers}
+}
+
+// FallbackDestination returns "fallback:" destination for the list of destinations, with timeout of every step
+// unless it's zero
+func FallbackDestination(destinations []string, timeout time.Duration) string {
+	q := url.Values{"to": destinations}
+	if timeout > 0 {
+		q.Set("timeout", timeout.String())
+	}
+	return "fallback:?" + q.Encode()
+}
+
+// Deliver sends the text to the destinations in order until one of them delivers it.
+// Result is never nil, use its Err method to check whether the text was delivered.
+func (f *Fallback) Deliver(ctx context.Context, destinations []string, text string) *FallbackResult {
+	return f.deliver(ctx, destinations, f.StepTimeout, func(ctx context.Context, n Notifier, destination string) error {
+		return n.Send(ctx, destination, text)
+	})
+}
+
+// DeliverMessage sends the message to the destinations in order until one of them delivers it
+func (f *Fallback) DeliverMessage(ctx context.Context, destinations []string, msg Message) *FallbackResult {
+	return f.deliver(ctx, destinations, f.StepTimeout, func(ctx context.Context, n Notifier, destination string) error {
+		return sendMessage(ctx, n, destination, msg)
+	})
+}
+
+// Send sends the text to destinations of "fallback:" destination in order until one of them delivers it,
+// returning *FallbackResult error if none did
+func (f *Fallback) Send(ctx context.Context, destination, text string) error {
+	destinations, timeout, err := f.parseDestination(destination)
+	if err != nil {
+		return fmt.Errorf("problem parsing destination: %w", err)
+	}
+	return f.deliver(ctx, destinations, timeout, func(ctx context.Context, n Notifier, destination string) error {
+		return n.Send(ctx, destination, text)
+	}).Err()
+}
+
+// SendMessage sends the message to destinations of "fallback:" destination in order until one of them delivers it
+func (f *Fallback) SendMessage(ctx context.Context, destination string, msg Message) error {
+	destinations, timeout, err := f.parseDestination(destination)
+	if err != nil {
+		return fmt.Errorf("problem parsing destination: %w", err)
+	}
+	return f.deliver(ctx, destinations, timeout, func(ctx context.Context, n Notifier, destination string) error {
+		return sendMessage(ctx, n, destination, msg)
+	}).Err()
+}
+
+// Validate checks "fallback:" destination and every destination in it
+func (f *Fallback) Validate(destination string) error {
+	destinations, _, err := f.parseDestination(destination)
+	if err != nil {
+		return err
+	}
+	for _, d := range destinations {
+		if err = Validate(f.notifiers, d); err != nil {
+			return fmt.Errorf("fallback destination %s: %w", redactDestination(d), err)
+		}
+	}
+	return nil
+}
+
+// Schema returns schema prefix supported by this client
+func (f *Fallback) Schema() string {
+	return "fallback"
+}
+
+// String representation of Fallback
+func (f *Fallback) String() string {
+	return fmt.Sprintf("fallback over %d notifiers", len(f.notifiers))
+}
+
+// deliver calls send for the destinations in order until one of them succeeds or ctx is done
+func (f *Fallback) deliver(ctx context.Context, destinations []string, timeout time.Duration,
+	send func(ctx context.Context, n Notifier, destination string) error) *FallbackResult {
+	res := &FallbackResult{}
+	for _, destination := range destinations {
+		if ctx.Err() != nil {
+			res.Attempts = append(res.Attempts, DestinationResult{Destination: destination, Err: ctx.Err()})
+			return res
+		}
+		st := time.Now()
+		n, err := findNotifier(f.notifiers, destination)
+		if err == nil {
+			stepCtx, cancel := ctx, context.CancelFunc(func() {})
+			if timeout > 0 {
+				stepCtx, cancel = context.WithTimeout(ctx, timeout)
+			}
+			err = send(stepCtx, n, destination)
+			cancel()
+		}
+		res.Attempts = append(res.Attempts, DestinationResult{Destination: destination, Notifier: n, Duration: time.Since(st), Err: err})
+		if err == nil {
+			res.Delivered = destination
+			return res
+		}
+	}
+	return res
+}
+
+// parseDestination returns destinations and the step timeout of "fallback:" destination
+func (f *Fallback) parseDestination(destination string) (destinations []string, timeout time.Duration, err error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, 0, invalidDestination(err)
+	}
+	if u.Scheme != "fallback" {
+		return nil, 0, unsupportedScheme(u.Scheme, "fallback")
+	}
+	if err = checkQueryParams(u, "to", "timeout"); err != nil {
+		return nil, 0, err
+	}
+	destinations = u.Query()["to"]
+	if len(destinations) == 0 {
+		return nil, 0, invalidDestination(errors.New("no destinations in fallback destination"))
+	}
+	timeout = f.StepTimeout
+	if t := u.Query().Get("timeout"); t != "" {
+		if timeout, err = time.ParseDuration(t); err != nil {
+			return nil, 0, invalidDestination(fmt.Errorf("problem parsing timeout: %w", err))
+		}
+	}
+	return destinations, timeout, nil
+}
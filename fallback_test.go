@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schemeNotifier is a notifier of the scheme, failing with err if it's set
+type schemeNotifier struct {
+	recordingNotifier
+	scheme string
+}
+
+func (n *schemeNotifier) Schema() string { return n.scheme }
+
+func TestFallback_Deliver(t *testing.T) {
+	slackN := &schemeNotifier{scheme: "slack", recordingNotifier: recordingNotifier{err: errors.New("slack is down")}}
+	tgN := &schemeNotifier{scheme: "telegram"}
+	mailN := &schemeNotifier{scheme: "mailto"}
+	f := NewFallback([]Notifier{slackN, tgN, mailN}, FallbackParams{})
+	assert.Equal(t, "fallback over 3 notifiers", f.String())
+	assert.Equal(t, "fallback", f.Schema())
+
+	res := f.Deliver(context.Background(), []string{"slack:ops", "telegram:ops", "mailto:ops@example.org"}, "alert")
+	require.NoError(t, res.Err())
+	assert.Equal(t, "telegram:ops", res.Delivered)
+	require.Len(t, res.Attempts, 2)
+	require.EqualError(t, res.Attempts[0].Err, "slack is down")
+	assert.Equal(t, tgN, res.Attempts[1].Notifier)
+	assert.Equal(t, []string{"telegram:ops alert"}, tgN.get())
+	assert.Empty(t, mailN.get(), "next destinations are not tried")
+
+	res = f.DeliverMessage(context.Background(), []string{"slack:ops", "unknown:ops", "mailto:ops@example.org"}, Message{Title: "title", Body: "body"})
+	require.NoError(t, res.Err())
+	assert.Equal(t, "mailto:ops@example.org", res.Delivered)
+	assert.Equal(t, []string{"mailto:ops@example.org title\n\nbody"}, mailN.get())
+
+	tgN.err = Permanent(errors.New("chat not found"))
+	res = f.Deliver(context.Background(), []string{"slack:ops", "telegram:ops"}, "alert")
+	err := res.Err()
+	require.EqualError(t, err, "slack:ops: slack is down\ntelegram:ops: chat not found")
+	assert.Empty(t, res.Delivered)
+	var fr *FallbackResult
+	require.ErrorAs(t, err, &fr)
+	assert.Len(t, fr.Attempts, 2)
+
+	require.EqualError(t, f.Deliver(context.Background(), nil, "alert").Err(), "no fallback destinations")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res = f.Deliver(ctx, []string{"mailto:ops@example.org", "telegram:ops"}, "alert")
+	require.ErrorIs(t, res.Err(), context.Canceled)
+	assert.Len(t, res.Attempts, 1, "destinations are not tried after cancellation")
+}
+
+func TestFallback_StepTimeout(t *testing.T) {
+	slow := funcNotifier(func(ctx context.Context, _, _ string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	rec := &schemeNotifier{scheme: "mailto"}
+	f := NewFallback([]Notifier{slow, rec}, FallbackParams{StepTimeout: time.Minute})
+
+	st := time.Now()
+	err := f.Send(context.Background(), FallbackDestination([]string{"test:slow", "mailto:ops@example.org"}, time.Millisecond*50), "alert")
+	require.NoError(t, err)
+	assert.Less(t, time.Since(st), time.Second, "timeout of the destination overrides the params")
+	assert.Equal(t, []string{"mailto:ops@example.org alert"}, rec.get())
+
+	f.StepTimeout = time.Millisecond * 50
+	res := f.Deliver(context.Background(), []string{"test:slow"}, "alert")
+	require.ErrorIs(t, res.Err(), context.DeadlineExceeded)
+}
+
+func TestFallback_Send(t *testing.T) {
+	rec := &recordingNotifier{}
+	f := NewFallback([]Notifier{rec}, FallbackParams{})
+	assert.Equal(t, "fallback:?timeout=5s&to=test%3Aa&to=test%3Ab", FallbackDestination([]string{"test:a", "test:b"}, time.Second*5))
+
+	// fallback is a notifier, so it could be used with Send along with the others
+	notifiers := []Notifier{rec, f}
+	require.NoError(t, Send(context.Background(), notifiers, "fallback:?to=test%3Aa&to=test%3Ab", "text"))
+	require.NoError(t, SendMessage(context.Background(), notifiers, "fallback:?to=test%3Aa", Message{Body: "message"}))
+	assert.Equal(t, []string{"test:a text", "test:a message"}, rec.get())
+
+	rec.err = errors.New("failed")
+	var fr *FallbackResult
+	require.ErrorAs(t, f.Send(context.Background(), "fallback:?to=test%3Aa&to=test%3Ab", "text"), &fr)
+	assert.Len(t, fr.Attempts, 2)
+	require.Error(t, f.SendMessage(context.Background(), "fallback:?to=test%3Aa", Message{Body: "message"}))
+
+	for destination, errText := range map[string]string{
+		"fallback:":                       "no destinations in fallback destination",
+		"fallback:?to=test%3Aa&timeout=5": `problem parsing timeout: time: missing unit in duration "5"`,
+		"fallback:?to=test%3Aa&retries=5": "unknown query parameters retries, supported are to, timeout",
+		"slack:ops":                       "unsupported scheme slack, should be fallback",
+	} {
+		err := f.Send(context.Background(), destination, "text")
+		require.EqualError(t, err, "problem parsing destination: "+errText, destination)
+		require.ErrorIs(t, err, ErrInvalidDestination, destination)
+		require.ErrorIs(t, f.SendMessage(context.Background(), destination, Message{}), ErrInvalidDestination, destination)
+	}
+}
+
+func TestFallback_Validate(t *testing.T) {
+	f := NewFallback([]Notifier{NewWebhook(WebhookParams{}), &recordingNotifier{}}, FallbackParams{})
+	require.NoError(t, Validate([]Notifier{f}, "fallback:?to=test%3Aa&to=https%3A%2F%2Fexample.org%2Fhook"))
+	require.ErrorIs(t, f.Validate("fallback:"), ErrInvalidDestination)
+	err := f.Validate("fallback:?to=test%3Aa&to=https%3A%2F%2F%2Fhook")
+	require.EqualError(t, err, "fallback destination https:///hook: no host in webhook destination https:///hook")
+	require.ErrorIs(t, err, ErrInvalidDestination)
+	require.ErrorIs(t, f.Validate("fallback:?to=unknown%3Aa"), ErrUnsupportedSchema)
+}
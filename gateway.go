@@ -0,0 +1,273 @@
+package notify
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// GatewayClient is a client allowed to send with Gateway
+type GatewayClient struct {
+	Name    string   // name of the client, for logs
+	Token   string   // bearer token of the client
+	Schemes []string // destination schemes the client could send to, any scheme if empty, case-insensitive
+}
+
+// GatewayParams contain settings for Gateway
+type GatewayParams struct {
+	Clients     []GatewayClient // clients allowed to send, no requests are accepted without them
+	Queue       *Dispatcher     // queue for requests with "queue" set, such requests are rejected if it's not set
+	Parallel    int             // number of parallel deliveries of the synchronous request, no limit by default
+	Timeout     time.Duration   // time limit of the synchronous request delivery, 30s by default
+	MaxBodySize int64           // max size of the request body, 1MB by default
+}
+
+// GatewayRequest is the body of "POST /send" request to Gateway
+type GatewayRequest struct {
+	Destinations []string `json:"destinations"`
+	Text         string   `json:"text"`
+	Title        string   `json:"title,omitempty"`
+	Queue        bool     `json:"queue,omitempty"` // return once the message is queued, without waiting for the delivery
+}
+
+// GatewayResult is the outcome of the delivery to a single destination of GatewayRequest
+type GatewayResult struct {
+	Destination string `json:"destination"`
+	Status      string `json:"status"` // "sent", "queued" or "failed"
+	Error       string `json:"error,omitempty"`
+	Permanent   bool   `json:"permanent,omitempty"` // failure is not fixed by retrying
+	Duration    string `json:"duration,omitempty"`  // time spent on the synchronous delivery
+}
+
+// GatewayResponse is the body of the response to "POST /send" request, and of the error responses
+// with Error set and no results
+type GatewayResponse struct {
+	OK      bool            `json:"ok"` // all destinations got the message, or it's queued for all of them
+	Results []GatewayResult `json:"results,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Gateway is http.Handler sending messages with the notifiers for other services, so that they share the same
+// Telegram bot, SMTP relay and so on. It serves "POST /send" with GatewayRequest JSON body, authorized with
+// the client token in "Authorization: Bearer <token>" header. Message goes to the destinations the same way
+// SendAll does, or to the Queue if the request asks for it, then only the text of the message is sent.
+// X-Correlation-ID header of the request is passed on as the correlation ID of the send.
+//
+// The response is GatewayResponse JSON with the result for every destination, in the same order, with status 200
+// if all of them got the message and 502 if any failed. Requests rejected as a whole get 400 for the malformed body,
+// 401 for the unknown token and 403 for destinations of the schemes the client is not allowed to send to.
+// Schemes of destinations inside "fallback:" destination are checked too, so the client needs all of them allowed.
+type Gateway struct {
+	GatewayParams
+	notifiers []Notifier
+	mux       *http.ServeMux
+}
+
+// NewGateway makes Gateway sending with the notifiers
+func NewGateway(notifiers []Notifier, params GatewayParams) *Gateway {
+	res := &Gateway{GatewayParams: params, notifiers: notifiers, mux: http.NewServeMux()}
+	if res.Timeout <= 0 {
+		res.Timeout = 30 * time.Second
+	}
+	if res.MaxBodySize <= 0 {
+		res.MaxBodySize = 1 << 20
+	}
+	// schemes of destinations are compared in lower case
+	res.Clients = make([]GatewayClient, len(params.Clients))
+	for i, c := range params.Clients {
+		c.Schemes = slices.Clone(c.Schemes)
+		for j, scheme := range c.Schemes {
+			c.Schemes[j] = strings.ToLower(strings.TrimSpace(scheme))
+		}
+		res.Clients[i] = c
+	}
+	res.mux.HandleFunc("POST /send", res.send)
+	return res
+}
+
+// ServeHTTP serves the request
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// send serves "POST /send" request
+func (g *Gateway) send(w http.ResponseWriter, r *http.Request) {
+	client, ok := g.client(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeGatewayError(w, http.StatusUnauthorized, "unknown token")
+		return
+	}
+
+	var req GatewayRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, g.MaxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeGatewayError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", maxErr.Limit))
+			return
+		}
+		writeGatewayError(w, http.StatusBadRequest, fmt.Sprintf("problem parsing request: %v", err))
+		return
+	}
+	if err := g.check(client, req); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errGatewayForbidden) {
+			status = http.StatusForbidden
+		}
+		writeGatewayError(w, status, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	if id := r.Header.Get(CorrelationIDHeader); id != "" {
+		ctx = WithCorrelationID(ctx, id)
+	}
+	var results []GatewayResult
+	if req.Queue {
+		results = g.enqueue(ctx, req)
+	} else {
+		results = g.deliver(ctx, req)
+	}
+
+	resp := GatewayResponse{OK: true, Results: results}
+	for _, res := range results {
+		if res.Status == "failed" {
+			resp.OK = false
+		}
+	}
+	log.Printf("[DEBUG] gateway request of %s to %d destinations, ok=%v", client.Name, len(req.Destinations), resp.OK)
+	status := http.StatusOK
+	if !resp.OK {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, resp)
+}
+
+// client returns the client authorized with the bearer token of the request
+func (g *Gateway) client(r *http.Request) (GatewayClient, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return GatewayClient{}, false
+	}
+	for _, c := range g.Clients {
+		if c.Token != "" && subtle.ConstantTimeCompare([]byte(c.Token), []byte(token)) == 1 {
+			return c, true
+		}
+	}
+	return GatewayClient{}, false
+}
+
+var errGatewayForbidden = errors.New("forbidden")
+
+// check checks that the request is complete and the client is allowed to send to its destinations
+func (g *Gateway) check(client GatewayClient, req GatewayRequest) error {
+	if len(req.Destinations) == 0 {
+		return errors.New("no destinations")
+	}
+	if req.Text == "" && req.Title == "" {
+		return errors.New("no text")
+	}
+	if req.Queue && g.Queue == nil {
+		return errors.New("queued delivery is not enabled")
+	}
+	if len(client.Schemes) == 0 {
+		return nil
+	}
+	var forbidden []string
+	for _, d := range req.Destinations {
+		for _, scheme := range gatewaySchemes(d) {
+			if !slices.Contains(client.Schemes, scheme) {
+				forbidden = append(forbidden, redactDestination(d))
+				break
+			}
+		}
+	}
+	if len(forbidden) > 0 {
+		return markError(fmt.Errorf("client is not allowed to send to %s", strings.Join(forbidden, ", ")), errGatewayForbidden)
+	}
+	return nil
+}
+
+// gatewaySchemes returns the scheme of the destination, and schemes of destinations inside it
+// for "fallback:" destination, nested ones included
+func gatewaySchemes(destination string) []string {
+	scheme := destinationScheme(destination)
+	res := []string{scheme}
+	if scheme != "fallback" {
+		return res
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return res
+	}
+	for _, d := range u.Query()["to"] {
+		res = append(res, gatewaySchemes(d)...)
+	}
+	return res
+}
+
+// deliver sends the message of the request to its destinations and waits for the results
+func (g *Gateway) deliver(ctx context.Context, req GatewayRequest) []GatewayResult {
+	ctx, cancel := context.WithTimeout(ctx, g.Timeout)
+	defer cancel()
+	msg := Message{Title: req.Title, Body: req.Text}
+	return gatewayResults(sendAll(ctx, req.Destinations, g.Parallel, func(ctx context.Context, destination string) (Notifier, error) {
+		n, err := findNotifier(g.notifiers, destination)
+		if err != nil {
+			return nil, err
+		}
+		return n, sendMessage(ctx, n, destination, msg)
+	}))
+}
+
+// enqueue puts text of the request message into the queue for every destination
+func (g *Gateway) enqueue(ctx context.Context, req GatewayRequest) []GatewayResult {
+	text := Message{Title: req.Title, Body: req.Text}.Text()
+	res := make([]GatewayResult, 0, len(req.Destinations))
+	for _, d := range req.Destinations {
+		r := GatewayResult{Destination: d, Status: "queued"}
+		if err := g.Queue.Send(ctx, d, text); err != nil {
+			r.Status, r.Error, r.Permanent = "failed", err.Error(), IsPermanent(err)
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// gatewayResults returns results of the synchronous delivery for the response
+func gatewayResults(sent *SendAllResult) []GatewayResult {
+	res := make([]GatewayResult, 0, len(sent.Results))
+	for _, dr := range sent.Results {
+		r := GatewayResult{Destination: dr.Destination, Status: "sent", Duration: dr.Duration.String()}
+		if dr.Err != nil {
+			r.Status, r.Error, r.Permanent = "failed", dr.Err.Error(), IsPermanent(dr.Err)
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// writeGatewayError writes GatewayResponse with the error
+func writeGatewayError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, GatewayResponse{Error: msg})
+}
+
+// writeJSON writes the value as JSON response with the status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[WARN] can't write response: %v", err)
+	}
+}
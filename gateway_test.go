@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gatewayRequest(t *testing.T, h http.Handler, token, body string) (int, GatewayResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	var resp GatewayResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), rec.Body.String())
+	return rec.Code, resp
+}
+
+func TestGateway_Send(t *testing.T) {
+	slackN := &schemeNotifier{scheme: "slack"}
+	tgN := &schemeNotifier{scheme: "telegram"}
+	g := NewGateway([]Notifier{slackN, tgN}, GatewayParams{Clients: []GatewayClient{{Name: "billing", Token: "secret"}}})
+
+	code, resp := gatewayRequest(t, g, "secret", `{"destinations": ["slack:ops", "telegram:ops"], "text": "disk is full", "title": "db1"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, resp.OK)
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, "slack:ops", resp.Results[0].Destination)
+	assert.Equal(t, "sent", resp.Results[0].Status)
+	assert.NotEmpty(t, resp.Results[0].Duration)
+	assert.Equal(t, "telegram:ops", resp.Results[1].Destination)
+	assert.Equal(t, "sent", resp.Results[1].Status)
+	assert.Equal(t, []string{"slack:ops db1\n\ndisk is full"}, slackN.get())
+	assert.Equal(t, []string{"telegram:ops db1\n\ndisk is full"}, tgN.get())
+}
+
+func TestGateway_Failures(t *testing.T) {
+	slackN := &schemeNotifier{scheme: "slack", recordingNotifier: recordingNotifier{err: errors.New("slack is down")}}
+	tgN := &schemeNotifier{scheme: "telegram"}
+	g := NewGateway([]Notifier{slackN, tgN}, GatewayParams{Clients: []GatewayClient{{Token: "secret"}}})
+
+	code, resp := gatewayRequest(t, g, "secret", `{"destinations": ["slack:ops", "telegram:ops", "mailto:ops@example.org"], "text": "hi"}`)
+	assert.Equal(t, http.StatusBadGateway, code)
+	assert.False(t, resp.OK)
+	require.Len(t, resp.Results, 3)
+	assert.Equal(t, GatewayResult{Destination: "slack:ops", Status: "failed", Error: "slack is down", Duration: resp.Results[0].Duration}, resp.Results[0])
+	assert.Equal(t, "sent", resp.Results[1].Status)
+	assert.Equal(t, "failed", resp.Results[2].Status)
+	assert.Equal(t, "unsupported destination schema: mailto", resp.Results[2].Error)
+	assert.True(t, resp.Results[2].Permanent)
+}
+
+func TestGateway_Rejects(t *testing.T) {
+	rec := &schemeNotifier{scheme: "slack"}
+	g := NewGateway([]Notifier{rec}, GatewayParams{
+		Clients: []GatewayClient{
+			{Name: "billing", Token: "billing-token", Schemes: []string{"slack"}},
+			{Name: "ops", Token: "ops-token"},
+			{Name: "alerts", Token: "alerts-token", Schemes: []string{" Slack", "FALLBACK"}},
+		},
+		MaxBodySize: 200,
+	})
+
+	tbl := []struct {
+		name, token, body string
+		code              int
+		err               string
+	}{
+		{"no token", "", `{"destinations": ["slack:ops"], "text": "hi"}`, http.StatusUnauthorized, "unknown token"},
+		{"wrong token", "other", `{"destinations": ["slack:ops"], "text": "hi"}`, http.StatusUnauthorized, "unknown token"},
+		{"forbidden scheme", "billing-token", `{"destinations": ["slack:ops", "telegram:ops", "mailto:ops@example.org"], "text": "hi"}`,
+			http.StatusForbidden, "client is not allowed to send to telegram:ops, mailto:ops@example.org"},
+		{"forbidden in fallback", "alerts-token", `{"destinations": ["fallback:?to=slack%3Aops&to=telegram%3Aops"], "text": "hi"}`,
+			http.StatusForbidden, "client is not allowed to send to fallback:?to=slack%3Aops&to=telegram%3Aops"},
+		{"forbidden in nested fallback", "alerts-token",
+			`{"destinations": ["fallback:?to=fallback%3A%3Fto%3Dmailto%253Aops%2540example.org"], "text": "hi"}`,
+			http.StatusForbidden, "client is not allowed to send to fallback:"},
+		{"fallback not allowed", "billing-token", `{"destinations": ["fallback:?to=slack%3Aops"], "text": "hi"}`,
+			http.StatusForbidden, "client is not allowed to send to fallback:?to=slack%3Aops"},
+		{"malformed", "ops-token", `{"destinations": "slack:ops"}`, http.StatusBadRequest, "problem parsing request: json: cannot unmarshal"},
+		{"unknown field", "ops-token", `{"destinations": ["slack:ops"], "txt": "hi"}`, http.StatusBadRequest, `json: unknown field "txt"`},
+		{"no destinations", "ops-token", `{"text": "hi"}`, http.StatusBadRequest, "no destinations"},
+		{"no text", "ops-token", `{"destinations": ["slack:ops"]}`, http.StatusBadRequest, "no text"},
+		{"no queue", "ops-token", `{"destinations": ["slack:ops"], "text": "hi", "queue": true}`, http.StatusBadRequest, "queued delivery is not enabled"},
+		{"too large", "ops-token", `{"destinations": ["slack:ops"], "text": "` + strings.Repeat("a", 200) + `"}`,
+			http.StatusRequestEntityTooLarge, "request body is larger than 200 bytes"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := gatewayRequest(t, g, tt.token, tt.body)
+			assert.Equal(t, tt.code, code)
+			assert.False(t, resp.OK)
+			assert.Contains(t, resp.Error, tt.err)
+		})
+	}
+	assert.Empty(t, rec.get())
+
+	code, resp := gatewayRequest(t, g, "billing-token", `{"destinations": ["slack:ops"], "text": "hi"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, resp.OK)
+	code, resp = gatewayRequest(t, g, "alerts-token", `{"destinations": ["SLACK:ops"], "text": "hi"}`)
+	assert.Equal(t, http.StatusOK, code, "schemes of the client are case-insensitive")
+	assert.True(t, resp.OK)
+	code, resp = gatewayRequest(t, g, "alerts-token", `{"destinations": ["fallback:?to=slack%3Aops"], "text": "hi"}`)
+	assert.Equal(t, http.StatusBadGateway, code, "fallback to allowed schemes is not forbidden")
+	assert.Equal(t, "unsupported destination schema: fallback", resp.Results[0].Error)
+
+	req := httptest.NewRequest(http.MethodGet, "/send", http.NoBody)
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestGateway_Queue(t *testing.T) {
+	rec := &schemeNotifier{scheme: "slack"}
+	d, err := NewDispatcher([]Notifier{rec}, DispatcherParams{})
+	require.NoError(t, err)
+	g := NewGateway([]Notifier{rec}, GatewayParams{Clients: []GatewayClient{{Token: "secret"}}, Queue: d})
+
+	code, resp := gatewayRequest(t, g, "secret", `{"destinations": ["slack:ops", "telegram:ops"], "text": "hi", "title": "db1", "queue": true}`)
+	assert.Equal(t, http.StatusBadGateway, code)
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, GatewayResult{Destination: "slack:ops", Status: "queued"}, resp.Results[0])
+	assert.Equal(t, GatewayResult{Destination: "telegram:ops", Status: "failed", Error: "unsupported destination schema: telegram",
+		Permanent: true}, resp.Results[1])
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, d.Shutdown(ctx))
+	assert.Equal(t, []string{"slack:ops db1\n\nhi"}, rec.get())
+}
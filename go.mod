@@ -10,11 +10,11 @@ require (
 	github.com/slack-go/slack v0.27.0
 	github.com/stretchr/testify v1.12.0
 	golang.org/x/net v0.56.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/aymerick/douceur v0.2.0 // indirect
 	github.com/gorilla/css v1.0.1 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -4,7 +4,7 @@ package notify
 import (
 	"context"
 	"fmt"
-	"strings"
+	"slices"
 )
 
 // Notifier defines common interface among all notifiers
@@ -14,15 +14,70 @@ type Notifier interface {
 	Send(ctx context.Context, destination, text string) error // sends message to provided destination
 }
 
-// Send sends message to provided destination, picking the right one based on destination schema
+// Send sends message to provided destination, picking the first notifier supporting destination scheme.
+// Use Router to reject ambiguous setups with more than one notifier for the same scheme.
 func Send(ctx context.Context, notifiers []Notifier, destination, text string) error {
+	n, err := findNotifier(notifiers, destination)
+	if err != nil {
+		return failSend(ctx, destination, err)
+	}
+	return observedSend(ctx, n, destination, func(ctx context.Context) error { return n.Send(ctx, destination, text) })
+}
+
+// findNotifier returns the first notifier supporting the exact scheme of the destination
+func findNotifier(notifiers []Notifier, destination string) (Notifier, error) {
+	scheme := destinationScheme(destination)
 	for _, n := range notifiers {
-		if strings.HasPrefix(destination, n.Schema()) {
-			return n.Send(ctx, destination, text)
+		if slices.Contains(notifierSchemes(n), scheme) {
+			return n, nil
 		}
 	}
-	if strings.Contains(destination, ":") {
-		return fmt.Errorf("unsupported destination schema: %s", strings.Split(destination, ":")[0])
+	return nil, unsupportedSchemaError(destination, scheme)
+}
+
+// decorator wraps notifier, running every send of it through around func. It keeps schemes of the wrapped
+// notifier and passes messages to it with SendMessage, so decorating doesn't change what notifier does.
+type decorator struct {
+	Notifier
+	around func(ctx context.Context, destination string, send func(ctx context.Context) error) error
+}
+
+// Send sends text with the wrapped notifier
+func (d *decorator) Send(ctx context.Context, destination, text string) error {
+	return d.around(ctx, destination, func(ctx context.Context) error {
+		return d.Notifier.Send(ctx, destination, text)
+	})
+}
+
+// SendMessage sends message with the wrapped notifier
+func (d *decorator) SendMessage(ctx context.Context, destination string, msg Message) error {
+	return d.around(ctx, destination, func(ctx context.Context) error {
+		return sendMessage(ctx, d.Notifier, destination, msg)
+	})
+}
+
+// Schemes returns destination schemes supported by the wrapped notifier
+func (d *decorator) Schemes() []string {
+	return notifierSchemes(d.Notifier)
+}
+
+// Unwrap returns the wrapped notifier
+func (d *decorator) Unwrap() Notifier {
+	return d.Notifier
+}
+
+// unwrapAs returns the notifier as T, or the first notifier wrapped by it implementing T
+func unwrapAs[T any](n Notifier) (T, bool) {
+	for n != nil {
+		if res, ok := n.(T); ok {
+			return res, true
+		}
+		u, ok := n.(interface{ Unwrap() Notifier })
+		if !ok {
+			break
+		}
+		n = u.Unwrap()
 	}
-	return fmt.Errorf("unsupported destination schema: %s", destination)
+	var zero T
+	return zero, false
 }
@@ -30,4 +30,10 @@ func TestInterface(t *testing.T) {
 	assert.Implements(t, (*Notifier)(nil), new(Webhook))
 	assert.Implements(t, (*Notifier)(nil), new(Slack))
 	assert.Implements(t, (*Notifier)(nil), new(Telegram))
+
+	assert.Implements(t, (*MessageSender)(nil), new(Email))
+	assert.Implements(t, (*MessageSender)(nil), new(Webhook))
+	assert.Implements(t, (*MessageSender)(nil), new(Slack))
+	assert.Implements(t, (*MessageSender)(nil), new(Telegram))
+	assert.Implements(t, (*MessageSender)(nil), new(Router))
 }
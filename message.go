@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Format of the message body
+type Format string
+
+// supported message body formats, empty format is the same as FormatPlain
+const (
+	FormatPlain    Format = "plain"
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+)
+
+// Severity of the message, notifiers use it for visual distinction of the messages where possible
+type Severity int
+
+// supported message severities, in ascending order
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+	SeverityCritical
+)
+
+var severityNames = map[Severity]string{
+	SeverityInfo:     "info",
+	SeverityWarning:  "warning",
+	SeverityError:    "error",
+	SeverityCritical: "critical",
+}
+
+// ParseSeverity returns severity by its name, case-insensitive
+func ParseSeverity(name string) (Severity, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warn" {
+		return SeverityWarning, nil
+	}
+	for s, n := range severityNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return SeverityInfo, fmt.Errorf("unknown severity %q", name)
+}
+
+// String returns severity name
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// MarshalText implements encoding.TextMarshaler, severity is encoded by its name
+func (s Severity) MarshalText() ([]byte, error) {
+	if _, ok := severityNames[s]; !ok {
+		return nil, fmt.Errorf("unknown severity %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, severity is decoded from its name
+func (s *Severity) UnmarshalText(text []byte) error {
+	res, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = res
+	return nil
+}
+
+// Attachment is a file sent along with the message
+type Attachment struct {
+	Name        string `json:"name"`                   // file name
+	ContentType string `json:"content_type,omitempty"` // MIME type of the data, optional
+	Data        []byte `json:"data"`
+}
+
+// Message is a notification with optional title, link and other details besides the body text.
+// Notifiers implementing MessageSender use these details to format the message,
+// the rest receive its plain text representation returned by Text.
+type Message struct {
+	Title       string       `json:"title,omitempty"`
+	Body        string       `json:"body"`
+	Format      Format       `json:"format,omitempty"`
+	Severity    Severity     `json:"severity"`
+	Link        string       `json:"link,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Text returns plain text representation of the message: title, body and link separated by empty lines.
+// Body is not converted from its format.
+func (m Message) Text() string {
+	parts := make([]string, 0, 3)
+	for _, p := range []string{m.Title, m.Body, m.Link} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// MessageSender is implemented by notifiers which can make use of the Message details
+type MessageSender interface {
+	SendMessage(ctx context.Context, destination string, msg Message) error // sends message to provided destination
+}
+
+// SendMessage sends message to provided destination, picking the notifier the same way Send does.
+// Notifiers not implementing MessageSender receive plain text representation of the message.
+func SendMessage(ctx context.Context, notifiers []Notifier, destination string, msg Message) error {
+	n, err := findNotifier(notifiers, destination)
+	if err != nil {
+		return failSend(ctx, destination, err)
+	}
+	return observedSend(ctx, n, destination, func(ctx context.Context) error { return sendMessage(ctx, n, destination, msg) })
+}
+
+// SendMessage sends message to destination using notifier registered for its scheme
+func (r *Router) SendMessage(ctx context.Context, destination string, msg Message) error {
+	n, err := r.route(destination)
+	if err != nil {
+		return failSend(ctx, destination, err)
+	}
+	return observedSend(ctx, n, destination, func(ctx context.Context) error { return sendMessage(ctx, n, destination, msg) })
+}
+
+// sendMessage sends message with notifier, falling back to the plain text for notifiers without MessageSender
+func sendMessage(ctx context.Context, n Notifier, destination string, msg Message) error {
+	if ms, ok := n.(MessageSender); ok {
+		return ms.SendMessage(ctx, destination, msg)
+	}
+	return n.Send(ctx, destination, msg.Text())
+}
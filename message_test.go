@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// messageNotifier records messages sent to it with SendMessage
+type messageNotifier struct {
+	schemaNotifier
+	messages []Message
+}
+
+func (n *messageNotifier) SendMessage(_ context.Context, destination string, msg Message) error {
+	n.sent = append(n.sent, destination)
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+func TestSeverity(t *testing.T) {
+	for _, s := range []Severity{SeverityInfo, SeverityWarning, SeverityError, SeverityCritical} {
+		parsed, err := ParseSeverity(s.String())
+		require.NoError(t, err)
+		assert.Equal(t, s, parsed)
+	}
+	s, err := ParseSeverity(" WARN ")
+	require.NoError(t, err)
+	assert.Equal(t, SeverityWarning, s)
+	_, err = ParseSeverity("fatal")
+	require.EqualError(t, err, `unknown severity "fatal"`)
+
+	assert.Equal(t, "severity(42)", Severity(42).String())
+	assert.Less(t, SeverityWarning, SeverityCritical, "severities are ordered")
+
+	b, err := json.Marshal(Message{Body: "text", Severity: SeverityCritical})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"body":"text","severity":"critical"}`, string(b))
+
+	var msg Message
+	require.NoError(t, json.Unmarshal([]byte(`{"body":"text","severity":"Error"}`), &msg))
+	assert.Equal(t, SeverityError, msg.Severity)
+	require.Error(t, json.Unmarshal([]byte(`{"severity":"fatal"}`), &msg))
+	_, err = json.Marshal(Message{Severity: Severity(42)})
+	require.Error(t, err)
+}
+
+func TestMessage_Text(t *testing.T) {
+	assert.Equal(t, "title\n\nbody\n\nhttps://example.org",
+		Message{Title: "title", Body: "body", Link: "https://example.org", Tags: []string{"tag"}}.Text())
+	assert.Equal(t, "body", Message{Body: "body", Severity: SeverityCritical}.Text())
+	assert.Equal(t, "title\n\nhttps://example.org", Message{Title: "title", Link: "https://example.org"}.Text())
+	assert.Empty(t, Message{}.Text())
+}
+
+func TestSendMessage(t *testing.T) {
+	plain := &schemaNotifier{schema: "plain"}
+	rich := &messageNotifier{schemaNotifier: schemaNotifier{schema: "rich"}}
+	notifiers := []Notifier{plain, rich}
+	msg := Message{Title: "title", Body: "body", Severity: SeverityWarning}
+
+	require.NoError(t, SendMessage(context.Background(), notifiers, "rich:dst", msg))
+	assert.Equal(t, []Message{msg}, rich.messages)
+
+	require.NoError(t, SendMessage(context.Background(), notifiers, "plain:dst", msg))
+	assert.Equal(t, []string{"plain:dst"}, plain.sent)
+
+	require.EqualError(t, SendMessage(context.Background(), notifiers, "other:dst", msg), "unsupported destination schema: other")
+
+	r := NewRouter()
+	require.NoError(t, r.Register(rich))
+	require.NoError(t, r.SendMessage(context.Background(), "rich:routed", msg))
+	assert.Equal(t, []string{"rich:dst", "rich:routed"}, rich.sent)
+	require.EqualError(t, r.SendMessage(context.Background(), "plain:dst", msg), "unsupported destination schema: plain")
+}
+
+func TestSendMessage_Fallback(t *testing.T) {
+	var received string
+	n := &textNotifier{send: func(text string) { received = text }}
+	require.NoError(t, SendMessage(context.Background(), []Notifier{n}, "text:dst",
+		Message{Title: "title", Body: "body", Link: "https://example.org"}))
+	assert.Equal(t, "title\n\nbody\n\nhttps://example.org", received, "notifier without SendMessage receives plain text")
+}
+
+// textNotifier passes text it receives to send func
+type textNotifier struct {
+	send func(text string)
+}
+
+func (n *textNotifier) Send(_ context.Context, _, text string) error {
+	n.send(text)
+	return nil
+}
+
+func (n *textNotifier) Schema() string { return "text" }
+
+func (n *textNotifier) String() string { return "text notifier" }
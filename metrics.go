@@ -0,0 +1,316 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Metrics receives every send made by the built-in notifiers, and by Send, SendMessage, SendAll and Router
+// with other notifiers, with the schema of the destination, time spent and the error, nil on success.
+// It should be safe for concurrent use.
+type Metrics interface {
+	ObserveSend(schema string, duration time.Duration, err error)
+}
+
+var metrics atomic.Pointer[Metrics]
+
+// SetMetrics sets Metrics for all sends, nil disables reporting
+func SetMetrics(m Metrics) {
+	if m == nil {
+		metrics.Store(nil)
+		return
+	}
+	metrics.Store(&m)
+}
+
+// reportSend passes the send to Metrics, if it's set
+func reportSend(schema string, duration time.Duration, err error) {
+	if m := metrics.Load(); m != nil {
+		(*m).ObserveSend(schema, duration, err)
+	}
+}
+
+// startSend starts reporting of the send to Tracer and Metrics, returning context of the span and func
+// to be deferred with the pointer to the send error. Failures are logged if the context has correlation ID.
+func startSend(ctx context.Context, schema, destination string) (context.Context, func(errp *error)) {
+	st := time.Now()
+	ctx, span := startSpan(ctx, schema, destination)
+	return ctx, func(errp *error) {
+		err := *errp
+		reportSend(schema, time.Since(st), err)
+		endSpan(span, err)
+		if id := CorrelationID(ctx); id != "" && err != nil {
+			log.Printf("[WARN] problem sending to %s, correlation id %s: %v", redactDestination(destination), id, err)
+		}
+	}
+}
+
+// unknownSchema is the schema reported for destinations with the scheme no notifier supports, so arbitrary input
+// doesn't make unlimited number of distinct schemas in metrics
+const unknownSchema = "unknown"
+
+// sendSchema returns scheme of the destination to report the send with, if the notifier supports it,
+// and unknownSchema otherwise
+func sendSchema(n Notifier, destination string) string {
+	if scheme := destinationScheme(destination); scheme != "" && slices.Contains(notifierSchemes(n), scheme) {
+		return scheme
+	}
+	return unknownSchema
+}
+
+// failSend reports the send failed before it's made, like for unsupported destination, and returns the error
+func failSend(ctx context.Context, destination string, err error) error {
+	_, done := startSend(ctx, unknownSchema, destination)
+	done(&err)
+	return err
+}
+
+// instrumentedNotifier is implemented by the notifiers reporting their sends to Tracer and Metrics themselves
+type instrumentedNotifier interface {
+	instrumented()
+}
+
+// observedSend runs send with the notifier, reporting it to Tracer and Metrics unless the notifier
+// or the one it wraps reports its sends itself
+func observedSend(ctx context.Context, n Notifier, destination string, send func(ctx context.Context) error) (err error) {
+	if _, ok := unwrapAs[instrumentedNotifier](n); ok {
+		return send(ctx)
+	}
+	ctx, done := startSend(ctx, sendSchema(n, destination), destination)
+	defer done(&err)
+	return send(ctx)
+}
+
+// ErrorClass returns the class of the send error for metrics: "timeout", "canceled", "unsupported_schema",
+// "invalid_destination", "rate_limited", "recipient_blocked", "circuit_open", "permanent" for other permanent
+// errors, "temporary" for the rest, and empty string for nil error
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrUnsupportedSchema):
+		return "unsupported_schema"
+	case errors.Is(err, ErrInvalidDestination):
+		return "invalid_destination"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrRecipientBlocked):
+		return "recipient_blocked"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case IsPermanent(err):
+		return "permanent"
+	default:
+		return "temporary"
+	}
+}
+
+// MetricsParams contain settings for ExpvarMetrics and PrometheusMetrics
+type MetricsParams struct {
+	Buckets []time.Duration // upper bounds of the latency histogram buckets, from 50ms to 30s by default
+}
+
+// sendStats keeps counters and latency histograms of the sends by schema
+type sendStats struct {
+	buckets []float64 // upper bounds in seconds, sorted
+
+	mu      sync.Mutex
+	schemas map[string]*schemaStats
+}
+
+// schemaStats are counters and latency histogram of the sends with a single schema
+type schemaStats struct {
+	attempts  uint64
+	successes uint64
+	failures  map[string]uint64 // by error class
+	counts    []uint64          // number of sends in every bucket, not cumulative, with +Inf bucket at the end
+	sum       float64           // total latency in seconds
+}
+
+func newSendStats(params MetricsParams) *sendStats {
+	buckets := params.Buckets
+	if len(buckets) == 0 {
+		buckets = []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+			time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second, 30 * time.Second}
+	}
+	res := &sendStats{schemas: map[string]*schemaStats{}}
+	for _, b := range buckets {
+		res.buckets = append(res.buckets, b.Seconds())
+	}
+	slices.Sort(res.buckets)
+	res.buckets = slices.Compact(res.buckets)
+	return res
+}
+
+// ObserveSend counts the send and its latency
+func (s *sendStats) ObserveSend(schema string, duration time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.schemas[schema]
+	if !ok {
+		st = &schemaStats{failures: map[string]uint64{}, counts: make([]uint64, len(s.buckets)+1)}
+		s.schemas[schema] = st
+	}
+	st.attempts++
+	if err == nil {
+		st.successes++
+	} else {
+		st.failures[ErrorClass(err)]++
+	}
+	sec := duration.Seconds()
+	i, _ := slices.BinarySearch(s.buckets, sec) // first bucket with the upper bound not less than sec
+	st.counts[i]++
+	st.sum += sec
+}
+
+// snapshot returns copy of the stats by schema
+func (s *sendStats) snapshot() map[string]schemaStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make(map[string]schemaStats, len(s.schemas))
+	for schema, st := range s.schemas {
+		res[schema] = schemaStats{attempts: st.attempts, successes: st.successes, failures: maps.Clone(st.failures),
+			counts: slices.Clone(st.counts), sum: st.sum}
+	}
+	return res
+}
+
+// formatFloat formats the number the way Prometheus does
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// ExpvarMetrics is Metrics published with expvar, as JSON object with stats by schema: "attempts", "successes",
+// "failures" by error class, and "latency" histogram with "count", "sum" in seconds and cumulative "buckets"
+// by upper bound in seconds, like {"mailto": {"attempts": 2, "successes": 1, "failures": {"timeout": 1}, ...}}.
+type ExpvarMetrics struct {
+	*sendStats
+}
+
+// expvarMu makes the check of the name and its publishing atomic, as expvar.Publish panics on the used name
+var expvarMu sync.Mutex
+
+// NewExpvarMetrics makes ExpvarMetrics published with the name, returning error if the name is already used
+func NewExpvarMetrics(name string, params MetricsParams) (*ExpvarMetrics, error) {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if expvar.Get(name) != nil {
+		return nil, fmt.Errorf("expvar %s is already published", name)
+	}
+	res := &ExpvarMetrics{sendStats: newSendStats(params)}
+	expvar.Publish(name, expvar.Func(res.value))
+	return res, nil
+}
+
+// value returns the stats published with expvar
+func (m *ExpvarMetrics) value() any {
+	res := map[string]any{}
+	for schema, st := range m.snapshot() {
+		buckets := map[string]uint64{}
+		var cumulative uint64
+		for i, c := range st.counts {
+			cumulative += c
+			le := "+Inf"
+			if i < len(m.buckets) {
+				le = formatFloat(m.buckets[i])
+			}
+			buckets[le] = cumulative
+		}
+		res[schema] = map[string]any{
+			"attempts":  st.attempts,
+			"successes": st.successes,
+			"failures":  st.failures,
+			"latency":   map[string]any{"count": st.attempts, "sum": st.sum, "buckets": buckets},
+		}
+	}
+	return res
+}
+
+// PrometheusMetrics is Metrics served as http.Handler in Prometheus text exposition format, with metrics:
+//
+//   - notify_send_attempts_total{schema}: number of sends
+//   - notify_send_successes_total{schema}: number of successful sends
+//   - notify_send_failures_total{schema, class}: number of failed sends by error class, see ErrorClass
+//   - notify_send_duration_seconds{schema}: histogram of the send latency
+type PrometheusMetrics struct {
+	*sendStats
+}
+
+// NewPrometheusMetrics makes PrometheusMetrics
+func NewPrometheusMetrics(params MetricsParams) *PrometheusMetrics {
+	return &PrometheusMetrics{sendStats: newSendStats(params)}
+}
+
+// ServeHTTP writes the metrics
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := m.WriteTo(w); err != nil {
+		log.Printf("[WARN] can't write metrics: %v", err)
+	}
+}
+
+// WriteTo writes the metrics in Prometheus text exposition format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	stats := m.snapshot()
+	schemas := slices.Sorted(maps.Keys(stats))
+	var b strings.Builder
+
+	counter := func(name, help string, value func(st schemaStats) uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, schema := range schemas {
+			fmt.Fprintf(&b, "%s{schema=\"%s\"} %d\n", name, escapeLabel(schema), value(stats[schema]))
+		}
+	}
+	counter("notify_send_attempts_total", "Number of sends.", func(st schemaStats) uint64 { return st.attempts })
+	counter("notify_send_successes_total", "Number of successful sends.", func(st schemaStats) uint64 { return st.successes })
+
+	b.WriteString("# HELP notify_send_failures_total Number of failed sends by error class.\n# TYPE notify_send_failures_total counter\n")
+	for _, schema := range schemas {
+		for _, class := range slices.Sorted(maps.Keys(stats[schema].failures)) {
+			fmt.Fprintf(&b, "notify_send_failures_total{schema=\"%s\",class=\"%s\"} %d\n", escapeLabel(schema), class, stats[schema].failures[class])
+		}
+	}
+
+	b.WriteString("# HELP notify_send_duration_seconds Latency of sends.\n# TYPE notify_send_duration_seconds histogram\n")
+	for _, schema := range schemas {
+		st, label := stats[schema], escapeLabel(schema)
+		var cumulative uint64
+		for i, c := range st.counts {
+			cumulative += c
+			le := "+Inf"
+			if i < len(m.buckets) {
+				le = formatFloat(m.buckets[i])
+			}
+			fmt.Fprintf(&b, "notify_send_duration_seconds_bucket{schema=\"%s\",le=\"%s\"} %d\n", label, le, cumulative)
+		}
+		fmt.Fprintf(&b, "notify_send_duration_seconds_sum{schema=\"%s\"} %s\n", label, formatFloat(st.sum))
+		fmt.Fprintf(&b, "notify_send_duration_seconds_count{schema=\"%s\"} %d\n", label, st.attempts)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// escapeLabel escapes backslash, double quote and line feed in the label value, as Prometheus text format requires
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// observedSendsMetrics records all observed sends
+type observedSendsMetrics struct {
+	mu    sync.Mutex
+	sends []string
+}
+
+func (m *observedSendsMetrics) ObserveSend(schema string, _ time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sends = append(m.sends, schema+" "+ErrorClass(err))
+}
+
+func (m *observedSendsMetrics) get() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.sends...)
+}
+
+func TestErrorClass(t *testing.T) {
+	tbl := []struct {
+		err   error
+		class string
+	}{
+		{nil, ""},
+		{fmt.Errorf("problem sending: %w", context.DeadlineExceeded), "timeout"},
+		{context.Canceled, "canceled"},
+		{unsupportedSchemaError("ftp://host", "ftp"), "unsupported_schema"},
+		{invalidDestination(errors.New("no host")), "invalid_destination"},
+		{markError(errors.New("too many requests"), ErrRateLimited), "rate_limited"},
+		{markError(errors.New("bot was blocked"), ErrRecipientBlocked), "recipient_blocked"},
+		{ErrCircuitOpen, "circuit_open"},
+		{Permanent(errors.New("bad request")), "permanent"},
+		{errors.New("connection reset"), "temporary"},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.class, ErrorClass(tt.err), "%v", tt.err)
+	}
+}
+
+func TestMetrics_Send(t *testing.T) {
+	m := &observedSendsMetrics{}
+	SetMetrics(m)
+	t.Cleanup(func() { SetMetrics(nil) })
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	wh := NewWebhook(WebhookParams{})
+	custom := &schemeNotifier{scheme: "custom"}
+	notifiers := []Notifier{wh, custom}
+
+	require.NoError(t, Send(context.Background(), notifiers, ts.URL+"/ok", "hello"))
+	require.Error(t, Send(context.Background(), notifiers, ts.URL+"/down", "hello"))
+	require.NoError(t, Send(context.Background(), notifiers, "custom:ops", "hello"))
+	require.Error(t, Send(context.Background(), notifiers, "slack:ops", "hello"))
+	require.NoError(t, SendMessage(context.Background(), notifiers, "custom:ops", Message{Body: "hello"}))
+	assert.Equal(t, []string{"http ", "http temporary", "custom ", "unknown unsupported_schema", "custom "}, m.get(),
+		"webhook reports its sends itself, other notifiers are reported by Send")
+
+	// schemes no notifier supports are reported as unknown, so junk destinations don't add distinct schemas
+	require.Error(t, Send(context.Background(), notifiers, "junk-1:ops", "hello"))
+	require.Error(t, wh.Send(context.Background(), "junk-2://ops", "hello"))
+	assert.Equal(t, []string{"unknown unsupported_schema", "unknown temporary"}, m.get()[5:])
+
+	r := NewRouter()
+	require.NoError(t, r.Register(wh))
+	require.NoError(t, r.Register(custom))
+	res := SendAll(context.Background(), []Notifier{r}, []string{ts.URL + "/ok", "custom:ops"}, "hello", 1)
+	require.NoError(t, res.Err())
+	assert.Equal(t, []string{"http ", "custom "}, m.get()[7:], "sends through router are reported once")
+
+	SetMetrics(nil)
+	require.NoError(t, Send(context.Background(), notifiers, "custom:ops", "hello"))
+	assert.Len(t, m.get(), 9)
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics(MetricsParams{Buckets: []time.Duration{time.Second, 100 * time.Millisecond}})
+	m.ObserveSend("telegram", 50*time.Millisecond, nil)
+	m.ObserveSend("telegram", 2*time.Second, context.DeadlineExceeded)
+	m.ObserveSend("mailto", 500*time.Millisecond, Permanent(errors.New("mailbox unavailable")))
+	m.ObserveSend(`a"b`, time.Second, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	expected := `# HELP notify_send_attempts_total Number of sends.
+# TYPE notify_send_attempts_total counter
+notify_send_attempts_total{schema="a\"b"} 1
+notify_send_attempts_total{schema="mailto"} 1
+notify_send_attempts_total{schema="telegram"} 2
+# HELP notify_send_successes_total Number of successful sends.
+# TYPE notify_send_successes_total counter
+notify_send_successes_total{schema="a\"b"} 1
+notify_send_successes_total{schema="mailto"} 0
+notify_send_successes_total{schema="telegram"} 1
+# HELP notify_send_failures_total Number of failed sends by error class.
+# TYPE notify_send_failures_total counter
+notify_send_failures_total{schema="mailto",class="permanent"} 1
+notify_send_failures_total{schema="telegram",class="timeout"} 1
+# HELP notify_send_duration_seconds Latency of sends.
+# TYPE notify_send_duration_seconds histogram
+notify_send_duration_seconds_bucket{schema="a\"b",le="0.1"} 0
+notify_send_duration_seconds_bucket{schema="a\"b",le="1"} 1
+notify_send_duration_seconds_bucket{schema="a\"b",le="+Inf"} 1
+notify_send_duration_seconds_sum{schema="a\"b"} 1
+notify_send_duration_seconds_count{schema="a\"b"} 1
+notify_send_duration_seconds_bucket{schema="mailto",le="0.1"} 0
+notify_send_duration_seconds_bucket{schema="mailto",le="1"} 1
+notify_send_duration_seconds_bucket{schema="mailto",le="+Inf"} 1
+notify_send_duration_seconds_sum{schema="mailto"} 0.5
+notify_send_duration_seconds_count{schema="mailto"} 1
+notify_send_duration_seconds_bucket{schema="telegram",le="0.1"} 1
+notify_send_duration_seconds_bucket{schema="telegram",le="1"} 1
+notify_send_duration_seconds_bucket{schema="telegram",le="+Inf"} 2
+notify_send_duration_seconds_sum{schema="telegram"} 2.05
+notify_send_duration_seconds_count{schema="telegram"} 2
+`
+	assert.Equal(t, expected, rec.Body.String())
+
+	var b strings.Builder
+	n, err := m.WriteTo(&b)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(expected)), n)
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	// expvar names can't be unpublished, so every run of the test needs its own
+	name := fmt.Sprintf("notify_test_sends_%d", time.Now().UnixNano())
+	m, err := NewExpvarMetrics(name, MetricsParams{Buckets: []time.Duration{time.Second}})
+	require.NoError(t, err)
+	m.ObserveSend("slack", 200*time.Millisecond, nil)
+	m.ObserveSend("slack", 3*time.Second, markError(errors.New("too many requests"), ErrRateLimited))
+
+	var res map[string]struct {
+		Attempts  int            `json:"attempts"`
+		Successes int            `json:"successes"`
+		Failures  map[string]int `json:"failures"`
+		Latency   struct {
+			Count   int            `json:"count"`
+			Sum     float64        `json:"sum"`
+			Buckets map[string]int `json:"buckets"`
+		} `json:"latency"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get(name).String()), &res))
+	require.Contains(t, res, "slack")
+	st := res["slack"]
+	assert.Equal(t, 2, st.Attempts)
+	assert.Equal(t, 1, st.Successes)
+	assert.Equal(t, map[string]int{"rate_limited": 1}, st.Failures)
+	assert.Equal(t, 2, st.Latency.Count)
+	assert.InDelta(t, 3.2, st.Latency.Sum, 1e-9)
+	assert.Equal(t, map[string]int{"1": 1, "+Inf": 2}, st.Latency.Buckets)
+
+	_, err = NewExpvarMetrics(name, MetricsParams{})
+	require.EqualError(t, err, "expvar "+name+" is already published")
+}
+
+func TestExpvarMetrics_Concurrent(t *testing.T) {
+	name := fmt.Sprintf("notify_test_concurrent_%d", time.Now().UnixNano())
+	var wg sync.WaitGroup
+	var published atomic.Int32
+	for range 10 {
+		wg.Go(func() {
+			if _, err := NewExpvarMetrics(name, MetricsParams{}); err == nil {
+				published.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), published.Load(), "name is published once, without panic")
+}
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"runtime/debug"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Middleware wraps notifier to add behavior to its sends, like logging or timeouts
+type Middleware func(Notifier) Notifier
+
+// Chain wraps n with middlewares, the first middleware is the outermost one, i.e. it's called first on send
+func Chain(n Notifier, mws ...Middleware) Notifier {
+	for i := len(mws) - 1; i >= 0; i-- {
+		n = mws[i](n)
+	}
+	return n
+}
+
+// Wrap returns notifier running every send of n, both Send and SendMessage, through around func,
+// which calls send to deliver the message with n. The returned notifier has the same String,
+// Schema and schemes as n, and passes messages to n with SendMessage if n supports it.
+func Wrap(n Notifier, around func(ctx context.Context, destination string, send func(ctx context.Context) error) error) Notifier {
+	return &decorator{Notifier: n, around: around}
+}
+
+// Timeout returns middleware limiting the time of a single send
+func Timeout(timeout time.Duration) Middleware {
+	return func(n Notifier) Notifier {
+		return Wrap(n, func(ctx context.Context, _ string, send func(ctx context.Context) error) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return send(ctx)
+		})
+	}
+}
+
+// Logging returns middleware logging every send with its duration, successful sends with DEBUG level
+// and failed ones with WARN. Password in the destination URL is not logged.
+func Logging(l log.L) Middleware {
+	return func(n Notifier) Notifier {
+		return Wrap(n, func(ctx context.Context, destination string, send func(ctx context.Context) error) error {
+			st := time.Now()
+			err := send(ctx)
+			if err != nil {
+				l.Logf("[WARN] failed to send notification to %s with %s in %v: %v", redactDestination(destination), n, time.Since(st), err)
+				return err
+			}
+			l.Logf("[DEBUG] sent notification to %s with %s in %v", redactDestination(destination), n, time.Since(st))
+			return nil
+		})
+	}
+}
+
+// Recover returns middleware converting panic in the notifier to error, logging the stack trace
+func Recover() Middleware {
+	return func(n Notifier) Notifier {
+		return Wrap(n, func(ctx context.Context, destination string, send func(ctx context.Context) error) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("[WARN] panic in %s sending to %s: %v\n%s", n, redactDestination(destination), r, debug.Stack())
+					err = fmt.Errorf("panic in %s: %v", n, r)
+				}
+			}()
+			return send(ctx)
+		})
+	}
+}
+
+// Retry returns middleware retrying failed sends according to policy, see WithRetry
+func Retry(policy RetryPolicy) Middleware {
+	return func(n Notifier) Notifier {
+		return WithRetry(n, policy)
+	}
+}
+
+// redactDestination returns destination with the password replaced by "xxxxx", if it's a URL with the password
+func redactDestination(destination string) string {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+	if _, ok := u.User.Password(); !ok {
+		return destination
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,109 @@
+// Package notifytest provides in-process fakes of the services notify sends to, for testing code using notify:
+// Telegram Bot API, Slack Web API, SMTP server and webhook receiver, along with Recorder notifier keeping
+// all sends in memory. Fakes record what they receive and have assertion helpers for it.
+package notifytest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-pkgz/notify"
+)
+
+// Call is a send made with Recorder
+type Call struct {
+	Destination string
+	Text        string          // text of the message, text representation for SendMessage
+	Message     *notify.Message // message passed to SendMessage, nil for Send
+}
+
+// Recorder is a notifier keeping all sends in memory, for the schema it's made for
+type Recorder struct {
+	schema string
+
+	mu    sync.Mutex
+	calls []Call
+	err   error
+}
+
+// NewRecorder makes Recorder for the schema
+func NewRecorder(schema string) *Recorder {
+	return &Recorder{schema: schema}
+}
+
+// Send records the text sent to the destination, returning error set with SetError
+func (r *Recorder) Send(_ context.Context, destination, text string) error {
+	return r.record(Call{Destination: destination, Text: text})
+}
+
+// SendMessage records the message sent to the destination, returning error set with SetError
+func (r *Recorder) SendMessage(_ context.Context, destination string, msg notify.Message) error {
+	return r.record(Call{Destination: destination, Text: msg.Text(), Message: &msg})
+}
+
+// Schema returns schema the recorder is made for
+func (r *Recorder) Schema() string {
+	return r.schema
+}
+
+// String representation of Recorder
+func (r *Recorder) String() string {
+	return "recorder for " + r.schema
+}
+
+// SetError sets error returned by sends, failed sends are not recorded. Nil error makes sends succeed again.
+func (r *Recorder) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// Calls returns recorded sends, in order they were made
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Reset removes recorded sends
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// AssertSent checks that text containing the substring was sent to the destination
+func (r *Recorder) AssertSent(t testing.TB, destination, substring string) bool {
+	t.Helper()
+	calls := r.Calls()
+	for _, c := range calls {
+		if c.Destination == destination && strings.Contains(c.Text, substring) {
+			return true
+		}
+	}
+	t.Errorf("no text containing %q was sent to %s, sent: %v", substring, destination, calls)
+	return false
+}
+
+// AssertCount checks the number of recorded sends
+func (r *Recorder) AssertCount(t testing.TB, count int) bool {
+	t.Helper()
+	if calls := r.Calls(); len(calls) != count {
+		t.Errorf("expected %d sends, got %d: %v", count, len(calls), calls)
+		return false
+	}
+	return true
+}
+
+// record keeps the call, unless the error is set
+func (r *Recorder) record(c Call) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.calls = append(r.calls, c)
+	return nil
+}
@@ -0,0 +1,53 @@
+package notifytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/notify"
+)
+
+// fakeT records failures of assertion helpers
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder("test")
+	assert.Equal(t, "test", r.Schema())
+	assert.Equal(t, "recorder for test", r.String())
+
+	require.NoError(t, notify.Send(context.Background(), []notify.Notifier{r}, "test:a", "text"))
+	require.NoError(t, notify.SendMessage(context.Background(), []notify.Notifier{r}, "test:b", notify.Message{Title: "title", Body: "body"}))
+	calls := r.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, Call{Destination: "test:a", Text: "text"}, calls[0])
+	assert.Equal(t, "title\n\nbody", calls[1].Text)
+	assert.Equal(t, &notify.Message{Title: "title", Body: "body"}, calls[1].Message)
+
+	assert.True(t, r.AssertSent(t, "test:b", "body"))
+	assert.True(t, r.AssertCount(t, 2))
+	ft := &fakeT{}
+	assert.False(t, r.AssertSent(ft, "test:a", "body"))
+	assert.False(t, r.AssertCount(ft, 1))
+	assert.Len(t, ft.errors, 2)
+	assert.Contains(t, ft.errors[0], `no text containing "body" was sent to test:a`)
+
+	r.SetError(errors.New("send failed"))
+	require.EqualError(t, r.Send(context.Background(), "test:a", "text"), "send failed")
+	r.SetError(nil)
+	r.Reset()
+	assert.Empty(t, r.Calls())
+}
@@ -0,0 +1,128 @@
+package notifytest
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// SlackMessage is a message received by SlackServer
+type SlackMessage struct {
+	Channel     string // channel ID
+	Text        string
+	Attachments []SlackAttachment
+}
+
+// SlackAttachment is an attachment of SlackMessage
+type SlackAttachment struct {
+	Title     string `json:"title"`
+	TitleLink string `json:"title_link"`
+	Text      string `json:"text"`
+	Color     string `json:"color"`
+	Footer    string `json:"footer"`
+}
+
+// SlackServer is a fake Slack Web API supporting conversations.list and chat.postMessage.
+// It accepts any token and records sent messages. Messages to unknown channel IDs fail with "channel_not_found".
+//
+// Example:
+//
+//	srv := notifytest.NewSlackServer(t, map[string]string{"general": "C12345678"})
+//	s := notify.NewSlack("token", slack.OptionAPIURL(srv.APIURL()))
+type SlackServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	channels map[string]string // IDs by name
+	messages []SlackMessage
+}
+
+// NewSlackServer starts SlackServer with the channels, IDs by name, closed at the end of the test
+func NewSlackServer(t testing.TB, channels map[string]string) *SlackServer {
+	s := &SlackServer{channels: maps.Clone(channels)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /conversations.list", s.conversationsList)
+	mux.HandleFunc("POST /chat.postMessage", s.postMessage)
+	mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"ok": false, "error": "unknown_method"})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// APIURL returns URL of the server for slack.OptionAPIURL
+func (s *SlackServer) APIURL() string {
+	return s.URL + "/"
+}
+
+// Messages returns messages sent to the server, in order they were received
+func (s *SlackServer) Messages() []SlackMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SlackMessage(nil), s.messages...)
+}
+
+// AssertSent checks that the message with text or attachment text containing the substring was sent to the channel
+func (s *SlackServer) AssertSent(t testing.TB, channelID, substring string) bool {
+	t.Helper()
+	messages := s.Messages()
+	for _, m := range messages {
+		if m.Channel != channelID {
+			continue
+		}
+		if strings.Contains(m.Text, substring) {
+			return true
+		}
+		for _, a := range m.Attachments {
+			if strings.Contains(a.Title, substring) || strings.Contains(a.Text, substring) {
+				return true
+			}
+		}
+	}
+	t.Errorf("no slack message containing %q was sent to %s, sent: %+v", substring, channelID, messages)
+	return false
+}
+
+// conversationsList returns all channels on one page
+func (s *SlackServer) conversationsList(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	channels := make([]map[string]any, 0, len(s.channels))
+	for _, name := range slices.Sorted(maps.Keys(s.channels)) {
+		channels = append(channels, map[string]any{"id": s.channels[name], "name": name, "is_channel": true})
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "channels": channels, "response_metadata": map[string]any{"next_cursor": ""}})
+}
+
+// postMessage records the message sent to the known channel
+func (s *SlackServer) postMessage(w http.ResponseWriter, r *http.Request) {
+	msg := SlackMessage{Channel: r.FormValue("channel"), Text: r.FormValue("text")}
+	if attachments := r.FormValue("attachments"); attachments != "" {
+		if err := json.Unmarshal([]byte(attachments), &msg.Attachments); err != nil {
+			writeJSON(w, http.StatusOK, map[string]any{"ok": false, "error": "invalid_attachments"})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	known := strings.HasPrefix(msg.Channel, "U") // direct messages to users are accepted
+	for _, id := range s.channels {
+		known = known || id == msg.Channel
+	}
+	if known {
+		s.messages = append(s.messages, msg)
+	}
+	s.mu.Unlock()
+
+	if !known {
+		writeJSON(w, http.StatusOK, map[string]any{"ok": false, "error": "channel_not_found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "channel": msg.Channel, "ts": "1617008342.000100"})
+}
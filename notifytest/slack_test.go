@@ -0,0 +1,33 @@
+package notifytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/notify"
+)
+
+func TestSlackServer(t *testing.T) {
+	srv := NewSlackServer(t, map[string]string{"general": "C12345678", "ops": "C87654321"})
+	s := notify.NewSlack("token", slack.OptionAPIURL(srv.APIURL()))
+
+	require.NoError(t, s.Send(context.Background(), "slack:general", "hello"))
+	require.NoError(t, s.Send(context.Background(), "slack:C87654321?title=deploy&attachmentText=api", "done"))
+	require.NoError(t, s.Send(context.Background(), "slack:U12345678", "direct"))
+	require.ErrorIs(t, s.Send(context.Background(), "slack:C00000000", "unknown"), notify.ErrInvalidDestination)
+	require.ErrorIs(t, s.Send(context.Background(), "slack:random", "unknown"), notify.ErrInvalidDestination)
+
+	messages := srv.Messages()
+	require.Len(t, messages, 3)
+	assert.Equal(t, SlackMessage{Channel: "C12345678", Text: "hello"}, messages[0])
+	assert.Equal(t, []SlackAttachment{{Title: "deploy", Text: "api"}}, messages[1].Attachments)
+	assert.True(t, srv.AssertSent(t, "C87654321", "deploy"))
+	assert.True(t, srv.AssertSent(t, "U12345678", "direct"))
+	ft := &fakeT{}
+	assert.False(t, srv.AssertSent(ft, "C12345678", "done"))
+	assert.Len(t, ft.errors, 1)
+}
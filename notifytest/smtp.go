@@ -0,0 +1,240 @@
+package notifytest
+
+import (
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// SMTPMessage is a message received by SMTPServer
+type SMTPMessage struct {
+	From string   // address of MAIL command
+	To   []string // addresses of RCPT commands
+	Data string   // message with headers, as sent with DATA command
+}
+
+// Header returns the header of the message, empty if there is no such header or the message can't be parsed
+func (m SMTPMessage) Header(key string) string {
+	msg, err := mail.ReadMessage(strings.NewReader(m.Data))
+	if err != nil {
+		return ""
+	}
+	return msg.Header.Get(key)
+}
+
+// SMTPServer is a fake SMTP server capturing messages. It accepts any credentials with PLAIN
+// and LOGIN auth methods, has no TLS, and rejects recipients added with Reject.
+//
+// Example:
+//
+//	srv := notifytest.NewSMTPServer(t)
+//	e := notify.NewEmail(notify.SMTPParams{Host: srv.Host(), Port: srv.Port()})
+type SMTPServer struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []SMTPMessage
+	rejected map[string]bool
+	conns    map[net.Conn]struct{} // open connections, closed with the server
+	closed   bool
+}
+
+// NewSMTPServer starts SMTPServer on the local address, stopped at the end of the test
+func NewSMTPServer(t testing.TB) *SMTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't start smtp server: %v", err)
+	}
+	s := &SMTPServer{ln: ln, rejected: map[string]bool{}, conns: map[net.Conn]struct{}{}}
+	s.wg.Go(s.serve)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Host returns host of the server
+func (s *SMTPServer) Host() string {
+	return s.ln.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns port of the server
+func (s *SMTPServer) Port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// Close stops the server, closing open connections
+func (s *SMTPServer) Close() {
+	_ = s.ln.Close()
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Reject makes the server reject the recipient address with "550 mailbox unavailable"
+func (s *SMTPServer) Reject(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected[strings.ToLower(address)] = true
+}
+
+// Messages returns messages received by the server, in order they were received
+func (s *SMTPServer) Messages() []SMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SMTPMessage(nil), s.messages...)
+}
+
+// AssertSent checks that the message containing the substring was sent to the recipient address.
+// The substring is looked for in the data as sent, so the body encoded by the client should be matched encoded.
+func (s *SMTPServer) AssertSent(t testing.TB, address, substring string) bool {
+	t.Helper()
+	messages := s.Messages()
+	for _, m := range messages {
+		for _, to := range m.To {
+			if strings.EqualFold(to, address) && strings.Contains(m.Data, substring) {
+				return true
+			}
+		}
+	}
+	t.Errorf("no email containing %q was sent to %s, sent: %v", substring, address, messages)
+	return false
+}
+
+// serve accepts connections until the listener is closed
+func (s *SMTPServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Go(func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				_ = conn.Close()
+			}()
+			_ = conn.SetDeadline(time.Now().Add(time.Minute))
+			s.session(textproto.NewConn(conn))
+		})
+	}
+}
+
+// session runs SMTP session over the connection
+func (s *SMTPServer) session(tp *textproto.Conn) {
+	var msg SMTPMessage
+	reply := func(format string, args ...any) bool { return tp.PrintfLine(format, args...) == nil }
+	if !reply("220 localhost ESMTP notifytest") {
+		return
+	}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		ok := true
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			ok = reply("250-localhost") && reply("250-8BITMIME") && reply("250 AUTH PLAIN LOGIN")
+		case "HELO", "NOOP":
+			ok = reply("250 OK")
+		case "AUTH":
+			ok = s.auth(tp, arg)
+		case "MAIL":
+			msg = SMTPMessage{From: smtpAddress(arg)}
+			ok = reply("250 OK")
+		case "RCPT":
+			to := smtpAddress(arg)
+			s.mu.Lock()
+			rejected := s.rejected[strings.ToLower(to)]
+			s.mu.Unlock()
+			if rejected {
+				ok = reply("550 5.1.1 mailbox unavailable")
+				break
+			}
+			msg.To = append(msg.To, to)
+			ok = reply("250 OK")
+		case "DATA":
+			if len(msg.To) == 0 {
+				ok = reply("503 5.5.1 no recipients")
+				break
+			}
+			if !reply("354 end data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, e := tp.ReadDotBytes()
+			if e != nil {
+				return
+			}
+			msg.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = SMTPMessage{}
+			ok = reply("250 OK")
+		case "RSET":
+			msg = SMTPMessage{}
+			ok = reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			ok = reply("502 5.5.2 command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// auth accepts any credentials of PLAIN or LOGIN auth methods
+func (s *SMTPServer) auth(tp *textproto.Conn, arg string) bool {
+	method, initial, _ := strings.Cut(arg, " ")
+	switch strings.ToUpper(method) {
+	case "PLAIN":
+		if initial == "" {
+			if tp.PrintfLine("334 ") != nil {
+				return false
+			}
+			if _, err := tp.ReadLine(); err != nil {
+				return false
+			}
+		}
+	case "LOGIN":
+		for _, challenge := range []string{"VXNlcm5hbWU6", "UGFzc3dvcmQ6"} { // "Username:" and "Password:"
+			if tp.PrintfLine("334 %s", challenge) != nil {
+				return false
+			}
+			if _, err := tp.ReadLine(); err != nil {
+				return false
+			}
+		}
+	default:
+		return tp.PrintfLine("504 5.5.4 unrecognized authentication type") == nil
+	}
+	return tp.PrintfLine("235 2.7.0 authentication successful") == nil
+}
+
+// smtpAddress returns address from the argument of MAIL or RCPT command, like "FROM:<addr@example.org> BODY=8BITMIME"
+func smtpAddress(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
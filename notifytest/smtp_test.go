@@ -0,0 +1,42 @@
+package notifytest
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/notify"
+)
+
+func TestSMTPServer(t *testing.T) {
+	srv := NewSMTPServer(t)
+	srv.Reject("unknown@example.org")
+	addr := net.JoinHostPort(srv.Host(), strconv.Itoa(srv.Port()))
+
+	auth := smtp.PlainAuth("", "user", "password", srv.Host())
+	msg := "From: notify@example.org\r\nTo: ops@example.org\r\nSubject: disk\r\n\r\ndisk is full\r\n"
+	require.NoError(t, smtp.SendMail(addr, auth, "notify@example.org", []string{"ops@example.org"}, []byte(msg)))
+	err := smtp.SendMail(addr, nil, "notify@example.org", []string{"unknown@example.org"}, []byte(msg))
+	require.EqualError(t, err, `550 "5.1.1 mailbox unavailable"`)
+
+	messages := srv.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "notify@example.org", messages[0].From)
+	assert.Equal(t, []string{"ops@example.org"}, messages[0].To)
+	assert.Equal(t, "disk", messages[0].Header("Subject"))
+	assert.Empty(t, SMTPMessage{Data: "broken"}.Header("Subject"))
+	assert.True(t, srv.AssertSent(t, "OPS@example.org", "disk is full"))
+	ft := &fakeT{}
+	assert.False(t, srv.AssertSent(ft, "other@example.org", "disk is full"))
+	assert.Len(t, ft.errors, 1)
+
+	e := notify.NewEmail(notify.SMTPParams{Host: srv.Host(), Port: srv.Port(), Username: "user", Password: "password", LoginAuth: true})
+	require.NoError(t, e.ValidateOnline(context.Background(), "mailto:ops@example.org?from=notify@example.org"))
+	require.ErrorIs(t, e.ValidateOnline(context.Background(), "mailto:unknown@example.org"), notify.ErrInvalidDestination)
+	assert.Len(t, srv.Messages(), 1, "validation doesn't send messages")
+}
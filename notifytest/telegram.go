@@ -0,0 +1,160 @@
+package notifytest
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TelegramMessage is a message received by TelegramServer
+type TelegramMessage struct {
+	ChatID    string // chat ID or "@channel" name
+	Text      string
+	ParseMode string
+}
+
+// TelegramServer is a fake Telegram Bot API supporting getMe, sendMessage, sendDocument, getChat and getUpdates.
+// It accepts any token, records sent messages and returns scripted updates added with AddUpdate.
+//
+// Example:
+//
+//	srv := notifytest.NewTelegramServer(t)
+//	tg, err := notify.NewTelegram(notify.TelegramParams{Token: "token", APIURL: srv.APIURL()})
+type TelegramServer struct {
+	*httptest.Server
+	BotUsername string // username returned by getMe, "notify_test_bot" by default
+
+	mu       sync.Mutex
+	messages []TelegramMessage
+	updates  []telegramUpdate
+	lastID   int
+}
+
+// telegramUpdate is an update returned by getUpdates
+type telegramUpdate struct {
+	UpdateID int `json:"update_id"`
+	Message  struct {
+		Chat struct {
+			ID   int    `json:"id"`
+			Name string `json:"first_name"`
+			Type string `json:"type"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// NewTelegramServer starts TelegramServer, closed at the end of the test
+func NewTelegramServer(t testing.TB) *TelegramServer {
+	s := &TelegramServer{BotUsername: "notify_test_bot"}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// APIURL returns URL of the server for TelegramParams.APIURL
+func (s *TelegramServer) APIURL() string {
+	return s.URL + "/bot"
+}
+
+// AddUpdate adds the message from the private chat to the updates returned by getUpdates,
+// like "/start <token>" sent by the user to the bot
+func (s *TelegramServer) AddUpdate(chatID int, name, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	u := telegramUpdate{UpdateID: s.lastID}
+	u.Message.Chat.ID, u.Message.Chat.Name, u.Message.Chat.Type = chatID, name, "private"
+	u.Message.Text = text
+	s.updates = append(s.updates, u)
+}
+
+// Messages returns messages sent to the server, in order they were received
+func (s *TelegramServer) Messages() []TelegramMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]TelegramMessage(nil), s.messages...)
+}
+
+// AssertSent checks that the message containing the substring was sent to the chat
+func (s *TelegramServer) AssertSent(t testing.TB, chatID, substring string) bool {
+	t.Helper()
+	messages := s.Messages()
+	for _, m := range messages {
+		if m.ChatID == chatID && strings.Contains(m.Text, substring) {
+			return true
+		}
+	}
+	t.Errorf("no telegram message containing %q was sent to %s, sent: %v", substring, chatID, messages)
+	return false
+}
+
+// handle serves the bot API requests, "/bot<token>/<method>"
+func (s *TelegramServer) handle(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	switch method {
+	case "getMe":
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "result": map[string]any{"id": 1, "is_bot": true, "username": s.BotUsername}})
+	case "getChat":
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "result": map[string]any{"id": 1, "type": "channel"}})
+	case "sendMessage":
+		msg := TelegramMessage{ChatID: r.URL.Query().Get("chat_id"), Text: r.URL.Query().Get("text")}
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "application/json" {
+			var body struct {
+				Text      string `json:"text"`
+				ParseMode string `json:"parse_mode"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				telegramError(w, http.StatusBadRequest, "Bad Request: can't parse JSON")
+				return
+			}
+			msg.Text, msg.ParseMode = body.Text, body.ParseMode
+		}
+		s.mu.Lock()
+		s.messages = append(s.messages, msg)
+		id := len(s.messages)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "result": map[string]any{"message_id": id}})
+	case "sendDocument":
+		f, h, err := r.FormFile("document")
+		if err != nil {
+			telegramError(w, http.StatusBadRequest, "Bad Request: there is no document in the request")
+			return
+		}
+		data, _ := io.ReadAll(f)
+		s.mu.Lock()
+		s.messages = append(s.messages, TelegramMessage{ChatID: r.FormValue("chat_id"), Text: h.Filename + ":" + string(data)})
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "result": map[string]any{}})
+	case "getUpdates":
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		res := []telegramUpdate{}
+		s.mu.Lock()
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				res = append(res, u)
+			}
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "result": res})
+	default:
+		telegramError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// telegramError writes error response of the bot API
+func telegramError(w http.ResponseWriter, code int, description string) {
+	writeJSON(w, code, map[string]any{"ok": false, "error_code": code, "description": description})
+}
+
+// writeJSON writes response with the value encoded to JSON
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,66 @@
+package notifytest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/notify"
+)
+
+func TestTelegramServer(t *testing.T) {
+	srv := NewTelegramServer(t)
+	tg, err := notify.NewTelegram(notify.TelegramParams{Token: "token", APIURL: srv.APIURL()})
+	require.NoError(t, err)
+	assert.Equal(t, "notify_test_bot", tg.GetBotUsername())
+
+	require.NoError(t, tg.Send(context.Background(), "telegram:ops?parseMode=HTML", "<b>deployed</b>"))
+	require.NoError(t, tg.SendMessage(context.Background(), "telegram:-1001480738202", notify.Message{
+		Title: "disk", Body: "is full", Attachments: []notify.Attachment{{Name: "df.txt", Data: []byte("100%")}},
+	}))
+	require.NoError(t, tg.ValidateOnline(context.Background(), "telegram:ops"))
+
+	messages := srv.Messages()
+	require.Len(t, messages, 3)
+	assert.Equal(t, TelegramMessage{ChatID: "@ops", Text: "<b>deployed</b>", ParseMode: "HTML"}, messages[0])
+	assert.True(t, srv.AssertSent(t, "-1001480738202", "is full"))
+	assert.True(t, srv.AssertSent(t, "-1001480738202", "df.txt:100%"))
+	ft := &fakeT{}
+	assert.False(t, srv.AssertSent(ft, "@ops", "is full"))
+	assert.Len(t, ft.errors, 1)
+}
+
+func TestTelegramServer_Updates(t *testing.T) {
+	srv := NewTelegramServer(t)
+	tg, err := notify.NewTelegram(notify.TelegramParams{Token: "token", APIURL: srv.APIURL(), SuccessMsg: "welcome"})
+	require.NoError(t, err)
+	tg.AddToken("login-token", "user", "site", time.Now().Add(time.Minute))
+
+	srv.AddUpdate(42, "John", "/start login-token")
+	resp, err := http.Get(srv.APIURL() + "token/getUpdates") //nolint:noctx // simple test call
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	updates, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, tg.ProcessUpdate(context.Background(), string(updates)))
+
+	chatID, site, err := tg.CheckToken("login-token", "user")
+	require.NoError(t, err)
+	assert.Equal(t, "42", chatID)
+	assert.Equal(t, "site", site)
+	assert.True(t, srv.AssertSent(t, "42", "welcome"))
+
+	resp, err = http.Get(srv.APIURL() + "token/getUpdates?offset=2") //nolint:noctx // simple test call
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	updates, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ok": true, "result": []}`, string(updates), "updates before the offset are not returned")
+
+	require.Error(t, tg.Request(context.Background(), "unknownMethod", nil, &struct{}{}))
+}
@@ -0,0 +1,82 @@
+package notifytest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// WebhookRequest is a request received by WebhookReceiver
+type WebhookRequest struct {
+	Method string
+	Path   string // path with query
+	Header http.Header
+	Body   string
+}
+
+// WebhookReceiver is a fake webhook endpoint recording requests, responding with the status set with SetStatus,
+// 200 OK by default.
+//
+// Example:
+//
+//	srv := notifytest.NewWebhookReceiver(t)
+//	err := notify.NewWebhook(notify.WebhookParams{}).Send(ctx, srv.URL+"/hook", "text")
+type WebhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []WebhookRequest
+	status   int
+}
+
+// NewWebhookReceiver starts WebhookReceiver, closed at the end of the test
+func NewWebhookReceiver(t testing.TB) *WebhookReceiver {
+	s := &WebhookReceiver{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// SetStatus sets status code of the responses, requests are recorded with any status
+func (s *WebhookReceiver) SetStatus(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = code
+}
+
+// Requests returns received requests, in order they were received
+func (s *WebhookReceiver) Requests() []WebhookRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]WebhookRequest(nil), s.requests...)
+}
+
+// AssertReceived checks that the request with the body containing the substring was received at the path
+func (s *WebhookReceiver) AssertReceived(t testing.TB, path, substring string) bool {
+	t.Helper()
+	requests := s.Requests()
+	for _, r := range requests {
+		if strings.Split(r.Path, "?")[0] == path && strings.Contains(r.Body, substring) {
+			return true
+		}
+	}
+	t.Errorf("no webhook request containing %q was received at %s, received: %v", substring, path, requests)
+	return false
+}
+
+// handle records the request
+func (s *WebhookReceiver) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, WebhookRequest{Method: r.Method, Path: r.URL.RequestURI(), Header: r.Header.Clone(), Body: string(body)})
+	status := s.status
+	s.mu.Unlock()
+	w.WriteHeader(status)
+}
@@ -0,0 +1,35 @@
+package notifytest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/notify"
+)
+
+func TestWebhookReceiver(t *testing.T) {
+	srv := NewWebhookReceiver(t)
+	wh := notify.NewWebhook(notify.WebhookParams{Headers: []string{"X-Token:secret"}})
+
+	require.NoError(t, wh.Send(context.Background(), srv.URL+"/hook?id=1", "text"))
+	require.NoError(t, wh.SendMessage(context.Background(), srv.URL+"/message", notify.Message{Title: "disk", Body: "is full"}))
+
+	requests := srv.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "POST", requests[0].Method)
+	assert.Equal(t, "/hook?id=1", requests[0].Path)
+	assert.Equal(t, "secret", requests[0].Header.Get("X-Token"))
+	assert.Equal(t, "text", requests[0].Body)
+	assert.True(t, srv.AssertReceived(t, "/message", `"title":"disk"`))
+	ft := &fakeT{}
+	assert.False(t, srv.AssertReceived(ft, "/hook", "disk"))
+	assert.Len(t, ft.errors, 1)
+
+	srv.SetStatus(http.StatusServiceUnavailable)
+	require.ErrorContains(t, wh.Send(context.Background(), srv.URL+"/hook", "text"), "503")
+	assert.Len(t, srv.Requests(), 3, "requests are recorded with any status")
+}
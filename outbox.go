@@ -0,0 +1,313 @@
+package notify
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Outbox persists messages queued by Dispatcher until they are sent,
+// so the messages queued before the restart of the process are sent after it
+type Outbox interface {
+	Add(d Delivery) (id string, err error) // persists the message, returns its identifier
+	Ack(id string) error                   // removes the message, once it's processed
+	Pending() ([]Delivery, error)          // returns messages added and not acknowledged, in the order they were added
+}
+
+const (
+	outboxSegmentPrefix  = "outbox-"
+	outboxSegmentSuffix  = ".log"
+	outboxMaxSegmentSize = 4 * 1024 * 1024
+)
+
+// FileOutboxParams contain settings for FileOutbox
+type FileOutboxParams struct {
+	Dir            string // directory for the segment files, created if doesn't exist
+	MaxSegmentSize int64  // size of the segment file after which the next one is started, 4MB by default
+}
+
+// FileOutbox is Outbox keeping messages in append-only segment files on local disk.
+// Every record is synced to disk before Add or Ack return. When the segment grows over MaxSegmentSize,
+// the pending messages are copied to the new segment and the old ones are removed.
+type FileOutbox struct {
+	FileOutboxParams
+
+	mu          sync.Mutex
+	pending     map[string]outboxRecord // pending messages by id
+	seq         int                     // number of the current segment
+	segment     *os.File                // current segment, records are appended to it
+	size        int64                   // size of the current segment
+	compactSize int64                   // size of pending messages copied to the current segment on its start
+	order       int64                   // order of the last added message
+}
+
+// outboxRecord is a line of the segment file
+type outboxRecord struct {
+	Op            string    `json:"op"` // "add" or "ack"
+	ID            string    `json:"id"`
+	Destination   string    `json:"destination,omitempty"`
+	Text          string    `json:"text,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Time          time.Time `json:"time,omitzero"`
+
+	order int64 // order in which messages were added, to return pending messages in the same order
+}
+
+// NewFileOutbox makes FileOutbox in provided directory, loading messages pending in it
+func NewFileOutbox(params FileOutboxParams) (*FileOutbox, error) {
+	res := &FileOutbox{FileOutboxParams: params, pending: map[string]outboxRecord{}}
+	if res.MaxSegmentSize <= 0 {
+		res.MaxSegmentSize = outboxMaxSegmentSize
+	}
+	if err := os.MkdirAll(res.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("can't create outbox directory: %w", err)
+	}
+
+	segments, err := res.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range segments {
+		if err = res.load(seq); err != nil {
+			return nil, err
+		}
+		res.seq = seq
+	}
+
+	// start with a fresh segment, which also drops a partially written record left by the crash, if any
+	if err = res.compact(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Add persists the message
+func (o *FileOutbox) Add(d Delivery) (string, error) {
+	id, err := newOutboxID()
+	if err != nil {
+		return "", err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	rec := outboxRecord{Op: "add", ID: id, Destination: d.Destination, Text: d.Text, CorrelationID: d.CorrelationID, Time: time.Now()}
+	if err = o.write(rec); err != nil {
+		return "", err
+	}
+	o.order++
+	rec.order = o.order
+	o.pending[id] = rec
+	return id, nil
+}
+
+// Ack removes the message, unknown identifiers are ignored
+func (o *FileOutbox) Ack(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.pending[id]; !ok {
+		return nil
+	}
+	if err := o.write(outboxRecord{Op: "ack", ID: id}); err != nil {
+		return err
+	}
+	delete(o.pending, id)
+	return nil
+}
+
+// Pending returns messages added and not acknowledged yet, in the order they were added
+func (o *FileOutbox) Pending() ([]Delivery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	records := o.sortedPending()
+	res := make([]Delivery, 0, len(records))
+	for _, rec := range records {
+		res = append(res, Delivery{ID: rec.ID, Destination: rec.Destination, Text: rec.Text, CorrelationID: rec.CorrelationID})
+	}
+	return res, nil
+}
+
+// Close closes the current segment file
+func (o *FileOutbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.segment.Close()
+}
+
+// write appends the record to the current segment and syncs it to disk, starting the new segment if needed
+func (o *FileOutbox) write(rec outboxRecord) error {
+	if o.size-o.compactSize >= o.MaxSegmentSize {
+		if err := o.compact(); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("can't encode outbox record: %w", err)
+	}
+	b = append(b, '\n')
+	if _, err = o.segment.Write(b); err != nil {
+		return fmt.Errorf("can't write outbox record: %w", err)
+	}
+	if err = o.segment.Sync(); err != nil {
+		return fmt.Errorf("can't sync outbox segment: %w", err)
+	}
+	o.size += int64(len(b))
+	return nil
+}
+
+// compact starts the new segment with all pending messages and removes the previous segments
+func (o *FileOutbox) compact() error {
+	seq := o.seq + 1
+	path := o.segmentPath(seq)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600) //nolint:gosec // path is built from the configured dir
+	if err != nil {
+		return fmt.Errorf("can't create outbox segment: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	var size int64
+	for _, rec := range o.sortedPending() {
+		b, e := json.Marshal(rec)
+		if e != nil {
+			_ = f.Close()
+			return fmt.Errorf("can't encode outbox record: %w", e)
+		}
+		n, _ := w.Write(append(b, '\n'))
+		size += int64(n)
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = syncDir(o.Dir)
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("can't write outbox segment: %w", err)
+	}
+
+	// new segment is on disk, the previous ones are not needed anymore
+	if o.segment != nil {
+		_ = o.segment.Close()
+	}
+	segments, err := o.segments()
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if s < seq {
+			if e := os.Remove(o.segmentPath(s)); e != nil {
+				log.Printf("[WARN] can't remove outbox segment %s: %v", o.segmentPath(s), e)
+			}
+		}
+	}
+
+	o.seq, o.segment, o.size, o.compactSize = seq, f, size, size
+	return nil
+}
+
+// load reads records of the segment into pending messages
+func (o *FileOutbox) load(seq int) error {
+	data, err := os.ReadFile(o.segmentPath(seq))
+	if err != nil {
+		return fmt.Errorf("can't read outbox segment: %w", err)
+	}
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		var rec outboxRecord
+		if err = json.Unmarshal([]byte(line), &rec); err != nil {
+			// record is partially written if the process crashed in the middle of the write
+			log.Printf("[WARN] skip broken record %d in outbox segment %s: %v", i+1, o.segmentPath(seq), err)
+			continue
+		}
+		switch rec.Op {
+		case "add":
+			if _, ok := o.pending[rec.ID]; ok {
+				continue // copied to the next segment by compaction which was interrupted before the removal of this one
+			}
+			o.order++
+			rec.order = o.order
+			o.pending[rec.ID] = rec
+		case "ack":
+			delete(o.pending, rec.ID)
+		}
+	}
+	return nil
+}
+
+// segments returns sorted numbers of the segment files in the directory
+func (o *FileOutbox) segments() ([]int, error) {
+	entries, err := os.ReadDir(o.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read outbox directory: %w", err)
+	}
+	var res []int
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, outboxSegmentPrefix) || !strings.HasSuffix(name, outboxSegmentSuffix) {
+			continue
+		}
+		seq, e := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, outboxSegmentPrefix), outboxSegmentSuffix))
+		if e != nil {
+			continue
+		}
+		res = append(res, seq)
+	}
+	sort.Ints(res)
+	return res, nil
+}
+
+func (o *FileOutbox) segmentPath(seq int) string {
+	return filepath.Join(o.Dir, fmt.Sprintf("%s%08d%s", outboxSegmentPrefix, seq, outboxSegmentSuffix))
+}
+
+func (o *FileOutbox) sortedPending() []outboxRecord {
+	res := make([]outboxRecord, 0, len(o.pending))
+	for _, rec := range o.pending {
+		res = append(res, rec)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].order < res[j].order })
+	return res
+}
+
+// syncDir syncs the directory, so that the files created in it survive the crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir) //nolint:gosec // dir is the configured outbox directory
+	if err != nil {
+		return err
+	}
+	if err = d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		_ = d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// newOutboxID returns random identifier for the outbox message
+func newOutboxID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can't generate outbox id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
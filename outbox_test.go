@@ -0,0 +1,275 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileOutbox(t *testing.T) {
+	dir := t.TempDir()
+	o, err := NewFileOutbox(FileOutboxParams{Dir: dir})
+	require.NoError(t, err)
+
+	var ids []string
+	for _, text := range []string{"1", "2", "3"} {
+		id, e := o.Add(Delivery{Destination: "test:dst", Text: text})
+		require.NoError(t, e)
+		require.NotEmpty(t, id)
+		ids = append(ids, id)
+	}
+	require.NoError(t, o.Ack(ids[1]))
+	require.NoError(t, o.Ack("unknown"), "unknown id is ignored")
+
+	pending, err := o.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, []Delivery{{ID: ids[0], Destination: "test:dst", Text: "1"}, {ID: ids[2], Destination: "test:dst", Text: "3"}}, pending)
+	require.NoError(t, o.Close())
+
+	// reopened outbox has the same pending messages
+	o, err = NewFileOutbox(FileOutboxParams{Dir: dir})
+	require.NoError(t, err)
+	reopened, err := o.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, pending, reopened)
+	require.NoError(t, o.Ack(ids[0]))
+	require.NoError(t, o.Close())
+
+	o, err = NewFileOutbox(FileOutboxParams{Dir: dir})
+	require.NoError(t, err)
+	defer o.Close()
+	reopened, err = o.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, []Delivery{{ID: ids[2], Destination: "test:dst", Text: "3"}}, reopened)
+
+	files, err := filepath.Glob(filepath.Join(dir, "outbox-*.log"))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "previous segments are removed on open")
+}
+
+func TestFileOutbox_Compaction(t *testing.T) {
+	dir := t.TempDir()
+	o, err := NewFileOutbox(FileOutboxParams{Dir: dir, MaxSegmentSize: 512})
+	require.NoError(t, err)
+
+	var last string
+	for range 100 {
+		id, e := o.Add(Delivery{Destination: "test:dst", Text: "some text"})
+		require.NoError(t, e)
+		require.NoError(t, o.Ack(id))
+		last = id
+	}
+	_, err = o.Add(Delivery{Destination: "test:dst", Text: "pending"})
+	require.NoError(t, err)
+	require.NoError(t, o.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "outbox-*.log"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	st, err := os.Stat(files[0])
+	require.NoError(t, err)
+	assert.Less(t, st.Size(), int64(1024), "acknowledged messages are dropped from the segment")
+
+	o, err = NewFileOutbox(FileOutboxParams{Dir: dir, MaxSegmentSize: 512})
+	require.NoError(t, err)
+	defer o.Close()
+	pending, err := o.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "pending", pending[0].Text)
+	assert.NotEqual(t, last, pending[0].ID)
+}
+
+func TestFileOutbox_BrokenRecord(t *testing.T) {
+	dir := t.TempDir()
+	o, err := NewFileOutbox(FileOutboxParams{Dir: dir})
+	require.NoError(t, err)
+	id, err := o.Add(Delivery{Destination: "test:dst", Text: "saved"})
+	require.NoError(t, err)
+	require.NoError(t, o.Close())
+
+	// simulate crash in the middle of the write
+	f, err := os.OpenFile(o.segmentPath(o.seq), os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"add","id":"abc","destination":"te`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	o, err = NewFileOutbox(FileOutboxParams{Dir: dir})
+	require.NoError(t, err)
+	defer o.Close()
+	pending, err := o.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, []Delivery{{ID: id, Destination: "test:dst", Text: "saved"}}, pending)
+
+	// new records are written after the broken one is dropped
+	_, err = o.Add(Delivery{Destination: "test:dst", Text: "next"})
+	require.NoError(t, err)
+	pending, err = o.Pending()
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+}
+
+func TestFileOutbox_InterruptedCompaction(t *testing.T) {
+	dir := t.TempDir()
+	o, err := NewFileOutbox(FileOutboxParams{Dir: dir})
+	require.NoError(t, err)
+	id, err := o.Add(Delivery{Destination: "test:dst", Text: "saved"})
+	require.NoError(t, err)
+	old := o.segmentPath(o.seq)
+	data, err := os.ReadFile(old)
+	require.NoError(t, err)
+	require.NoError(t, o.Close())
+
+	// the next segment got the copy of pending message, but the old one wasn't removed
+	require.NoError(t, os.WriteFile(o.segmentPath(o.seq+1), data, 0o600))
+
+	o, err = NewFileOutbox(FileOutboxParams{Dir: dir})
+	require.NoError(t, err)
+	defer o.Close()
+	pending, err := o.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, []Delivery{{ID: id, Destination: "test:dst", Text: "saved"}}, pending)
+}
+
+func TestDispatcher_Outbox(t *testing.T) {
+	dir := t.TempDir()
+	o, err := NewFileOutbox(FileOutboxParams{Dir: dir})
+	require.NoError(t, err)
+
+	// the first run is shut down while the delivery is stuck
+	started := make(chan struct{}, 1)
+	stuck := funcNotifier(func(ctx context.Context, _, _ string) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	d, err := NewDispatcher([]Notifier{stuck}, DispatcherParams{OnError: func(Delivery, error) {}, Outbox: o})
+	require.NoError(t, err)
+	for _, text := range []string{"1", "2", "3"} {
+		require.NoError(t, d.Send(context.Background(), "test:dst", text))
+	}
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	require.ErrorIs(t, d.Shutdown(ctx), context.DeadlineExceeded)
+	require.NoError(t, o.Close())
+
+	// the second run delivers the messages left in the outbox
+	o, err = NewFileOutbox(FileOutboxParams{Dir: dir})
+	require.NoError(t, err)
+	defer o.Close()
+	var mu sync.Mutex
+	var sent []string
+	n := funcNotifier(func(_ context.Context, _, text string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, text)
+		if text == "2" {
+			return errors.New("send failed")
+		}
+		return nil
+	})
+	f := &failures{}
+	d, err = NewDispatcher([]Notifier{n}, DispatcherParams{OnError: f.add, Outbox: o})
+	require.NoError(t, err)
+	require.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, []string{"1", "2", "3"}, sent)
+	assert.Equal(t, []string{"2: send failed"}, f.get())
+
+	pending, err := o.Pending()
+	require.NoError(t, err)
+	assert.Empty(t, pending, "processed messages are removed from the outbox, failed ones too")
+}
+
+func TestDispatcher_OutboxOverQueueSize(t *testing.T) {
+	o, err := NewFileOutbox(FileOutboxParams{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer o.Close()
+	for _, text := range []string{"1", "2", "3", "4", "5"} {
+		_, err = o.Add(Delivery{Destination: "test:dst", Text: text})
+		require.NoError(t, err)
+	}
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var sent []string
+	n := funcNotifier(func(_ context.Context, _, text string) error {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, text)
+		return nil
+	})
+
+	created := make(chan *Dispatcher)
+	go func() {
+		d, e := NewDispatcher([]Notifier{n}, DispatcherParams{QueueSize: 2, Outbox: o})
+		assert.NoError(t, e)
+		created <- d
+	}()
+	var d *Dispatcher
+	select {
+	case d = <-created:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatcher is not created while deliveries are stuck")
+	}
+	assert.Equal(t, 2, cap(d.queue), "queue keeps its size")
+	close(release)
+	require.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, sent)
+}
+
+func TestDispatcher_OutboxReplayInterrupted(t *testing.T) {
+	o, err := NewFileOutbox(FileOutboxParams{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer o.Close()
+	for _, text := range []string{"1", "2", "3", "4", "5"} {
+		_, err = o.Add(Delivery{Destination: "test:dst", Text: text})
+		require.NoError(t, err)
+	}
+
+	started := make(chan struct{}, 1)
+	stuck := funcNotifier(func(ctx context.Context, _, _ string) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	f := &failures{}
+	d, err := NewDispatcher([]Notifier{stuck}, DispatcherParams{QueueSize: 1, OnError: f.add, Outbox: o})
+	require.NoError(t, err)
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	require.ErrorIs(t, d.Shutdown(ctx), context.DeadlineExceeded)
+	assert.ElementsMatch(t, []string{"1: context canceled", "2: dispatcher is shut down", "3: dispatcher is shut down",
+		"4: dispatcher is shut down", "5: dispatcher is shut down"}, f.get(), "messages not queued yet are reported too")
+
+	pending, err := o.Pending()
+	require.NoError(t, err)
+	assert.Len(t, pending, 5, "interrupted messages stay in the outbox")
+}
+
+func TestDispatcher_OutboxRejected(t *testing.T) {
+	o, err := NewFileOutbox(FileOutboxParams{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer o.Close()
+
+	d, err := NewDispatcher([]Notifier{funcNotifier(func(context.Context, string, string) error { return nil })},
+		DispatcherParams{Outbox: o})
+	require.NoError(t, err)
+	require.NoError(t, d.Shutdown(context.Background()))
+	require.ErrorIs(t, d.Send(context.Background(), "test:dst", "late"), ErrDispatcherClosed)
+	require.Error(t, d.Send(context.Background(), "slack:dst", "unsupported"))
+
+	pending, err := o.Pending()
+	require.NoError(t, err)
+	assert.Empty(t, pending, "rejected messages are not kept in the outbox")
+}
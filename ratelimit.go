@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate is a limit of sends: one send every Every on average, with up to Burst sends at once.
+// Zero Every means no limit.
+type Rate struct {
+	Every time.Duration // minimal average interval between sends
+	Burst int           // max number of sends at once, 1 by default
+}
+
+// RateLimit defines limits for WithRateLimit
+type RateLimit struct {
+	Global         Rate                            // limit of all sends
+	PerDestination Rate                            // limit of sends to each destination
+	Key            func(destination string) string // key of the destination for PerDestination limit, destination without query by default
+	FailFast       bool                            // fail with ErrRateLimited instead of waiting when the limit is reached
+}
+
+// perDestinationCleanupSize is the number of per-destination buckets after which the idle ones are removed
+const perDestinationCleanupSize = 1000
+
+// WithRateLimit returns notifier limiting sends of n with token buckets: the global one for all sends,
+// and one for every destination. Send waits until the limits allow it, unless FailFast is set or ctx deadline
+// comes before that: then it fails with error matching ErrRateLimited right away without sending.
+//
+// Telegram, Slack and Webhook provide limits suitable for them with DefaultRateLimit.
+func WithRateLimit(n Notifier, limit RateLimit) Notifier {
+	if limit.Key == nil {
+		limit.Key = destinationWithoutQuery
+	}
+	l := &rateLimiter{RateLimit: limit, global: newTokenBucket(limit.Global), buckets: map[string]*tokenBucket{}}
+	return &decorator{Notifier: n, around: l.around}
+}
+
+// rateLimiter keeps token buckets of WithRateLimit
+type rateLimiter struct {
+	RateLimit
+	mu      sync.Mutex
+	global  *tokenBucket
+	buckets map[string]*tokenBucket // per-destination buckets by destination key
+}
+
+// around waits until the limits allow the send and calls it, with the context letting the notifier
+// wait for the limits before every other message it makes for the send, see waitRateLimit
+func (l *rateLimiter) around(ctx context.Context, destination string, send func(ctx context.Context) error) error {
+	if err := l.wait(ctx, destination, l.FailFast); err != nil {
+		return err
+	}
+	outer, _ := ctx.Value(rateLimitKey{}).(func(context.Context) error)
+	return send(context.WithValue(ctx, rateLimitKey{}, func(ctx context.Context) error {
+		if outer != nil {
+			if err := outer(ctx); err != nil {
+				return err
+			}
+		}
+		// the send is started already, so the rest of its messages wait for their turn even with FailFast
+		return l.wait(ctx, destination, false)
+	}))
+}
+
+// wait waits until the limits allow the send to the destination
+func (l *rateLimiter) wait(ctx context.Context, destination string, failFast bool) error {
+	wait, cancel := l.reserve(l.Key(destination), time.Now())
+	if wait <= 0 {
+		return nil
+	}
+
+	deadline, ok := ctx.Deadline()
+	if failFast || (ok && time.Until(deadline) < wait) {
+		cancel()
+		return markError(fmt.Errorf("rate limit for %s is reached, next send is allowed in %v", redactDestination(destination), wait), ErrRateLimited)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rateLimitKey is the context key of the func waiting for the limits of WithRateLimit the send is made with
+type rateLimitKey struct{}
+
+// waitRateLimit waits until the limits of WithRateLimit the send is made with allow one more message
+// to the destination, for notifiers making several messages for a single send, like parts of the long text.
+// It returns right away if the send is not limited.
+func waitRateLimit(ctx context.Context) error {
+	if wait, ok := ctx.Value(rateLimitKey{}).(func(context.Context) error); ok {
+		return wait(ctx)
+	}
+	return nil
+}
+
+// reserve takes tokens for the send from the global and the destination buckets, and returns
+// how long to wait for them, and func to return the tokens if the send is not made
+func (l *rateLimiter) reserve(key string, now time.Time) (wait time.Duration, cancel func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buckets) >= perDestinationCleanupSize {
+		for k, b := range l.buckets {
+			if b.idle(now) {
+				delete(l.buckets, k)
+			}
+		}
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(l.PerDestination)
+		if l.PerDestination.Every > 0 {
+			l.buckets[key] = bucket // buckets without limit are not kept
+		}
+	}
+
+	wait = max(l.global.take(now), bucket.take(now))
+	return wait, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.global.giveBack()
+		bucket.giveBack()
+	}
+}
+
+// tokenBucket allows sends at the rate, with tokens going below zero for sends waiting for their turn
+type tokenBucket struct {
+	rate   Rate
+	tokens float64
+	last   time.Time // time tokens were updated
+}
+
+func newTokenBucket(rate Rate) *tokenBucket {
+	if rate.Burst <= 0 {
+		rate.Burst = 1
+	}
+	return &tokenBucket{rate: rate, tokens: float64(rate.Burst)}
+}
+
+// take takes a token and returns how long to wait for it to become available
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	if b.rate.Every <= 0 {
+		return 0
+	}
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(b.rate.Every))
+}
+
+// giveBack returns the token taken for the send which wasn't made
+func (b *tokenBucket) giveBack() {
+	if b.rate.Every <= 0 {
+		return
+	}
+	b.tokens = min(b.tokens+1, float64(b.rate.Burst))
+}
+
+// idle reports whether the bucket is full, so it's the same as the new one
+func (b *tokenBucket) idle(now time.Time) bool {
+	if b.rate.Every <= 0 {
+		return true
+	}
+	b.refill(now)
+	return b.tokens >= float64(b.rate.Burst)
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = min(b.tokens+float64(now.Sub(b.last))/float64(b.rate.Every), float64(b.rate.Burst))
+	}
+	b.last = now
+}
+
+// destinationWithoutQuery is the default key of the destination for rate limiting, destination without query params
+func destinationWithoutQuery(destination string) string {
+	if i := strings.IndexByte(destination, '?'); i >= 0 {
+		return destination[:i]
+	}
+	return destination
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	l := &rateLimiter{
+		RateLimit: RateLimit{Global: Rate{Every: time.Second, Burst: 3}, PerDestination: Rate{Every: time.Second * 2}, Key: destinationWithoutQuery},
+		global:    newTokenBucket(Rate{Every: time.Second, Burst: 3}),
+		buckets:   map[string]*tokenBucket{},
+	}
+	now := time.Now()
+	wait, _ := l.reserve("a", now)
+	assert.Equal(t, time.Duration(0), wait)
+	wait, _ = l.reserve("b", now)
+	assert.Equal(t, time.Duration(0), wait, "other destination has its own bucket")
+	wait, cancel := l.reserve("a", now)
+	assert.Equal(t, time.Second*2, wait, "destination limit")
+	cancel()
+	wait, _ = l.reserve("c", now)
+	assert.Equal(t, time.Duration(0), wait, "token is returned to the global bucket on cancel")
+	wait, _ = l.reserve("d", now)
+	assert.Equal(t, time.Second, wait, "global limit")
+
+	wait, _ = l.reserve("a", now.Add(time.Second*2))
+	assert.Equal(t, time.Duration(0), wait, "tokens are refilled with time")
+}
+
+func TestWithRateLimit(t *testing.T) {
+	var sent atomic.Int32
+	n := funcNotifier(func(context.Context, string, string) error {
+		sent.Add(1)
+		return nil
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		rl := WithRateLimit(n, RateLimit{PerDestination: Rate{Every: time.Millisecond * 50}})
+		st := time.Now()
+		require.NoError(t, rl.Send(context.Background(), "test:a?param=1", "1"))
+		require.NoError(t, rl.Send(context.Background(), "test:b", "1"))
+		assert.Less(t, time.Since(st), time.Millisecond*50, "different destinations are not limited")
+		require.NoError(t, rl.Send(context.Background(), "test:a?param=2", "2"))
+		assert.GreaterOrEqual(t, time.Since(st), time.Millisecond*40, "the same destination waits")
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		sent.Store(0)
+		rl := WithRateLimit(n, RateLimit{Global: Rate{Every: time.Minute}, FailFast: true})
+		require.NoError(t, rl.Send(context.Background(), "test:a", "1"))
+		err := rl.Send(context.Background(), "test:b", "2")
+		require.ErrorIs(t, err, ErrRateLimited)
+		assert.Contains(t, err.Error(), "rate limit for test:b is reached, next send is allowed in ")
+		assert.Equal(t, int32(1), sent.Load())
+	})
+
+	t.Run("deadline before the turn", func(t *testing.T) {
+		rl := WithRateLimit(n, RateLimit{Global: Rate{Every: time.Minute}})
+		require.NoError(t, rl.Send(context.Background(), "test:a", "1"))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		st := time.Now()
+		require.ErrorIs(t, rl.Send(ctx, "test:a", "2"), ErrRateLimited)
+		assert.Less(t, time.Since(st), time.Millisecond*500, "fails without waiting for the deadline")
+	})
+
+	t.Run("canceled while waiting", func(t *testing.T) {
+		rl := WithRateLimit(n, RateLimit{Global: Rate{Every: time.Minute}})
+		require.NoError(t, rl.Send(context.Background(), "test:a", "1"))
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(time.Millisecond*10, cancel)
+		require.ErrorIs(t, rl.Send(ctx, "test:a", "2"), context.Canceled)
+	})
+}
+
+func TestWithRateLimit_MessagesOfSend(t *testing.T) {
+	var sent []time.Time
+	// notifier making three messages for a single send, like parts of the long text
+	n := funcNotifier(func(ctx context.Context, _, _ string) error {
+		for i := range 3 {
+			if i > 0 {
+				if err := waitRateLimit(ctx); err != nil {
+					return err
+				}
+			}
+			sent = append(sent, time.Now())
+		}
+		return nil
+	})
+	require.NoError(t, waitRateLimit(context.Background()), "no limit")
+
+	rl := WithRateLimit(n, RateLimit{PerDestination: Rate{Every: time.Millisecond * 50}, FailFast: true})
+	st := time.Now()
+	require.NoError(t, rl.Send(context.Background(), "test:a", "text"), "messages of the started send wait even with FailFast")
+	require.Len(t, sent, 3)
+	assert.GreaterOrEqual(t, sent[2].Sub(st), time.Millisecond*90, "every message counts against the limit")
+	require.ErrorIs(t, rl.Send(context.Background(), "test:a", "text"), ErrRateLimited, "next send waits for all messages of the previous one")
+
+	// nested limits are all applied
+	sent = nil
+	rl = WithRateLimit(WithRateLimit(n, RateLimit{}), RateLimit{Global: Rate{Every: time.Millisecond * 50}})
+	st = time.Now()
+	require.NoError(t, rl.Send(context.Background(), "test:a", "text"))
+	assert.GreaterOrEqual(t, sent[2].Sub(st), time.Millisecond*90, "limit of the outer decorator")
+}
+
+func TestRateLimiter_Cleanup(t *testing.T) {
+	l := &rateLimiter{RateLimit: RateLimit{PerDestination: Rate{Every: time.Second}}, global: newTokenBucket(Rate{}), buckets: map[string]*tokenBucket{}}
+	now := time.Now()
+	for i := range perDestinationCleanupSize {
+		l.reserve(strconv.Itoa(i), now)
+	}
+	assert.Len(t, l.buckets, perDestinationCleanupSize)
+	l.reserve("new", now.Add(time.Second))
+	assert.Len(t, l.buckets, 1, "idle buckets are removed")
+
+	l = &rateLimiter{RateLimit: RateLimit{Global: Rate{Every: time.Second}}, global: newTokenBucket(Rate{Every: time.Second}), buckets: map[string]*tokenBucket{}}
+	l.reserve("a", now)
+	assert.Empty(t, l.buckets, "no buckets without per-destination limit")
+}
+
+func TestDefaultRateLimit(t *testing.T) {
+	tg := &Telegram{}
+	limit := tg.DefaultRateLimit()
+	assert.Equal(t, Rate{Every: time.Second / 30, Burst: 30}, limit.Global)
+	assert.Equal(t, "@channel", limit.Key("telegram:channel?parseMode=HTML"))
+	assert.Equal(t, "-1001480738202", limit.Key("telegram:-1001480738202"))
+
+	limit = (&Slack{}).DefaultRateLimit()
+	assert.Equal(t, "general", limit.Key("slack:general?title=test"))
+
+	limit = NewWebhook(WebhookParams{}).DefaultRateLimit()
+	assert.Equal(t, "example.org", limit.Key("https://example.org/hook?id=1"))
+	assert.Equal(t, "%", limit.Key("%"))
+}
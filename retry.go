@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/go-pkgz/repeater/v2"
+)
+
+// permanentError marks error which can't be fixed by retrying the send
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as permanent, so the send failed with it is not retried: for example,
+// when the destination is malformed or the service rejected the request as invalid.
+// Errors which are not marked are considered temporary. Permanent returns nil for nil error.
+func Permanent(err error) error {
+	if err == nil || IsPermanent(err) {
+		return err
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err or any error it wraps is marked by Permanent
+func IsPermanent(err error) bool {
+	var pErr *permanentError
+	return errors.As(err, &pErr)
+}
+
+// RetryPolicy defines how WithRetry retries failed sends
+type RetryPolicy struct {
+	Attempts   int                  // max number of attempts, including the first one, 3 by default
+	Delay      time.Duration        // delay before the first retry, 250ms by default
+	MaxDelay   time.Duration        // max delay between attempts, 30s by default
+	Factor     float64              // multiplier of the delay for every next retry, 2 by default
+	Jitter     float64              // part of the delay randomly added or subtracted, from 0 to 1, 0.1 by default
+	MaxElapsed time.Duration        // max time spent on all attempts, after which no retries are made, no limit by default
+	Retryable  func(err error) bool // reports whether the send failed with err should be retried, all but permanent errors by default
+}
+
+// DefaultRetryPolicy returns RetryPolicy with default values
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Attempts: 3, Delay: 250 * time.Millisecond, MaxDelay: 30 * time.Second, Factor: 2, Jitter: 0.1}
+}
+
+// WithRetry returns notifier retrying failed sends of n according to policy, with exponential backoff
+// between attempts. Zero fields of the policy are set to defaults, see DefaultRetryPolicy.
+// If the service asked to wait with RetryAfter of HTTPStatusError, the delay is not shorter than that.
+// Attempts are stopped early when ctx is done. The error of the last attempt is returned.
+func WithRetry(n Notifier, policy RetryPolicy) Notifier {
+	def := DefaultRetryPolicy()
+	if policy.Attempts <= 0 {
+		policy.Attempts = def.Attempts
+	}
+	if policy.Delay <= 0 {
+		policy.Delay = def.Delay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = def.MaxDelay
+	}
+	if policy.Factor < 1 {
+		policy.Factor = def.Factor
+	}
+	if policy.Jitter <= 0 || policy.Jitter > 1 {
+		policy.Jitter = def.Jitter
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = isRetryable
+	}
+	return &decorator{Notifier: n, around: func(ctx context.Context, _ string, send func(ctx context.Context) error) error {
+		return policy.do(ctx, send)
+	}}
+}
+
+// do calls send until it succeeds, fails with not retryable error, or the attempts are exhausted
+func (p RetryPolicy) do(ctx context.Context, send func(ctx context.Context) error) error {
+	run := &retryRun{policy: p, started: time.Now()}
+	rpt := repeater.NewWithStrategy(p.Attempts, run)
+	rpt.SetErrorClassifier(run.retryable)
+	return rpt.Do(ctx, func() error { return send(ctx) })
+}
+
+// backoff returns delay before the retry with provided number, starting from 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := float64(p.Delay) * math.Pow(p.Factor, float64(retry-1))
+	delay = math.Min(delay, float64(p.MaxDelay))
+	delay += delay * p.Jitter * (2*rand.Float64() - 1) //nolint:gosec // jitter doesn't need secure random
+	return time.Duration(delay)
+}
+
+// retryRun keeps state of retries of a single send, implementing repeater.Strategy
+type retryRun struct {
+	policy  RetryPolicy
+	started time.Time
+	retries int
+	delay   time.Duration // delay before the next retry, set by retryable
+}
+
+// retryable reports whether the send failed with err should be retried, and sets the delay before the retry,
+// not shorter than RetryAfter of HTTPStatusError. Retry is not made if it would start after MaxElapsed.
+func (r *retryRun) retryable(err error) bool {
+	if !r.policy.Retryable(err) {
+		return false
+	}
+	r.retries++
+	r.delay = r.policy.backoff(r.retries)
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > r.delay {
+		r.delay = statusErr.RetryAfter // service asked to wait longer
+	}
+	return r.policy.MaxElapsed <= 0 || time.Since(r.started)+r.delay < r.policy.MaxElapsed
+}
+
+// NextDelay returns the delay set by retryable
+func (r *retryRun) NextDelay(int) time.Duration {
+	return r.delay
+}
+
+// isRetryable is the default check of errors for retrying, all but permanent errors are retried
+func isRetryable(err error) bool {
+	return !IsPermanent(err)
+}
+
+// isPermanentStatus reports whether the request failed with HTTP status code fails the same way when repeated:
+// client errors except for timeout and rate limiting
+func isPermanentStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return false
+	}
+	return code >= http.StatusBadRequest && code < http.StatusInternalServerError
+}
@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermanent(t *testing.T) {
+	require.NoError(t, Permanent(nil))
+
+	base := errors.New("bad request")
+	err := Permanent(base)
+	require.EqualError(t, err, "bad request", "error message is unchanged")
+	require.ErrorIs(t, err, base)
+	assert.True(t, IsPermanent(err))
+	assert.True(t, IsPermanent(fmt.Errorf("wrapped: %w", err)))
+	assert.Same(t, err, Permanent(err), "already permanent error is not wrapped again")
+	assert.False(t, IsPermanent(base))
+	assert.False(t, IsPermanent(nil))
+}
+
+func TestWithRetry(t *testing.T) {
+	policy := RetryPolicy{Attempts: 4, Delay: time.Millisecond, MaxDelay: time.Millisecond * 5}
+
+	t.Run("temporary error", func(t *testing.T) {
+		var calls atomic.Int32
+		n := WithRetry(funcNotifier(func(context.Context, string, string) error {
+			if calls.Add(1) < 3 {
+				return errors.New("temporary")
+			}
+			return nil
+		}), policy)
+		require.NoError(t, n.Send(context.Background(), "test:dst", "text"))
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		var calls atomic.Int32
+		n := WithRetry(funcNotifier(func(context.Context, string, string) error {
+			return fmt.Errorf("failure %d", calls.Add(1))
+		}), policy)
+		require.EqualError(t, n.Send(context.Background(), "test:dst", "text"), "failure 4", "the last error is returned")
+		assert.Equal(t, int32(4), calls.Load())
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		var calls atomic.Int32
+		n := WithRetry(funcNotifier(func(context.Context, string, string) error {
+			calls.Add(1)
+			return Permanent(errors.New("bad destination"))
+		}), policy)
+		require.EqualError(t, n.Send(context.Background(), "test:dst", "text"), "bad destination")
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("custom classifier", func(t *testing.T) {
+		var calls atomic.Int32
+		errRetry := errors.New("retry me")
+		p := policy
+		p.Retryable = func(err error) bool { return errors.Is(err, errRetry) }
+		n := WithRetry(funcNotifier(func(context.Context, string, string) error {
+			if calls.Add(1) == 1 {
+				return errRetry
+			}
+			return errors.New("other")
+		}), p)
+		require.EqualError(t, n.Send(context.Background(), "test:dst", "text"), "other")
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("max elapsed", func(t *testing.T) {
+		var calls atomic.Int32
+		n := WithRetry(funcNotifier(func(context.Context, string, string) error {
+			calls.Add(1)
+			return errors.New("temporary")
+		}), RetryPolicy{Attempts: 100, Delay: time.Millisecond * 20, Factor: 1, MaxElapsed: time.Millisecond * 50})
+		require.Error(t, n.Send(context.Background(), "test:dst", "text"))
+		assert.Less(t, calls.Load(), int32(4), "no retries after max elapsed time")
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		var calls atomic.Int32
+		n := WithRetry(funcNotifier(func(context.Context, string, string) error {
+			if calls.Add(1) == 1 {
+				return &HTTPStatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Millisecond * 50, msg: "slow down"}
+			}
+			return nil
+		}), policy)
+		st := time.Now()
+		require.NoError(t, n.Send(context.Background(), "test:dst", "text"))
+		assert.GreaterOrEqual(t, time.Since(st), time.Millisecond*50, "delay requested by the service is respected")
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		var calls atomic.Int32
+		ctx, cancel := context.WithCancel(context.Background())
+		n := WithRetry(funcNotifier(func(context.Context, string, string) error {
+			calls.Add(1)
+			cancel()
+			return errors.New("temporary")
+		}), RetryPolicy{Attempts: 10, Delay: time.Minute})
+		st := time.Now()
+		require.ErrorIs(t, n.Send(ctx, "test:dst", "text"), context.Canceled)
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Less(t, time.Since(st), time.Second)
+	})
+}
+
+func TestWithRetry_Wrapped(t *testing.T) {
+	rich := &messageNotifier{schemaNotifier: schemaNotifier{schema: "rich"}}
+	n := WithRetry(rich, RetryPolicy{})
+	assert.Equal(t, rich.String(), n.String())
+	assert.Equal(t, "rich", n.Schema())
+
+	msg := Message{Title: "title", Body: "body"}
+	require.NoError(t, SendMessage(context.Background(), []Notifier{n}, "rich:dst", msg))
+	assert.Equal(t, []Message{msg}, rich.messages, "message is passed to the wrapped notifier as is")
+
+	// webhook keeps both of its schemes when wrapped
+	r := NewRouter()
+	require.NoError(t, r.Register(WithRetry(NewWebhook(WebhookParams{}), RetryPolicy{})))
+	assert.Equal(t, []string{"http", "https"}, r.Schemes())
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{Delay: time.Second, MaxDelay: time.Second * 5, Factor: 2, Jitter: 0.1}
+	for retry, want := range map[int]time.Duration{1: time.Second, 2: time.Second * 2, 3: time.Second * 4, 4: time.Second * 5, 10: time.Second * 5} {
+		for range 10 {
+			delay := p.backoff(retry)
+			assert.GreaterOrEqual(t, delay, want-want/10, "retry %d", retry)
+			assert.LessOrEqual(t, delay, want+want/10, "retry %d", retry)
+		}
+	}
+}
+
+func TestIsPermanentStatus(t *testing.T) {
+	for code, permanent := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusForbidden:           true,
+		http.StatusNotFound:            true,
+		http.StatusRequestTimeout:      false,
+		http.StatusTooManyRequests:     false,
+		http.StatusInternalServerError: false,
+		http.StatusBadGateway:          false,
+	} {
+		assert.Equal(t, permanent, isPermanentStatus(code), "status %d", code)
+	}
+}
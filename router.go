@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Router routes messages to notifiers by the exact scheme of destination URL.
+// It implements Notifier itself, so routers could be nested.
+type Router struct {
+	mu        sync.RWMutex
+	notifiers map[string]Notifier // notifiers by scheme
+}
+
+// schemesLister is implemented by notifiers supporting more than one destination scheme, like Webhook or Router
+type schemesLister interface {
+	Schemes() []string
+}
+
+// NewRouter makes empty Router, notifiers are added to it with Register
+func NewRouter() *Router {
+	return &Router{notifiers: map[string]Notifier{}}
+}
+
+// Register adds notifier for its schema and for every alias provided, e.g. "https" for notifier with "http" schema.
+// Notifier having Schemes() []string method, like Webhook or another Router, is registered for all schemes
+// returned by it at the time of the call. Scheme registered already for another notifier is rejected with an error,
+// and no schemes of the notifier are registered then.
+func (r *Router) Register(n Notifier, aliases ...string) error {
+	schemes := slices.Concat(notifierSchemes(n), aliases)
+	if len(schemes) == 0 {
+		return fmt.Errorf("no schemes to register %s for", n)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, scheme := range schemes {
+		scheme = strings.ToLower(scheme)
+		if !validScheme(scheme) {
+			return fmt.Errorf("invalid scheme %q", scheme)
+		}
+		if registered, ok := r.notifiers[scheme]; ok {
+			return fmt.Errorf("scheme %s is already registered for %s", scheme, registered)
+		}
+		schemes[i] = scheme
+	}
+	for _, scheme := range schemes {
+		r.notifiers[scheme] = n
+	}
+	return nil
+}
+
+// Schemes returns sorted list of all registered schemes
+func (r *Router) Schemes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]string, 0, len(r.notifiers))
+	for scheme := range r.notifiers {
+		res = append(res, scheme)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Send sends message to destination using notifier registered for its scheme
+func (r *Router) Send(ctx context.Context, destination, text string) error {
+	n, err := r.route(destination)
+	if err != nil {
+		return failSend(ctx, destination, err)
+	}
+	return observedSend(ctx, n, destination, func(ctx context.Context) error { return n.Send(ctx, destination, text) })
+}
+
+// instrumented marks Router as reporting its sends to Tracer and Metrics itself
+func (r *Router) instrumented() {}
+
+// Schema returns all registered schemes separated by comma
+func (r *Router) Schema() string {
+	return strings.Join(r.Schemes(), ",")
+}
+
+// String describes the router with its schemes
+func (r *Router) String() string {
+	return fmt.Sprintf("router for schemes [%s]", r.Schema())
+}
+
+// route returns notifier registered for destination scheme
+func (r *Router) route(destination string) (Notifier, error) {
+	scheme := destinationScheme(destination)
+
+	r.mu.RLock()
+	n, ok := r.notifiers[scheme]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, unsupportedSchemaError(destination, scheme)
+	}
+	return n, nil
+}
+
+// notifierSchemes returns all schemes supported by the notifier
+func notifierSchemes(n Notifier) []string {
+	if sl, ok := n.(schemesLister); ok {
+		return sl.Schemes()
+	}
+	if n.Schema() == "" {
+		return nil
+	}
+	return []string{n.Schema()}
+}
+
+// notifiersSchemes returns sorted list of schemes supported by the notifiers
+func notifiersSchemes(notifiers []Notifier) []string {
+	var res []string
+	for _, n := range notifiers {
+		for _, scheme := range notifierSchemes(n) {
+			if !slices.Contains(res, scheme) {
+				res = append(res, scheme)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// destinationScheme returns lowercase scheme of destination URL, or empty string if it has none
+func destinationScheme(destination string) string {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
+
+// validScheme checks that scheme is formed per RFC 3986, section 3.1
+func validScheme(scheme string) bool {
+	if scheme == "" {
+		return false
+	}
+	for i, c := range scheme {
+		switch {
+		case 'a' <= c && c <= 'z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func unsupportedSchemaError(destination, scheme string) error {
+	if scheme == "" {
+		return Permanent(fmt.Errorf("%w: %s", ErrUnsupportedSchema, destination))
+	}
+	return Permanent(fmt.Errorf("%w: %s", ErrUnsupportedSchema, scheme))
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schemaNotifier records destinations sent to it
+type schemaNotifier struct {
+	schema string
+	sent   []string
+}
+
+func (n *schemaNotifier) Send(_ context.Context, destination, _ string) error {
+	n.sent = append(n.sent, destination)
+	return nil
+}
+
+func (n *schemaNotifier) Schema() string { return n.schema }
+
+func (n *schemaNotifier) String() string { return fmt.Sprintf("%q notifier", n.schema) }
+
+func TestRouter_Register(t *testing.T) {
+	r := NewRouter()
+	require.NoError(t, r.Register(NewWebhook(WebhookParams{})))
+	require.NoError(t, r.Register(&schemaNotifier{schema: "slack"}, "Slack2"))
+	assert.Equal(t, []string{"http", "https", "slack", "slack2"}, r.Schemes())
+	assert.Equal(t, "http,https,slack,slack2", r.Schema())
+	assert.Equal(t, "router for schemes [http,https,slack,slack2]", r.String())
+
+	require.EqualError(t, r.Register(&schemaNotifier{schema: "telegram"}, "slack"),
+		`scheme slack is already registered for "slack" notifier`)
+	assert.NotContains(t, r.Schemes(), "telegram", "nothing is registered on error")
+
+	require.EqualError(t, r.Register(&schemaNotifier{schema: "telegram"}, "bad scheme"), `invalid scheme "bad scheme"`)
+	require.EqualError(t, r.Register(&schemaNotifier{schema: "telegram"}, "2fa"), `invalid scheme "2fa"`)
+	require.EqualError(t, r.Register(&schemaNotifier{}), `no schemes to register "" notifier for`)
+	require.NoError(t, r.Register(&schemaNotifier{}, "x-custom+v1.0"), "empty schema with alias")
+}
+
+func TestRouter_Send(t *testing.T) {
+	var received []string
+	ts := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		received = append(received, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	slck, slck2 := &schemaNotifier{schema: "slack"}, &schemaNotifier{schema: "slack2"}
+	r := NewRouter()
+	require.NoError(t, r.Register(NewWebhook(WebhookParams{})))
+	require.NoError(t, r.Register(slck))
+	require.NoError(t, r.Register(slck2))
+
+	require.NoError(t, r.Send(context.Background(), ts.URL+"/hook", "text"))
+	assert.Equal(t, []string{"/hook"}, received)
+
+	require.NoError(t, r.Send(context.Background(), "slack:general", "text"))
+	require.NoError(t, r.Send(context.Background(), "SLACK2:general", "text"), "scheme is case-insensitive")
+	assert.Equal(t, []string{"slack:general"}, slck.sent)
+	assert.Equal(t, []string{"SLACK2:general"}, slck2.sent)
+
+	require.EqualError(t, r.Send(context.Background(), "httpx://example.org", "text"), "unsupported destination schema: httpx")
+	require.EqualError(t, r.Send(context.Background(), "no scheme", "text"), "unsupported destination schema: no scheme")
+	require.EqualError(t, r.Send(context.Background(), "%", "text"), "unsupported destination schema: %")
+}
+
+func TestRouter_Nested(t *testing.T) {
+	chat := &schemaNotifier{schema: "chat"}
+	inner := NewRouter()
+	require.NoError(t, inner.Register(chat, "im"))
+
+	outer := NewRouter()
+	require.NoError(t, outer.Register(inner))
+	require.NoError(t, outer.Register(&schemaNotifier{schema: "mailto"}))
+	assert.Equal(t, []string{"chat", "im", "mailto"}, outer.Schemes())
+
+	require.NoError(t, outer.Send(context.Background(), "im:user", "text"))
+	assert.Equal(t, []string{"im:user"}, chat.sent)
+
+	// routers are accepted by Send as well
+	require.NoError(t, Send(context.Background(), []Notifier{inner}, "chat:user", "text"))
+	assert.Equal(t, []string{"im:user", "chat:user"}, chat.sent)
+}
+
+func TestSend_ExactScheme(t *testing.T) {
+	slck, slck2 := &schemaNotifier{schema: "slack"}, &schemaNotifier{schema: "slack2"}
+	notifiers := []Notifier{slck, slck2}
+
+	require.NoError(t, Send(context.Background(), notifiers, "slack2:general", "text"))
+	assert.Empty(t, slck.sent, "slack notifier doesn't catch slack2 scheme")
+	assert.Equal(t, []string{"slack2:general"}, slck2.sent)
+
+	require.EqualError(t, Send(context.Background(), []Notifier{NewWebhook(WebhookParams{})}, "httpx://example.org", "text"),
+		"unsupported destination schema: httpx")
+}
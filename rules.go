@@ -0,0 +1,317 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Matcher reports whether the message sent at the time matches the rule
+type Matcher func(msg Message, now time.Time) bool
+
+// SeverityAtLeast matches messages with the severity or higher
+func SeverityAtLeast(s Severity) Matcher {
+	return func(msg Message, _ time.Time) bool { return msg.Severity >= s }
+}
+
+// HasTag matches messages with the tag
+func HasTag(tag string) Matcher {
+	return func(msg Message, _ time.Time) bool { return slices.Contains(msg.Tags, tag) }
+}
+
+// TimeOfDay matches messages sent from the time of day up to the time of day, in the location of the sending time.
+// Times are offsets from midnight, and the range could wrap it, like 22:00 to 06:00.
+func TimeOfDay(from, to time.Duration) Matcher {
+	return func(_ Message, now time.Time) bool {
+		h, m, s := now.Clock()
+		t := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+		if from <= to {
+			return t >= from && t < to
+		}
+		return t >= from || t < to
+	}
+}
+
+// Weekdays matches messages sent on the days of week, in the location of the sending time
+func Weekdays(days ...time.Weekday) Matcher {
+	return func(_ Message, now time.Time) bool { return slices.Contains(days, now.Weekday()) }
+}
+
+// All matches messages matching all the matchers
+func All(matchers ...Matcher) Matcher {
+	return func(msg Message, now time.Time) bool {
+		for _, m := range matchers {
+			if !m(msg, now) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any matches messages matching any of the matchers
+func Any(matchers ...Matcher) Matcher {
+	return func(msg Message, now time.Time) bool {
+		for _, m := range matchers {
+			if m(msg, now) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches messages not matching the matcher
+func Not(m Matcher) Matcher {
+	return func(msg Message, now time.Time) bool { return !m(msg, now) }
+}
+
+// ParseMatcher parses matcher of comma-separated conditions, all of which should match. Conditions are:
+//
+//   - severity with =, !=, >=, >, <= or < and the severity name, like "severity>=error"
+//   - tag with = or != and the tag, like "tag=billing"
+//   - time with = and the range of time of day, like "time=22:00-06:00"
+//   - weekday with = and the range or the list of days, like "weekday=mon-fri" or "weekday=sat|sun"
+//
+// Empty expression matches any message.
+func ParseMatcher(expr string) (Matcher, error) {
+	var matchers []Matcher
+	for _, cond := range strings.Split(expr, ",") {
+		cond = strings.TrimSpace(cond)
+		if cond == "" {
+			continue
+		}
+		m, err := parseCondition(cond)
+		if err != nil {
+			return nil, fmt.Errorf("problem parsing condition %q: %w", cond, err)
+		}
+		matchers = append(matchers, m)
+	}
+	return All(matchers...), nil
+}
+
+// parseCondition parses single condition of ParseMatcher expression
+func parseCondition(cond string) (Matcher, error) {
+	i := strings.IndexAny(cond, "=!<>")
+	if i <= 0 {
+		return nil, errors.New("no operator")
+	}
+	field, op, value := strings.TrimSpace(cond[:i]), "", ""
+	for _, o := range []string{"!=", ">=", "<=", "=", ">", "<"} {
+		if strings.HasPrefix(cond[i:], o) {
+			op, value = o, strings.TrimSpace(cond[i+len(o):])
+			break
+		}
+	}
+	if op == "" {
+		return nil, errors.New("unknown operator")
+	}
+
+	switch strings.ToLower(field) {
+	case "severity":
+		s, err := ParseSeverity(value)
+		if err != nil {
+			return nil, err
+		}
+		return severityMatcher(op, s), nil
+	case "tag":
+		switch op {
+		case "=":
+			return HasTag(value), nil
+		case "!=":
+			return Not(HasTag(value)), nil
+		}
+	case "time":
+		if op == "=" {
+			return parseTimeOfDay(value)
+		}
+	case "weekday":
+		if op == "=" {
+			return parseWeekdays(value)
+		}
+	default:
+		return nil, fmt.Errorf("unknown field %s", field)
+	}
+	return nil, fmt.Errorf("operator %s is not supported for %s", op, field)
+}
+
+// severityMatcher returns matcher comparing severity of the message with s
+func severityMatcher(op string, s Severity) Matcher {
+	return func(msg Message, _ time.Time) bool {
+		switch op {
+		case "=":
+			return msg.Severity == s
+		case "!=":
+			return msg.Severity != s
+		case ">=":
+			return msg.Severity >= s
+		case ">":
+			return msg.Severity > s
+		case "<=":
+			return msg.Severity <= s
+		default:
+			return msg.Severity < s
+		}
+	}
+}
+
+// parseTimeOfDay parses range of time of day, like "09:00-18:00"
+func parseTimeOfDay(value string) (Matcher, error) {
+	from, to, err := parseTimeRange(value)
+	if err != nil {
+		return nil, err
+	}
+	return TimeOfDay(from, to), nil
+}
+
+// parseTimeRange parses range of time of day, like "09:00-18:00", into offsets from midnight
+func parseTimeRange(value string) (from, to time.Duration, err error) {
+	fromStr, toStr, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, errors.New("time range should be like 09:00-18:00")
+	}
+	var bounds [2]time.Duration
+	for i, s := range []string{fromStr, toStr} {
+		t, parseErr := time.Parse("15:04", strings.TrimSpace(s))
+		if parseErr != nil {
+			return 0, 0, fmt.Errorf("time range should be like 09:00-18:00: %w", parseErr)
+		}
+		bounds[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// parseWeekdays parses range or list of days of week, like "mon-fri" or "sat|sun"
+func parseWeekdays(value string) (Matcher, error) {
+	days, err := parseDays(value)
+	if err != nil {
+		return nil, err
+	}
+	return Weekdays(days...), nil
+}
+
+// parseDays parses range or list of days of week, like "mon-fri" or "sat|sun", into the list of days
+func parseDays(value string) ([]time.Weekday, error) {
+	day := func(s string) (time.Weekday, error) {
+		s = strings.ToLower(strings.TrimSpace(s))
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if name := strings.ToLower(d.String()); s != "" && (s == name || s == name[:3]) {
+				return d, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown day of week %q", s)
+	}
+
+	var days []time.Weekday
+	if fromStr, toStr, ok := strings.Cut(value, "-"); ok {
+		from, err := day(fromStr)
+		if err != nil {
+			return nil, err
+		}
+		to, err := day(toStr)
+		if err != nil {
+			return nil, err
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days = append(days, d)
+			if d == to {
+				break
+			}
+		}
+		return days, nil
+	}
+	for _, s := range strings.Split(value, "|") {
+		d, err := day(s)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// Rule sends matching messages to the destinations
+type Rule struct {
+	Name         string   // name of the rule, for debugging
+	Match        Matcher  // matcher of the messages, nil matches any message
+	Destinations []string // destinations of the matching messages
+	Continue     bool     // whether the next rules are evaluated after this one matched, like Alertmanager routes
+}
+
+// Rules sends messages to destinations picked by the rules. Rules are evaluated in order, and the message goes
+// to destinations of every matching rule up to the first matching one without Continue, so the rule matching
+// any message at the end catches the messages no other rule took.
+//
+// Example:
+//
+//	critical, _ := notify.ParseMatcher("severity>=critical")
+//	rules := notify.NewRules(notifiers,
+//		notify.Rule{Match: critical, Destinations: []string{"telegram:oncall", "mailto:ops@example.org"}, Continue: true},
+//		notify.Rule{Match: notify.HasTag("billing"), Destinations: []string{"slack:billing"}},
+//		notify.Rule{Destinations: []string{"https://example.org/hook"}},
+//	)
+type Rules struct {
+	Parallel int // number of parallel deliveries of the message, no limit by default
+
+	notifiers []Notifier
+	rules     []Rule
+	now       func() time.Time
+}
+
+// NewRules makes Rules sending with the notifiers
+func NewRules(notifiers []Notifier, rules ...Rule) *Rules {
+	return &Rules{notifiers: notifiers, rules: rules, now: time.Now}
+}
+
+// Route returns destinations the message sent now would go to, without duplicates, for debugging
+func (r *Rules) Route(msg Message) []string {
+	var res []string
+	for _, rule := range r.matching(msg) {
+		for _, d := range rule.Destinations {
+			if !slices.Contains(res, d) {
+				res = append(res, d)
+			}
+		}
+	}
+	return res
+}
+
+// Matched returns names of the rules matching the message sent now, in order, for debugging
+func (r *Rules) Matched(msg Message) []string {
+	var res []string
+	for _, rule := range r.matching(msg) {
+		res = append(res, rule.Name)
+	}
+	return res
+}
+
+// Dispatch sends the message to all destinations returned by Route concurrently, the same way SendAll does.
+// Result is never nil, and has no results if no rule matched the message.
+func (r *Rules) Dispatch(ctx context.Context, msg Message) *SendAllResult {
+	return sendAll(ctx, r.Route(msg), r.Parallel, func(ctx context.Context, destination string) (Notifier, error) {
+		n, err := findNotifier(r.notifiers, destination)
+		if err != nil {
+			return nil, err
+		}
+		return n, sendMessage(ctx, n, destination, msg)
+	})
+}
+
+// matching returns rules matching the message sent now, up to the first one without Continue
+func (r *Rules) matching(msg Message) []Rule {
+	now := r.now()
+	var res []Rule
+	for _, rule := range r.rules {
+		if rule.Match != nil && !rule.Match(msg, now) {
+			continue
+		}
+		res = append(res, rule)
+		if !rule.Continue {
+			break
+		}
+	}
+	return res
+}
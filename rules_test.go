@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMatcher(t *testing.T) {
+	// 2024-01-15 is Monday
+	monday := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	night := time.Date(2024, 1, 15, 23, 0, 0, 0, time.UTC)
+	sunday := time.Date(2024, 1, 14, 10, 30, 0, 0, time.UTC)
+	critical := Message{Severity: SeverityCritical, Tags: []string{"billing", "db"}}
+	info := Message{Severity: SeverityInfo}
+
+	tbl := []struct {
+		expr  string
+		msg   Message
+		now   time.Time
+		match bool
+	}{
+		{"", info, monday, true},
+		{"severity>=critical", critical, monday, true},
+		{"severity>=critical", info, monday, false},
+		{"severity>warning", critical, monday, true},
+		{"severity<warning", info, monday, true},
+		{"severity<=info", critical, monday, false},
+		{"severity=info", info, monday, true},
+		{"severity!=info", info, monday, false},
+		{"tag=billing", critical, monday, true},
+		{"tag=billing", info, monday, false},
+		{"tag!=billing", info, monday, true},
+		{"severity >= error, tag = db", critical, monday, true},
+		{"severity>=error,tag=web", critical, monday, false},
+		{"time=09:00-18:00", info, monday, true},
+		{"time=09:00-18:00", info, night, false},
+		{"time=22:00-06:00", info, night, true},
+		{"time=22:00-06:00", info, monday, false},
+		{"weekday=mon-fri", info, monday, true},
+		{"weekday=mon-fri", info, sunday, false},
+		{"weekday=fri-mon", info, sunday, true},
+		{"weekday=Saturday|sun", info, sunday, true},
+		{"weekday=sat|sun", info, monday, false},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.expr, func(t *testing.T) {
+			m, err := ParseMatcher(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.match, m(tt.msg, tt.now))
+		})
+	}
+
+	for expr, errText := range map[string]string{
+		"severity":           `problem parsing condition "severity": no operator`,
+		"severity>=fatal":    `problem parsing condition "severity>=fatal": unknown severity "fatal"`,
+		"tag>=billing":       `problem parsing condition "tag>=billing": operator >= is not supported for tag`,
+		"title=disk":         `problem parsing condition "title=disk": unknown field title`,
+		"time=09:00":         `problem parsing condition "time=09:00": time range should be like 09:00-18:00`,
+		"time=9-18":          `problem parsing condition "time=9-18": time range should be like 09:00-18:00: parsing time "9" as "15:04": cannot parse "" as ":"`,
+		"weekday=mon-funday": `problem parsing condition "weekday=mon-funday": unknown day of week "funday"`,
+		"weekday=sat|":       `problem parsing condition "weekday=sat|": unknown day of week ""`,
+		"weekday!=sat":       `problem parsing condition "weekday!=sat": operator != is not supported for weekday`,
+	} {
+		_, err := ParseMatcher(expr)
+		require.EqualError(t, err, errText, expr)
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	now := time.Now()
+	yes := func(Message, time.Time) bool { return true }
+	no := func(Message, time.Time) bool { return false }
+	assert.True(t, All()(Message{}, now))
+	assert.False(t, All(yes, no)(Message{}, now))
+	assert.True(t, Any(no, yes)(Message{}, now))
+	assert.False(t, Any()(Message{}, now))
+	assert.True(t, Not(no)(Message{}, now))
+	assert.True(t, SeverityAtLeast(SeverityWarning)(Message{Severity: SeverityError}, now))
+}
+
+func TestRules(t *testing.T) {
+	rec := &recordingNotifier{}
+	critical, err := ParseMatcher("severity>=critical")
+	require.NoError(t, err)
+	rules := NewRules([]Notifier{rec},
+		Rule{Name: "critical", Match: critical, Destinations: []string{"test:oncall", "test:ops"}, Continue: true},
+		Rule{Name: "billing", Match: HasTag("billing"), Destinations: []string{"test:billing", "test:ops"}},
+		Rule{Name: "default", Destinations: []string{"test:hook"}},
+	)
+
+	assert.Equal(t, []string{"test:oncall", "test:ops", "test:billing"}, rules.Route(Message{Severity: SeverityCritical, Tags: []string{"billing"}}))
+	assert.Equal(t, []string{"critical", "billing"}, rules.Matched(Message{Severity: SeverityCritical, Tags: []string{"billing"}}))
+	assert.Equal(t, []string{"test:oncall", "test:ops", "test:hook"}, rules.Route(Message{Severity: SeverityCritical}),
+		"continue passes the message to the next rules")
+	assert.Equal(t, []string{"test:billing", "test:ops"}, rules.Route(Message{Tags: []string{"billing"}}), "rule without continue stops")
+	assert.Equal(t, []string{"test:hook"}, rules.Route(Message{}))
+	assert.Equal(t, []string{"default"}, rules.Matched(Message{}))
+
+	res := rules.Dispatch(context.Background(), Message{Body: "db is down", Severity: SeverityCritical})
+	require.NoError(t, res.Err())
+	assert.ElementsMatch(t, []string{"test:oncall db is down", "test:ops db is down", "test:hook db is down"}, rec.get())
+
+	assert.Empty(t, NewRules(nil).Route(Message{}))
+	res = NewRules(nil).Dispatch(context.Background(), Message{})
+	require.NoError(t, res.Err())
+	assert.Empty(t, res.Results)
+
+	rec.err = errors.New("failed")
+	require.Error(t, rules.Dispatch(context.Background(), Message{}).Err())
+}
+
+func TestRules_TimeOfDay(t *testing.T) {
+	rec := &recordingNotifier{}
+	rules := NewRules([]Notifier{rec},
+		Rule{Match: All(TimeOfDay(9*time.Hour, 18*time.Hour), Weekdays(time.Monday)), Destinations: []string{"test:day"}},
+		Rule{Destinations: []string{"test:night"}},
+	)
+	rules.now = func() time.Time { return time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC) }
+	assert.Equal(t, []string{"test:day"}, rules.Route(Message{}))
+	rules.now = func() time.Time { return time.Date(2024, 1, 15, 20, 0, 0, 0, time.UTC) }
+	assert.Equal(t, []string{"test:night"}, rules.Route(Message{}))
+}
@@ -0,0 +1,559 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// ErrNotScheduled is returned by Cancel for messages which are not scheduled, delivered or being delivered already
+var ErrNotScheduled = errors.New("message is not scheduled")
+
+// ErrSchedulerClosed is returned for messages sent to Scheduler after Shutdown was called
+var ErrSchedulerClosed = errors.New("scheduler is shut down")
+
+// ScheduledItem is a message waiting for delivery by Scheduler
+type ScheduledItem struct {
+	ID            string    `json:"id"`
+	Destination   string    `json:"destination"`
+	Text          string    `json:"text"`
+	At            time.Time `json:"at"` // time of delivery, moved to the delivery window by QuietHours
+	CorrelationID string    `json:"correlation_id,omitempty"`
+}
+
+// ScheduleStore persists messages scheduled by Scheduler until they are delivered,
+// so the messages scheduled before the restart of the process are sent after it
+type ScheduleStore interface {
+	Add(item ScheduledItem) error   // persists the item, replacing the one with the same ID
+	Remove(id string) (bool, error) // removes the item, reporting whether it was there
+	List() ([]ScheduledItem, error) // returns all items, in any order
+}
+
+// QuietHours holds messages to the destinations outside of the delivery windows until the next window starts
+type QuietHours struct {
+	Destinations []string         // destinations the policy applies to, exact or a prefix ending with "*", like "telegram:*"
+	Location     *time.Location   // time zone of the windows, local by default
+	Windows      []DeliveryWindow // delivery windows, like ParseDeliveryWindow("weekday=mon-fri,time=09:00-18:00"), any time if empty
+}
+
+// DeliveryWindow is the time of day on the days of week when QuietHours let messages through
+type DeliveryWindow struct {
+	Weekdays []time.Weekday // days of week, any day if empty
+	From, To time.Duration  // time of day as offsets from midnight, could wrap it like 22:00 to 06:00, whole day if both are zero
+}
+
+// ParseDeliveryWindow parses delivery window of comma-separated conditions, the same as in ParseMatcher:
+// "time" with the range of time of day, like "time=09:00-18:00", and "weekday" with the range or the list
+// of days, like "weekday=mon-fri" or "weekday=sat|sun". Empty expression is the window open at any time.
+func ParseDeliveryWindow(expr string) (DeliveryWindow, error) {
+	var res DeliveryWindow
+	for _, cond := range strings.Split(expr, ",") {
+		cond = strings.TrimSpace(cond)
+		if cond == "" {
+			continue
+		}
+		field, value, ok := strings.Cut(cond, "=")
+		var err error
+		switch field = strings.ToLower(strings.TrimSpace(field)); {
+		case !ok:
+			err = errors.New("no operator")
+		case field == "time":
+			res.From, res.To, err = parseTimeRange(value)
+		case field == "weekday":
+			res.Weekdays, err = parseDays(value)
+		default:
+			err = fmt.Errorf("unknown field %s", field)
+		}
+		if err != nil {
+			return DeliveryWindow{}, fmt.Errorf("problem parsing condition %q: %w", cond, err)
+		}
+	}
+	return res, nil
+}
+
+// SchedulerParams contain settings for Scheduler
+type SchedulerParams struct {
+	Store      ScheduleStore                       // persistent storage for scheduled messages, in memory by default
+	QuietHours []QuietHours                        // delivery policies, the first one matching the destination applies
+	Timeout    time.Duration                       // time limit for a single delivery, no limit by default
+	OnError    func(item ScheduledItem, err error) // called for failed deliveries, errors are logged if not set
+}
+
+// Scheduler sends messages at the requested time, holding them until the delivery window of QuietHours
+// matching the destination. Scheduled messages are kept in the Store and delivered by the background loop
+// using the notifiers, the same way Send function does, and removed from the Store when the delivery starts,
+// so a message is delivered at most once. Messages which became due while the process wasn't running are sent
+// once Scheduler is created, in the delivery window.
+type Scheduler struct {
+	SchedulerParams
+	notifiers []Notifier
+
+	mu     sync.Mutex // serializes changes of the store with the deliveries
+	closed bool
+	wake   chan struct{} // signals the loop to recheck the store
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // closed once the loop is stopped
+}
+
+// NewScheduler makes Scheduler for provided notifiers and starts its loop
+func NewScheduler(notifiers []Notifier, params SchedulerParams) (*Scheduler, error) {
+	res := &Scheduler{SchedulerParams: params, notifiers: notifiers, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	if res.Store == nil {
+		res.Store = &memoryScheduleStore{items: map[string]ScheduledItem{}}
+	}
+	now := time.Now()
+	for i, qh := range res.QuietHours {
+		if _, ok := qh.next(now); !ok {
+			return nil, fmt.Errorf("quiet hours %d have no delivery window", i+1)
+		}
+	}
+	if _, err := res.Store.List(); err != nil {
+		return nil, fmt.Errorf("can't load scheduled messages: %w", err)
+	}
+	res.ctx, res.cancel = context.WithCancel(context.Background())
+	go res.run()
+	return res, nil
+}
+
+// Send schedules the message for immediate delivery, held until the delivery window of the destination
+func (s *Scheduler) Send(ctx context.Context, destination, text string) error {
+	_, err := s.SendAt(ctx, destination, text, time.Now())
+	return err
+}
+
+// SendAt schedules the message for delivery at the time, or at the start of the next delivery window
+// of the destination, and returns the identifier of the scheduled message.
+// Error is returned if the destination is not supported by any of the notifiers or the message can't be stored.
+func (s *Scheduler) SendAt(ctx context.Context, destination, text string, at time.Time) (string, error) {
+	if _, err := findNotifier(s.notifiers, destination); err != nil {
+		return "", err
+	}
+	id, err := newOutboxID()
+	if err != nil {
+		return "", err
+	}
+	item := ScheduledItem{ID: id, Destination: destination, Text: text, CorrelationID: CorrelationID(ctx)}
+	item.At = s.deliveryTime(at, item)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return "", ErrSchedulerClosed
+	}
+	if err = s.Store.Add(item); err != nil {
+		return "", fmt.Errorf("can't store scheduled message: %w", err)
+	}
+	s.notify()
+	return id, nil
+}
+
+// Scheduled returns messages waiting for delivery, sorted by the time of delivery
+func (s *Scheduler) Scheduled() ([]ScheduledItem, error) {
+	items, err := s.Store.List()
+	if err != nil {
+		return nil, fmt.Errorf("can't load scheduled messages: %w", err)
+	}
+	sortScheduled(items)
+	return items, nil
+}
+
+// Cancel removes the scheduled message, returning ErrNotScheduled if it's unknown or its delivery started already
+func (s *Scheduler) Cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ok, err := s.Store.Remove(id)
+	if err != nil {
+		return fmt.Errorf("can't remove scheduled message %s: %w", id, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotScheduled, id)
+	}
+	s.notify()
+	return nil
+}
+
+// Shutdown stops the loop, waiting for the delivery in progress. If ctx is done before that, the delivery
+// is canceled and ctx error is returned. Scheduled messages stay in the Store.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.wake)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+		return ctx.Err()
+	}
+}
+
+// Schemes returns sorted list of schemes supported by the notifiers
+func (s *Scheduler) Schemes() []string {
+	return notifiersSchemes(s.notifiers)
+}
+
+// Schema returns schemes supported by the notifiers separated by comma
+func (s *Scheduler) Schema() string {
+	return strings.Join(s.Schemes(), ",")
+}
+
+// String describes the scheduler
+func (s *Scheduler) String() string {
+	return fmt.Sprintf("scheduler with %d quiet hours policies for schemes [%s]", len(s.QuietHours), s.Schema())
+}
+
+// notify wakes up the loop, should be called with mu held
+func (s *Scheduler) notify() {
+	if s.closed {
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers due messages, sleeping until the next one is due or the store is changed
+func (s *Scheduler) run() {
+	defer close(s.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		timer.Reset(s.deliverDue())
+		select {
+		case _, ok := <-s.wake:
+			if !ok {
+				return
+			}
+		case <-timer.C:
+		}
+	}
+}
+
+// deliverDue delivers messages due by now and returns the time to wait for the next one
+func (s *Scheduler) deliverDue() time.Duration {
+	const idle, retry = time.Hour, time.Minute
+	items, err := s.Store.List()
+	if err != nil {
+		log.Printf("[WARN] can't load scheduled messages: %v", err)
+		return retry
+	}
+	sortScheduled(items)
+
+	for _, item := range items {
+		now := time.Now()
+		if item.At.After(now) {
+			return item.At.Sub(now)
+		}
+		if at := s.deliveryTime(now, item); at.After(now) {
+			// message became due while the process wasn't running, and it's out of the delivery window now
+			item.At = at
+			if err = s.reschedule(item); err != nil {
+				log.Printf("[WARN] can't reschedule message %s: %v", item.ID, err)
+				return retry
+			}
+			return 0
+		}
+		ok, e := s.take(item.ID)
+		if e != nil {
+			log.Printf("[WARN] can't remove scheduled message %s: %v", item.ID, e)
+			return retry
+		}
+		if !ok {
+			continue // canceled or rescheduled by another instance
+		}
+		if e = s.deliver(item); e != nil {
+			s.onError(item, e)
+		}
+	}
+	return idle
+}
+
+// take removes the message from the store before its delivery, unless the scheduler is shut down
+func (s *Scheduler) take(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false, nil
+	}
+	return s.Store.Remove(id)
+}
+
+// reschedule stores the message with the new time of delivery, unless it's canceled
+func (s *Scheduler) reschedule(item ScheduledItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ok, err := s.Store.Remove(item.ID)
+	if err != nil || !ok {
+		return err
+	}
+	return s.Store.Add(item)
+}
+
+// deliver sends the message, limiting the time of delivery by Timeout if it's set
+func (s *Scheduler) deliver(item ScheduledItem) error {
+	ctx := s.ctx
+	if item.CorrelationID != "" {
+		ctx = WithCorrelationID(ctx, item.CorrelationID)
+	}
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	return Send(ctx, s.notifiers, item.Destination, item.Text)
+}
+
+// onError reports failed delivery to OnError, or logs it if OnError is not set
+func (s *Scheduler) onError(item ScheduledItem, err error) {
+	if s.OnError != nil {
+		s.OnError(item, err)
+		return
+	}
+	log.Printf("[WARN] failed to send scheduled notification to %s: %v", redactDestination(item.Destination), err)
+}
+
+// deliveryTime returns the time the message could be delivered at, not earlier than at,
+// according to the first QuietHours matching its destination
+func (s *Scheduler) deliveryTime(at time.Time, item ScheduledItem) time.Time {
+	for _, qh := range s.QuietHours {
+		if !qh.matches(item.Destination) {
+			continue
+		}
+		res, ok := qh.next(at)
+		if !ok {
+			log.Printf("[WARN] no delivery window for %s, sending it anyway", redactDestination(item.Destination))
+			return at
+		}
+		return res
+	}
+	return at
+}
+
+// matches reports whether the policy applies to the destination
+func (qh QuietHours) matches(destination string) bool {
+	for _, d := range qh.Destinations {
+		if prefix, ok := strings.CutSuffix(d, "*"); ok && strings.HasPrefix(destination, prefix) || d == destination {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the first time not earlier than at within one of the delivery windows,
+// and false if none of the windows is ever open
+func (qh QuietHours) next(at time.Time) (time.Time, bool) {
+	if len(qh.Windows) == 0 {
+		return at, true
+	}
+	loc := qh.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	var res time.Time
+	found := false
+	for _, w := range qh.Windows {
+		if t, ok := w.next(at.In(loc)); ok && (!found || t.Before(res)) {
+			res, found = t, true
+		}
+	}
+	if !found {
+		return time.Time{}, false
+	}
+	return res.In(at.Location()), true
+}
+
+// contains reports whether the window is open at the time, in its location
+func (w DeliveryWindow) contains(t time.Time) bool {
+	if len(w.Weekdays) > 0 && !slices.Contains(w.Weekdays, t.Weekday()) {
+		return false
+	}
+	if w.From == 0 && w.To == 0 {
+		return true
+	}
+	return TimeOfDay(w.From, w.To)(Message{}, t)
+}
+
+// next returns the first time not earlier than at when the window is open, in the location of at,
+// and false if the window is never open
+func (w DeliveryWindow) next(at time.Time) (time.Time, bool) {
+	if w.contains(at) {
+		return at, true
+	}
+	// the window opens at From, or at midnight if it wraps it or spans the whole day,
+	// on one of the days within a week from at
+	y, m, d := at.Date()
+	for i := range 8 {
+		for _, start := range []time.Duration{0, w.From} {
+			t := time.Date(y, m, d+i, int(start/time.Hour), int(start%time.Hour/time.Minute), int(start%time.Minute/time.Second), 0,
+				at.Location())
+			if !t.Before(at) && w.contains(t) {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// sortScheduled sorts items by the time of delivery
+func sortScheduled(items []ScheduledItem) {
+	slices.SortStableFunc(items, func(a, b ScheduledItem) int { return a.At.Compare(b.At) })
+}
+
+// memoryScheduleStore is ScheduleStore keeping items in memory, used by Scheduler by default
+type memoryScheduleStore struct {
+	mu    sync.Mutex
+	items map[string]ScheduledItem
+}
+
+func (m *memoryScheduleStore) Add(item ScheduledItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[item.ID] = item
+	return nil
+}
+
+func (m *memoryScheduleStore) Remove(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.items[id]
+	delete(m.items, id)
+	return ok, nil
+}
+
+func (m *memoryScheduleStore) List() ([]ScheduledItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]ScheduledItem, 0, len(m.items))
+	for _, item := range m.items {
+		res = append(res, item)
+	}
+	return res, nil
+}
+
+// FileScheduleStore is ScheduleStore keeping items in JSON file on local disk. The file is rewritten
+// on every change, through the temporary file renamed over it, and synced to disk before Add or Remove return.
+// It suits the number of scheduled messages which fit in memory easily.
+type FileScheduleStore struct {
+	path string
+
+	mu    sync.Mutex
+	items map[string]ScheduledItem
+}
+
+// NewFileScheduleStore makes FileScheduleStore with the file, loading items from it if it exists
+func NewFileScheduleStore(path string) (*FileScheduleStore, error) {
+	res := &FileScheduleStore{path: path, items: map[string]ScheduledItem{}}
+	data, err := os.ReadFile(path) //nolint:gosec // path is the configured store file
+	if errors.Is(err, os.ErrNotExist) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read schedule file: %w", err)
+	}
+	var items []ScheduledItem
+	if err = json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("can't parse schedule file %s: %w", path, err)
+	}
+	for _, item := range items {
+		res.items[item.ID] = item
+	}
+	return res, nil
+}
+
+// Add persists the item
+func (f *FileScheduleStore) Add(item ScheduledItem) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, existed := f.items[item.ID]
+	f.items[item.ID] = item
+	if err := f.save(); err != nil {
+		if existed {
+			f.items[item.ID] = prev
+		} else {
+			delete(f.items, item.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Remove removes the item, unknown identifiers are reported with false
+func (f *FileScheduleStore) Remove(id string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, ok := f.items[id]
+	if !ok {
+		return false, nil
+	}
+	delete(f.items, id)
+	if err := f.save(); err != nil {
+		f.items[id] = item
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns all items
+func (f *FileScheduleStore) List() ([]ScheduledItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := make([]ScheduledItem, 0, len(f.items))
+	for _, item := range f.items {
+		res = append(res, item)
+	}
+	return res, nil
+}
+
+// save writes all items to the temporary file and renames it over the store file
+func (f *FileScheduleStore) save() error {
+	items := make([]ScheduledItem, 0, len(f.items))
+	for _, item := range f.items {
+		items = append(items, item)
+	}
+	sortScheduled(items)
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't encode scheduled messages: %w", err)
+	}
+
+	dir := filepath.Dir(f.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("can't create schedule file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path)
+	}
+	if err == nil {
+		err = syncDir(dir)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("can't write schedule file: %w", err)
+	}
+	return nil
+}
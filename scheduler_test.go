@@ -0,0 +1,183 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deliveries collects messages sent with funcNotifier
+type deliveries struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (d *deliveries) notifier() funcNotifier {
+	return func(ctx context.Context, destination, text string) error {
+		if text == "bad" {
+			return errors.New("send failed")
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.list = append(d.list, destination+" "+text+" "+CorrelationID(ctx))
+		return nil
+	}
+}
+
+func (d *deliveries) get() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.list...)
+}
+
+func TestScheduler_SendAt(t *testing.T) {
+	sent := &deliveries{}
+	f := &failures{}
+	onError := func(item ScheduledItem, err error) { f.add(Delivery{Text: item.Text}, err) }
+	s, err := NewScheduler([]Notifier{sent.notifier()}, SchedulerParams{OnError: onError})
+	require.NoError(t, err)
+	assert.Equal(t, "scheduler with 0 quiet hours policies for schemes [test]", s.String())
+
+	now := time.Now()
+	_, err = s.SendAt(context.Background(), "test:dst", "second", now.Add(100*time.Millisecond))
+	require.NoError(t, err)
+	_, err = s.SendAt(WithCorrelationID(context.Background(), "req-1"), "test:dst", "first", now.Add(50*time.Millisecond))
+	require.NoError(t, err)
+	_, err = s.SendAt(context.Background(), "test:dst", "bad", now.Add(50*time.Millisecond))
+	require.NoError(t, err)
+	later, err := s.SendAt(context.Background(), "test:dst", "later", now.Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, s.Send(context.Background(), "test:dst", "now"))
+	_, err = s.SendAt(context.Background(), "slack:dst", "text", now)
+	require.ErrorIs(t, err, ErrUnsupportedSchema)
+
+	require.Eventually(t, func() bool { return len(sent.get()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"test:dst now ", "test:dst first req-1", "test:dst second "}, sent.get())
+	assert.Equal(t, []string{"bad: send failed"}, f.get())
+
+	items, err := s.Scheduled()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, later, items[0].ID)
+	assert.Equal(t, "later", items[0].Text)
+	assert.True(t, items[0].At.Equal(now.Add(time.Hour)))
+
+	require.NoError(t, s.Cancel(later))
+	require.ErrorIs(t, s.Cancel(later), ErrNotScheduled)
+	items, err = s.Scheduled()
+	require.NoError(t, err)
+	assert.Empty(t, items)
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	require.ErrorIs(t, s.Send(context.Background(), "test:dst", "late"), ErrSchedulerClosed)
+	require.NoError(t, s.Shutdown(context.Background()), "repeated shutdown")
+}
+
+func TestScheduler_QuietHours(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	businessHours, err := ParseDeliveryWindow("weekday=mon-fri,time=09:00-18:00")
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryWindow{Weekdays: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		From: 9 * time.Hour, To: 18 * time.Hour}, businessHours)
+	nights, err := ParseDeliveryWindow("weekday=sat, time=22:00-06:00")
+	require.NoError(t, err)
+	s, err := NewScheduler([]Notifier{(&deliveries{}).notifier()}, SchedulerParams{QuietHours: []QuietHours{
+		{Destinations: []string{"test:low-*", "test:ops"}, Location: loc, Windows: []DeliveryWindow{businessHours}},
+		{Destinations: []string{"test:night"}, Location: loc, Windows: []DeliveryWindow{nights}},
+		{Destinations: []string{"test:weekend"}, Location: loc, Windows: []DeliveryWindow{{Weekdays: []time.Weekday{time.Sunday}}}},
+		{Destinations: []string{"test:*"}},
+	}})
+	require.NoError(t, err)
+	defer s.Shutdown(context.Background()) //nolint:errcheck // nothing is scheduled
+
+	tbl := []struct {
+		destination string
+		at, res     time.Time
+	}{
+		{"test:low-priority", time.Date(2024, 3, 9, 20, 0, 0, 0, loc), time.Date(2024, 3, 11, 9, 0, 0, 0, loc)},
+		{"test:ops", time.Date(2024, 3, 11, 5, 30, 0, 0, time.UTC), time.Date(2024, 3, 11, 9, 0, 0, 0, loc)},
+		{"test:ops", time.Date(2024, 3, 11, 10, 15, 30, 0, loc), time.Date(2024, 3, 11, 10, 15, 30, 0, loc)},
+		{"test:ops", time.Date(2024, 3, 11, 17, 59, 30, 0, loc), time.Date(2024, 3, 11, 17, 59, 30, 0, loc)},
+		{"test:ops", time.Date(2024, 3, 11, 18, 0, 0, 0, loc), time.Date(2024, 3, 12, 9, 0, 0, 0, loc)},
+		{"test:low", time.Date(2024, 3, 9, 20, 0, 0, 0, loc), time.Date(2024, 3, 9, 20, 0, 0, 0, loc)},
+		{"test:low-x", time.Date(2024, 3, 9, 20, 0, 0, 0, loc), time.Date(2024, 3, 11, 9, 0, 0, 0, loc)},
+		{"test:night", time.Date(2024, 3, 11, 12, 0, 0, 0, loc), time.Date(2024, 3, 16, 0, 0, 0, 0, loc)},
+		{"test:night", time.Date(2024, 3, 16, 3, 0, 0, 0, loc), time.Date(2024, 3, 16, 3, 0, 0, 0, loc)},
+		{"test:night", time.Date(2024, 3, 16, 7, 0, 0, 0, loc), time.Date(2024, 3, 16, 22, 0, 0, 0, loc)},
+		{"test:night", time.Date(2024, 3, 17, 1, 0, 0, 0, loc), time.Date(2024, 3, 23, 0, 0, 0, 0, loc)},
+		{"test:weekend", time.Date(2024, 3, 11, 12, 0, 0, 0, loc), time.Date(2024, 3, 17, 0, 0, 0, 0, loc)},
+	}
+	for _, tt := range tbl {
+		res := s.deliveryTime(tt.at, ScheduledItem{Destination: tt.destination})
+		assert.True(t, tt.res.Equal(res), "%s at %v: %v", tt.destination, tt.at, res)
+	}
+
+	_, err = NewScheduler(nil, SchedulerParams{QuietHours: []QuietHours{
+		{Destinations: []string{"test:*"}},
+		{Destinations: []string{"test:*"}, Windows: []DeliveryWindow{{From: time.Hour, To: time.Hour}}},
+	}})
+	require.EqualError(t, err, "quiet hours 2 have no delivery window")
+
+	for expr, e := range map[string]string{
+		"time=09:00":         `problem parsing condition "time=09:00": time range should be like 09:00-18:00`,
+		"weekday=mon-xyz":    `problem parsing condition "weekday=mon-xyz": unknown day of week "xyz"`,
+		"weekday":            `problem parsing condition "weekday": no operator`,
+		"tag=billing":        `problem parsing condition "tag=billing": unknown field tag`,
+		"weekday=sat,time=x": `problem parsing condition "time=x": time range should be like 09:00-18:00`,
+	} {
+		_, err = ParseDeliveryWindow(expr)
+		require.ErrorContains(t, err, e, expr)
+	}
+}
+
+func TestScheduler_Store(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	store, err := NewFileScheduleStore(path)
+	require.NoError(t, err)
+	sent := &deliveries{}
+	s, err := NewScheduler([]Notifier{sent.notifier()}, SchedulerParams{Store: store})
+	require.NoError(t, err)
+
+	ctx := WithCorrelationID(context.Background(), "req-1")
+	_, err = s.SendAt(ctx, "test:dst", "soon", time.Now().Add(200*time.Millisecond))
+	require.NoError(t, err)
+	later, err := s.SendAt(ctx, "test:dst", "later", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Empty(t, sent.get())
+
+	// scheduled messages survive the restart, and those which became due while it was stopped are sent on start
+	time.Sleep(250 * time.Millisecond)
+	store, err = NewFileScheduleStore(path)
+	require.NoError(t, err)
+	s, err = NewScheduler([]Notifier{sent.notifier()}, SchedulerParams{Store: store})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(sent.get()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"test:dst soon req-1"}, sent.get())
+	items, err := s.Scheduled()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, later, items[0].ID)
+	require.NoError(t, s.Cancel(later))
+	require.NoError(t, s.Shutdown(context.Background()))
+
+	store, err = NewFileScheduleStore(path)
+	require.NoError(t, err)
+	items, err = store.List()
+	require.NoError(t, err)
+	assert.Empty(t, items)
+	ok, err := store.Remove(later)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, os.WriteFile(path, []byte("broken"), 0o600))
+	_, err = NewFileScheduleStore(path)
+	require.ErrorContains(t, err, "can't parse schedule file")
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DestinationResult contains the outcome of the delivery to a single destination
+type DestinationResult struct {
+	Destination string
+	Notifier    Notifier      // notifier used for the delivery, nil if none matched the destination
+	Duration    time.Duration // time spent on the delivery
+	Err         error         // delivery error, nil if the message was delivered
+}
+
+// SendAllResult contains the outcome of the delivery to every destination passed to SendAll, in the same order.
+// It is an error itself, combining the errors of failed destinations the same way errors.Join does,
+// so errors.Is and errors.As could be used on it directly.
+type SendAllResult struct {
+	Results []DestinationResult
+}
+
+// Err returns the result as an error if the delivery to at least one destination failed, and nil otherwise
+func (r *SendAllResult) Err() error {
+	if len(r.Failed()) == 0 {
+		return nil
+	}
+	return r
+}
+
+// Failed returns results of the destinations the delivery to which failed
+func (r *SendAllResult) Failed() []DestinationResult {
+	var res []DestinationResult
+	for _, dr := range r.Results {
+		if dr.Err != nil {
+			res = append(res, dr)
+		}
+	}
+	return res
+}
+
+// Error returns errors of the failed destinations, one per line
+func (r *SendAllResult) Error() string {
+	failed := r.Failed()
+	lines := make([]string, 0, len(failed))
+	for _, dr := range failed {
+		lines = append(lines, fmt.Sprintf("%s: %v", dr.Destination, dr.Err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns errors of the failed destinations, to be used by errors.Is and errors.As
+func (r *SendAllResult) Unwrap() []error {
+	failed := r.Failed()
+	res := make([]error, 0, len(failed))
+	for _, dr := range failed {
+		res = append(res, dr.Err)
+	}
+	return res
+}
+
+// SendAll sends message to all provided destinations concurrently, picking the right notifier for each of them
+// the same way Send does. No more than parallel deliveries are running at the same time, zero or negative
+// parallel means no limit. Result is never nil, use its Err method to check whether all deliveries succeeded.
+func SendAll(ctx context.Context, notifiers []Notifier, destinations []string, text string, parallel int) *SendAllResult {
+	return sendAll(ctx, destinations, parallel, func(ctx context.Context, destination string) (Notifier, error) {
+		n, err := findNotifier(notifiers, destination)
+		if err != nil {
+			return nil, failSend(ctx, destination, err)
+		}
+		return n, observedSend(ctx, n, destination, func(ctx context.Context) error { return n.Send(ctx, destination, text) })
+	})
+}
+
+// sendAll runs send for every destination with no more than parallel of them running at the same time
+func sendAll(ctx context.Context, destinations []string, parallel int,
+	send func(ctx context.Context, destination string) (Notifier, error)) *SendAllResult {
+	res := &SendAllResult{Results: make([]DestinationResult, len(destinations))}
+	if parallel <= 0 || parallel > len(destinations) {
+		parallel = len(destinations)
+	}
+
+	sema := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, destination := range destinations {
+		res.Results[i].Destination = destination
+		if err := ctx.Err(); err != nil {
+			res.Results[i].Err = err
+			continue
+		}
+		select {
+		case sema <- struct{}{}:
+		case <-ctx.Done():
+			res.Results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Go(func() {
+			defer func() { <-sema }()
+			st := time.Now()
+			n, err := send(ctx, destination)
+			res.Results[i] = DestinationResult{Destination: destination, Notifier: n, Duration: time.Since(st), Err: err}
+		})
+	}
+	wg.Wait()
+	return res
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendAll(t *testing.T) {
+	var received int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	wh := NewWebhook(WebhookParams{})
+	notifiers := []Notifier{wh}
+
+	res := SendAll(context.Background(), notifiers, []string{ts.URL + "/good", "mailto:addr@example.org", ts.URL + "/bad"}, "text", 0)
+	require.Len(t, res.Results, 3)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&received))
+
+	assert.Equal(t, ts.URL+"/good", res.Results[0].Destination)
+	assert.Equal(t, wh, res.Results[0].Notifier)
+	require.NoError(t, res.Results[0].Err)
+	assert.Positive(t, res.Results[0].Duration)
+
+	assert.Nil(t, res.Results[1].Notifier, "no notifier for mailto")
+	require.EqualError(t, res.Results[1].Err, "unsupported destination schema: mailto")
+
+	assert.Equal(t, wh, res.Results[2].Notifier)
+	require.Error(t, res.Results[2].Err)
+	assert.Contains(t, res.Results[2].Err.Error(), "non-OK status code: 400")
+
+	err := res.Err()
+	require.Error(t, err)
+	assert.Len(t, res.Failed(), 2)
+	assert.Contains(t, err.Error(), "mailto:addr@example.org: unsupported destination schema: mailto\n"+ts.URL+"/bad: webhook request failed")
+	assert.ErrorIs(t, err, res.Results[1].Err, "errors of destinations are unwrapped")
+
+	var sendAllRes *SendAllResult
+	require.ErrorAs(t, err, &sendAllRes)
+	assert.Equal(t, res, sendAllRes)
+}
+
+func TestSendAll_Success(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer ts.Close()
+
+	res := SendAll(context.Background(), []Notifier{NewWebhook(WebhookParams{})}, []string{ts.URL, ts.URL + "/other"}, "text", 1)
+	require.NoError(t, res.Err())
+	assert.Empty(t, res.Failed())
+	assert.Empty(t, res.Error())
+
+	res = SendAll(context.Background(), nil, nil, "text", 0)
+	require.NoError(t, res.Err())
+	assert.Empty(t, res.Results)
+}
+
+func TestSendAll_Parallel(t *testing.T) {
+	var running, maxRunning int32
+	send := func(context.Context, string) (Notifier, error) {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			prev := atomic.LoadInt32(&maxRunning)
+			if cur <= prev || atomic.CompareAndSwapInt32(&maxRunning, prev, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+		atomic.AddInt32(&running, -1)
+		return nil, nil
+	}
+
+	res := sendAll(context.Background(), []string{"a", "b", "c", "d", "e", "f"}, 2, send)
+	require.NoError(t, res.Err())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxRunning), "no more than 2 deliveries at the same time")
+
+	atomic.StoreInt32(&maxRunning, 0)
+	res = sendAll(context.Background(), []string{"a", "b", "c", "d"}, 0, send)
+	require.NoError(t, res.Err())
+	assert.Equal(t, int32(4), atomic.LoadInt32(&maxRunning), "no limit on parallel deliveries")
+}
+
+func TestSendAll_CanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	res := sendAll(ctx, []string{"a", "b", "c"}, 1, func(ctx context.Context, _ string) (Notifier, error) {
+		close(started)
+		cancel()
+		<-ctx.Done()
+		return nil, errors.New("interrupted")
+	})
+	<-started
+	require.Error(t, res.Err())
+	require.EqualError(t, res.Results[0].Err, "interrupted")
+	require.ErrorIs(t, res.Results[1].Err, context.Canceled, "delivery is not started after the context is canceled")
+	require.ErrorIs(t, res.Results[2].Err, context.Canceled, "delivery is not started after the context is canceled")
+}
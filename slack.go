@@ -1,17 +1,32 @@
 package notify
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"html"
+	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/microcosm-cc/bluemonday"
 	"github.com/slack-go/slack"
 )
 
+// attachment colors for message severities, https://api.slack.com/reference/messaging/attachments#fields
+var slackSeverityColors = map[Severity]string{
+	SeverityWarning:  "warning",
+	SeverityError:    "danger",
+	SeverityCritical: "danger",
+}
+
 // Slack notifications client
 type Slack struct {
+	Split  SplitParams // how text over 40000 characters is sent, split into numbered parts by default
 	client *slack.Client
 }
 
@@ -29,14 +44,117 @@ func NewSlack(token string, opts ...slack.Option) *Slack {
 // - slack:channelID
 // - slack:userID
 // - slack:channel?title=title&attachmentText=test%20text&titleLink=https://example.org
-func (s *Slack) Send(ctx context.Context, destination, text string) error {
+//
+// Text longer than 40000 characters, which Slack truncates, is split into parts keeping mrkdwn entities intact,
+// or sent with the whole text uploaded as a file, see SplitParams.
+func (s *Slack) Send(ctx context.Context, destination, text string) (err error) {
+	ctx, done := startSend(ctx, s.Schema(), destination)
+	defer done(&err)
+	channelID, attachment, err := s.parseDestination(destination)
+	if err != nil {
+		return fmt.Errorf("problem parsing destination: %w", err)
+	}
+	return s.postText(ctx, channelID, attachment, text, markupSlack, func(part string) []slack.MsgOption {
+		return []slack.MsgOption{slack.MsgOptionText(part, false)}
+	})
+}
+
+// SendMessage sends Message over Slack, with title, link and tags sent in the attachment and
+// the color of the attachment set by severity. "title" and "titleLink" from destination take
+// precedence over the title and link of the message. Markdown body is sent as Slack mrkdwn,
+// plain text body is sent with formatting disabled, and HTML body is stripped of tags.
+// Attachments of the message are uploaded to the channel as files after the message.
+func (s *Slack) SendMessage(ctx context.Context, destination string, msg Message) (err error) {
+	ctx, done := startSend(ctx, s.Schema(), destination)
+	defer done(&err)
 	channelID, attachment, err := s.parseDestination(destination)
 	if err != nil {
 		return fmt.Errorf("problem parsing destination: %w", err)
 	}
-	options := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if attachment.Title == "" {
+		attachment.Title = msg.Title
+	}
+	if attachment.TitleLink == "" {
+		attachment.TitleLink = msg.Link
+	}
+	attachment.Color = slackSeverityColors[msg.Severity]
+	attachment.Footer = strings.Join(msg.Tags, ", ")
+
+	body := msg.Body
+	if attachment.Title == "" && attachment.TitleLink != "" {
+		// there is no title to put the link on, so it goes to the text
+		body = Message{Body: body, Link: attachment.TitleLink}.Text()
+	}
+	mu, options := markupSlack, func(part string) []slack.MsgOption { return []slack.MsgOption{slack.MsgOptionText(part, false)} }
+	if msg.Format != FormatMarkdown {
+		if msg.Format == FormatHTML {
+			body = html.UnescapeString(bluemonday.StrictPolicy().Sanitize(body))
+		}
+		mu, options = markupPlain, func(part string) []slack.MsgOption {
+			return []slack.MsgOption{slack.MsgOptionText(part, true), slack.MsgOptionDisableMarkdown()}
+		}
+	}
+
+	if err = s.postText(ctx, channelID, attachment, body, mu, options); err != nil {
+		return err
+	}
+	for _, a := range msg.Attachments {
+		if err = s.upload(ctx, channelID, a); err != nil {
+			return fmt.Errorf("problem uploading attachment %s: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// postText sends text to the channel with options made by the func, split into parts or with the whole text
+// uploaded as a file if it's too long. Attachment is added to the first message only.
+func (s *Slack) postText(ctx context.Context, channelID string, attachment slack.Attachment, text string, mu markup,
+	options func(part string) []slack.MsgOption) error {
+	parts, attach := s.Split.split(text, mu, slackMaxLength, utf8.RuneCountInString)
+	for i, part := range parts {
+		var err error
+		if i > 0 {
+			attachment = slack.Attachment{}
+			err = waitRateLimit(ctx) // every part counts against the rate limit, as a separate message
+		}
+		if err == nil {
+			err = s.post(ctx, channelID, attachment, options(part)...)
+		}
+		if err != nil {
+			if len(parts) > 1 {
+				return fmt.Errorf("problem sending part %d of %d: %w", i+1, len(parts), err)
+			}
+			return err
+		}
+	}
+	if attach {
+		err := waitRateLimit(ctx)
+		if err == nil {
+			err = s.upload(ctx, channelID, Attachment{Name: splitFileName, Data: []byte(text)})
+		}
+		if err != nil {
+			return fmt.Errorf("problem uploading the whole text as a file: %w", err)
+		}
+	}
+	return nil
+}
+
+// upload uploads the attachment to the channel as a file
+func (s *Slack) upload(ctx context.Context, channelID string, a Attachment) error {
+	_, err := s.client.UploadFileContext(ctx, slack.UploadFileParameters{
+		Filename: a.Name,
+		Title:    a.Name,
+		FileSize: len(a.Data),
+		Reader:   bytes.NewReader(a.Data),
+		Channel:  channelID,
+	})
+	return slackError(err)
+}
+
+// post sends message to the channel, with attachment added if it has anything to show
+func (s *Slack) post(ctx context.Context, channelID string, attachment slack.Attachment, options ...slack.MsgOption) error {
 	// titleLink alone carries nothing, slack renders it as a link on the title and drops it without one
-	if attachment.Title != "" || attachment.Text != "" {
+	if attachment.Title != "" || attachment.Text != "" || attachment.Footer != "" {
 		options = append(options, slack.MsgOptionAttachments(attachment))
 	}
 
@@ -44,11 +162,14 @@ func (s *Slack) Send(ctx context.Context, destination, text string) error {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		_, _, err = s.client.PostMessageContext(ctx, channelID, options...)
-		return err
+		_, _, err := s.client.PostMessageContext(ctx, channelID, options...)
+		return slackError(err)
 	}
 }
 
+// instrumented marks Slack as reporting its sends to Tracer and Metrics itself
+func (s *Slack) instrumented() {}
+
 // Schema returns schema prefix supported by this client
 func (s *Slack) Schema() string {
 	return "slack"
@@ -62,14 +183,10 @@ func (s *Slack) String() string {
 // if channelID is channel name and not ID (starting with C for channel and with U for user),
 // then it will be resolved to ID.
 func (s *Slack) parseDestination(destination string) (string, slack.Attachment, error) {
-	// parse URL
-	u, err := url.Parse(destination)
+	u, err := s.parseURL(destination)
 	if err != nil {
 		return "", slack.Attachment{}, err
 	}
-	if u.Scheme != "slack" {
-		return "", slack.Attachment{}, fmt.Errorf("unsupported scheme %s, should be slack", u.Scheme)
-	}
 	channelID := u.Opaque
 	if !strings.HasPrefix(u.Opaque, "C") && !strings.HasPrefix(u.Opaque, "U") {
 		channelID, err = s.findChannelIDByName(u.Opaque)
@@ -86,12 +203,57 @@ func (s *Slack) parseDestination(destination string) (string, slack.Attachment,
 		}, nil
 }
 
+// parseURL parses "slack:" URL, without resolving the channel
+func (s *Slack) parseURL(destination string) (*url.URL, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, invalidDestination(err)
+	}
+	if u.Scheme != "slack" {
+		return nil, unsupportedScheme(u.Scheme, "slack")
+	}
+	return u, nil
+}
+
+// Validate checks "slack:" destination without resolving the channel: that it has the channel
+// and only the supported query parameters
+func (s *Slack) Validate(destination string) error {
+	u, err := s.parseURL(destination)
+	if err != nil {
+		return err
+	}
+	if u.Opaque == "" {
+		return invalidDestination(errors.New("no channel or user in slack destination"))
+	}
+	return checkQueryParams(u, "title", "titleLink", "attachmentText")
+}
+
+// ValidateOnline checks "slack:" destination, and that the channel or the user exists and is visible to the bot
+func (s *Slack) ValidateOnline(ctx context.Context, destination string) error {
+	if err := s.Validate(destination); err != nil {
+		return err
+	}
+	channelID, _, err := s.parseDestination(destination)
+	if err != nil {
+		return fmt.Errorf("problem parsing destination: %w", err)
+	}
+	if strings.HasPrefix(channelID, "U") {
+		_, err = s.client.GetUserInfoContext(ctx, channelID)
+	} else {
+		_, err = s.client.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: channelID})
+	}
+	if err != nil {
+		return fmt.Errorf("problem checking %s: %w", channelID, slackError(err))
+	}
+	return nil
+}
+
 func (s *Slack) findChannelIDByName(name string) (string, error) {
 	params := slack.GetConversationsParameters{}
 	for {
 		channels, next, err := s.client.GetConversations(&params)
 		if err != nil {
-			return "", err
+			return "", slackError(err)
 		}
 
 		for i := range channels {
@@ -105,5 +267,57 @@ func (s *Slack) findChannelIDByName(name string) (string, error) {
 		}
 		params.Cursor = next
 	}
-	return "", errors.New("no such channel")
+	return "", invalidDestination(errors.New("no such channel"))
+}
+
+// errors returned by Slack API, by the sentinel errors they match, https://api.slack.com/methods/chat.postMessage#errors
+var (
+	slackTemporaryErrors   = []string{"internal_error", "fatal_error", "request_timeout", "service_unavailable", "ratelimited"}
+	slackDestinationErrors = []string{"channel_not_found", "user_not_found", "invalid_channel", "not_allowed_token_type"}
+	slackBlockedErrors     = []string{"is_archived", "not_in_channel", "user_disabled", "restricted_action", "cannot_dm_bot"}
+)
+
+// slackError converts errors of Slack client to the errors of this package: HTTP and rate limiting errors
+// to HTTPStatusError, and API errors to the matching sentinel errors. Errors which can't be fixed by retrying,
+// like unknown channel or invalid token, are marked as permanent.
+func slackError(err error) error {
+	var rateErr *slack.RateLimitedError
+	if errors.As(err, &rateErr) {
+		return &HTTPStatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: rateErr.RetryAfter, msg: err.Error(), err: err}
+	}
+	var statusErr slack.StatusCodeError
+	if errors.As(err, &statusErr) {
+		return statusError(&HTTPStatusError{StatusCode: statusErr.Code, Body: statusErr.Status, msg: err.Error(), err: err})
+	}
+	var apiErr slack.SlackErrorResponse
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch {
+	case apiErr.Err == "ratelimited":
+		return markError(err, ErrRateLimited)
+	case slices.Contains(slackTemporaryErrors, apiErr.Err):
+		return err
+	case slices.Contains(slackDestinationErrors, apiErr.Err):
+		return invalidDestination(err)
+	case slices.Contains(slackBlockedErrors, apiErr.Err):
+		return Permanent(markError(err, ErrRecipientBlocked))
+	default:
+		return Permanent(err)
+	}
+}
+
+// DefaultRateLimit returns rate limit of Slack chat.postMessage method: 1 message per second in a single channel,
+// with short bursts allowed, see https://api.slack.com/methods/chat.postMessage#rate_limiting
+func (s *Slack) DefaultRateLimit() RateLimit {
+	return RateLimit{
+		PerDestination: Rate{Every: time.Second, Burst: 3},
+		Key: func(destination string) string {
+			u, err := url.Parse(destination)
+			if err != nil {
+				return destination
+			}
+			return u.Opaque
+		},
+	}
 }
@@ -2,10 +2,14 @@ package notify
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/slack-go/slack"
 	"github.com/stretchr/testify/assert"
@@ -83,11 +87,85 @@ func TestSlackSendClientError(t *testing.T) {
 	require.EqualError(t, slck.Send(ctx, "slack:general?title=test", ""), "context canceled")
 }
 
+func TestSlack_SendMessage(t *testing.T) {
+	ts := newMockSlackServer()
+	defer ts.Close()
+	slck := ts.newClient()
+
+	msg := Message{Title: "title", Body: "*bold* <b>", Link: "https://example.org", Severity: SeverityCritical, Tags: []string{"a", "b"}}
+	require.NoError(t, slck.SendMessage(context.Background(), "slack:general", msg))
+	assert.Equal(t, "C12345678", ts.lastMessage.Get("channel"))
+	assert.Equal(t, "*bold* &lt;b&gt;", ts.lastMessage.Get("text"), "plain text is escaped")
+	assert.Equal(t, "false", ts.lastMessage.Get("mrkdwn"), "plain text is sent without formatting")
+	assert.JSONEq(t, `[{"title":"title","title_link":"https://example.org","color":"danger","footer":"a, b","blocks":null}]`,
+		ts.lastMessage.Get("attachments"))
+
+	// destination params take precedence
+	require.NoError(t, slck.SendMessage(context.Background(), "slack:general?title=other&titleLink=https://example.com", msg))
+	assert.JSONEq(t, `[{"title":"other","title_link":"https://example.com","color":"danger","footer":"a, b","blocks":null}]`,
+		ts.lastMessage.Get("attachments"))
+
+	require.NoError(t, slck.SendMessage(context.Background(), "slack:general", Message{Body: "*bold*", Format: FormatMarkdown}))
+	assert.Equal(t, "*bold*", ts.lastMessage.Get("text"))
+	assert.Empty(t, ts.lastMessage.Get("mrkdwn"), "markdown is sent as mrkdwn")
+	assert.Empty(t, ts.lastMessage.Get("attachments"))
+
+	require.NoError(t, slck.SendMessage(context.Background(), "slack:general",
+		Message{Body: "<p>a &amp; b</p>", Format: FormatHTML, Link: "https://example.org"}))
+	assert.Equal(t, "a &amp; b\n\nhttps://example.org", ts.lastMessage.Get("text"), "tags are stripped, link without title goes to text")
+	assert.Empty(t, ts.lastMessage.Get("attachments"))
+
+	require.NoError(t, slck.SendMessage(context.Background(), "slack:general", Message{Body: "logs",
+		Attachments: []Attachment{{Name: "a.log", Data: []byte("line a")}}}))
+	assert.Equal(t, []string{"a.log:line a"}, ts.uploads)
+
+	err := slck.SendMessage(context.Background(), "slack:U0000", Message{Body: "logs",
+		Attachments: []Attachment{{Name: "a.log", Data: []byte("line a")}}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "problem uploading attachment a.log")
+
+	require.EqualError(t, slck.SendMessage(context.Background(), "mailto:addr@example.org", msg),
+		"problem parsing destination: unsupported scheme mailto, should be slack")
+}
+
+func TestSlack_Split(t *testing.T) {
+	ts := newMockSlackServer()
+	defer ts.Close()
+	slck := ts.newClient()
+	slck.Split = SplitParams{MaxLength: 40}
+
+	text := "deploy finished with *three warnings* on hosts\n\n`host-1` and `host-2`"
+	require.NoError(t, slck.Send(context.Background(), "slack:general?title=deploy", text))
+	require.Len(t, ts.messages, 3)
+	var texts []string
+	for _, m := range ts.messages {
+		texts = append(texts, m.Get("text"))
+	}
+	assert.Equal(t, []string{"deploy finished with *three*\n(1/3)", "*warnings* on hosts\n(2/3)", "`host-1` and `host-2`\n(3/3)"}, texts)
+	assert.Contains(t, ts.messages[0].Get("attachments"), "deploy", "attachment goes with the first part")
+	assert.Empty(t, ts.messages[1].Get("attachments"))
+	assert.Empty(t, ts.messages[2].Get("attachments"))
+	assert.Empty(t, ts.uploads)
+
+	ts.messages = nil
+	slck.Split.Mode = SplitAttachment
+	require.NoError(t, slck.SendMessage(context.Background(), "slack:general", Message{Body: text}))
+	require.Len(t, ts.messages, 1)
+	assert.Equal(t, "deploy finished with *three warnings* on", ts.messages[0].Get("text"))
+	assert.Equal(t, []string{"message.txt:" + text}, ts.uploads)
+
+	ts.isServerDown = true
+	slck.Split.Mode = SplitParts
+	require.ErrorContains(t, slck.Send(context.Background(), "slack:general", text), "problem sending part 1 of 3")
+}
+
 type mockSlackServer struct {
 	*httptest.Server
 	isServerDown    bool
 	listingIsBroken bool
-	lastMessage     url.Values // form of the last chat.postMessage call
+	lastMessage     url.Values   // form of the last chat.postMessage call
+	messages        []url.Values // forms of all chat.postMessage calls
+	uploads         []string     // names and contents of uploaded files, "name:content"
 }
 
 func (ts *mockSlackServer) newClient() *Slack {
@@ -141,6 +219,7 @@ func newMockSlackServer() *mockSlackServer {
 	mux.HandleFunc("POST /chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err == nil {
 			mockServer.lastMessage = r.PostForm
+			mockServer.messages = append(mockServer.messages, r.PostForm)
 		}
 		if mockServer.isServerDown {
 			w.WriteHeader(500)
@@ -162,6 +241,119 @@ func newMockSlackServer() *mockSlackServer {
 		}
 	})
 
+	mux.HandleFunc("POST /files.getUploadURLExternal", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"ok": true, "upload_url": "%s/upload/%s", "file_id": "F123"}`, mockServer.URL, r.FormValue("filename"))
+	})
+	mux.HandleFunc("POST /upload/{name}", func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		mockServer.uploads = append(mockServer.uploads, r.PathValue("name")+":"+string(data))
+		_, _ = w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("POST /files.completeUploadExternal", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("channel_id") != "C12345678" {
+			_, _ = w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "files": [{"id": "F123", "title": "file"}]}`))
+	})
+
+	mux.HandleFunc("POST /conversations.info", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("channel") != "C12345678" {
+			_, _ = w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "channel": {"id": "C12345678", "name": "general"}}`))
+	})
+	mux.HandleFunc("POST /users.info", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("user") != "U12345678" {
+			_, _ = w.Write([]byte(`{"ok": false, "error": "user_not_found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "user": {"id": "U12345678", "name": "user"}}`))
+	})
+
 	mockServer.Server = httptest.NewServer(mux)
 	return &mockServer
 }
+
+func TestSlack_Validate(t *testing.T) {
+	ts := newMockSlackServer()
+	defer ts.Close()
+	s := ts.newClient()
+
+	require.NoError(t, s.Validate("slack:general?title=title&titleLink=https://example.org&attachmentText=text"))
+	require.NoError(t, s.Validate("slack:no-such-channel"), "channel is not resolved offline")
+	for destination, errText := range map[string]string{
+		"slack:":                   "no channel or user in slack destination",
+		"slack:general?titel=test": "unknown query parameters titel, supported are title, titleLink, attachmentText",
+		"mailto:general":           "unsupported scheme mailto, should be slack",
+	} {
+		err := s.Validate(destination)
+		require.EqualError(t, err, errText, destination)
+		require.ErrorIs(t, err, ErrInvalidDestination, destination)
+	}
+
+	require.NoError(t, s.ValidateOnline(context.Background(), "slack:general"))
+	require.NoError(t, s.ValidateOnline(context.Background(), "slack:U12345678"))
+	require.ErrorIs(t, s.ValidateOnline(context.Background(), "slack:general?titel=test"), ErrInvalidDestination)
+	err := s.ValidateOnline(context.Background(), "slack:no-such-channel")
+	require.EqualError(t, err, "problem parsing destination: problem retrieving channel ID for #no-such-channel: no such channel")
+	require.ErrorIs(t, err, ErrInvalidDestination)
+	err = s.ValidateOnline(context.Background(), "slack:C00000000")
+	require.EqualError(t, err, "problem checking C00000000: channel_not_found")
+	require.ErrorIs(t, err, ErrInvalidDestination)
+	require.ErrorIs(t, s.ValidateOnline(context.Background(), "slack:U00000000"), ErrInvalidDestination)
+}
+
+func TestSlackError(t *testing.T) {
+	require.NoError(t, slackError(nil))
+	for _, tc := range []struct {
+		err       error
+		permanent bool
+		sentinel  error
+		status    int
+	}{
+		{err: slack.SlackErrorResponse{Err: "channel_not_found"}, permanent: true, sentinel: ErrInvalidDestination},
+		{err: slack.SlackErrorResponse{Err: "is_archived"}, permanent: true, sentinel: ErrRecipientBlocked},
+		{err: slack.SlackErrorResponse{Err: "invalid_auth"}, permanent: true},
+		{err: slack.SlackErrorResponse{Err: "internal_error"}},
+		{err: slack.SlackErrorResponse{Err: "ratelimited"}, sentinel: ErrRateLimited},
+		{err: &slack.RateLimitedError{RetryAfter: time.Second}, sentinel: ErrRateLimited, status: http.StatusTooManyRequests},
+		{err: slack.StatusCodeError{Code: http.StatusInternalServerError, Status: "500 Internal Server Error"}, status: 500},
+		{err: slack.StatusCodeError{Code: http.StatusNotFound, Status: "404 Not Found"}, permanent: true, status: 404},
+		{err: errors.New("connection refused")},
+	} {
+		err := slackError(fmt.Errorf("wrapped: %w", tc.err))
+		assert.Equal(t, tc.permanent, IsPermanent(err), "%v", tc.err)
+		assert.EqualError(t, err, "wrapped: "+tc.err.Error())
+		if tc.sentinel != nil {
+			require.ErrorIs(t, err, tc.sentinel, "%v", tc.err)
+		}
+		var statusErr *HTTPStatusError
+		if tc.status != 0 {
+			require.ErrorAs(t, err, &statusErr)
+			assert.Equal(t, tc.status, statusErr.StatusCode)
+		} else {
+			assert.NotErrorAs(t, err, &statusErr)
+		}
+	}
+
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, slackError(&slack.RateLimitedError{RetryAfter: time.Second}), &statusErr)
+	assert.Equal(t, time.Second, statusErr.RetryAfter)
+
+	ts := newMockSlackServer()
+	defer ts.Close()
+	slck := ts.newClient()
+	err := slck.Send(context.Background(), "slack:non-existent", "")
+	require.ErrorIs(t, err, ErrInvalidDestination)
+	assert.True(t, IsPermanent(err), "unknown channel is permanent")
+	require.ErrorIs(t, slck.Send(context.Background(), "mailto:user@example.org", ""), ErrUnsupportedSchema)
+	ts.listingIsBroken = true
+	assert.False(t, IsPermanent(slck.Send(context.Background(), "slack:general", "")), "server error is temporary")
+}
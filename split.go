@@ -0,0 +1,399 @@
+package notify
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// SplitMode defines how Telegram and Slack send text longer than the limit of the service
+type SplitMode int
+
+// supported split modes
+const (
+	SplitParts      SplitMode = iota // split text into parts on paragraph, line or word boundaries, numbered like "(1/3)"
+	SplitAttachment                  // send the beginning of the text fitting the limit, with the whole text attached as a file
+)
+
+// SplitParams define how Telegram and Slack send text longer than the limit of the service.
+// Text is cut on paragraph, line or word boundaries, and markup entities open at the cut, like HTML tags
+// or Markdown code blocks, are closed at the end of the part and opened again at the start of the next one.
+type SplitParams struct {
+	MaxLength int       // max length of the message text, the limit of the service by default, can't be over it or under splitMinLength
+	Mode      SplitMode // SplitParts by default
+}
+
+const (
+	telegramMaxLength = 4096  // max length of sendMessage text, in UTF-16 code units
+	slackMaxLength    = 40000 // length of chat.postMessage text longer ones are truncated to, in characters
+	splitFileName     = "message.txt"
+	splitMinLength    = 30 // min MaxLength, leaving room for some text besides the part number like "\n(999/999)"
+)
+
+// ParseSplitMode parses split mode name, "parts" or "attachment"
+func ParseSplitMode(s string) (SplitMode, error) {
+	switch strings.ToLower(s) {
+	case "parts":
+		return SplitParts, nil
+	case "attachment":
+		return SplitAttachment, nil
+	}
+	return SplitParts, fmt.Errorf("unknown split mode %q, should be parts or attachment", s)
+}
+
+// split returns parts of the text to send, limited by MaxLength or limit of the service, whichever is less,
+// and whether the whole text should be attached as a file after them. MaxLength under splitMinLength is raised to it,
+// as otherwise the part number alone wouldn't fit.
+func (p SplitParams) split(text string, mu markup, limit int, size func(string) int) (parts []string, attach bool) {
+	if p.MaxLength > 0 && p.MaxLength < limit {
+		limit = max(p.MaxLength, splitMinLength)
+	}
+	if size(text) <= limit {
+		return []string{text}, false
+	}
+	sp := textSplitter{markup: mu, limit: limit, size: size}
+	if p.Mode == SplitAttachment {
+		return []string{sp.first(text)}, true
+	}
+	return sp.split(text), false
+}
+
+// markup is the formatting syntax of the text, which defines the entities splitting should keep intact
+type markup int
+
+const (
+	markupPlain      markup = iota
+	markupHTML              // Telegram HTML
+	markupMarkdown          // Telegram legacy Markdown
+	markupMarkdownV2        // Telegram MarkdownV2
+	markupSlack             // Slack mrkdwn
+)
+
+// telegramMarkup returns markup of Telegram parse mode
+func telegramMarkup(parseMode string) markup {
+	switch parseMode {
+	case "HTML":
+		return markupHTML
+	case "Markdown":
+		return markupMarkdown
+	case "MarkdownV2":
+		return markupMarkdownV2
+	}
+	return markupPlain
+}
+
+// markers returns paired markers of inline entities of Markdown-like markup, longest first
+func (mu markup) markers() []string {
+	switch mu {
+	case markupMarkdown:
+		return []string{"`", "*", "_"}
+	case markupMarkdownV2:
+		return []string{"`", "||", "__", "*", "_", "~"}
+	case markupSlack:
+		return []string{"`", "*", "_", "~"}
+	}
+	return nil
+}
+
+// utf16Len returns length of the string in UTF-16 code units, the way Telegram counts it
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r >= 0x10000 {
+			n++
+		}
+	}
+	return n
+}
+
+// entity is a markup entity, like HTML tag or Markdown code block, open at some position of the text
+type entity struct {
+	name  string // tag name or Markdown marker
+	open  string // text opening the entity again at the start of the next part
+	close string // text closing the entity at the end of the part
+	code  bool   // content is not parsed for other entities
+}
+
+// cutKind is the kind of the boundary text is cut at, in the order of preference
+type cutKind int
+
+const (
+	cutHard cutKind = iota
+	cutWord
+	cutLine
+	cutParagraph
+)
+
+// cutPoint is a position the part could end at
+type cutPoint struct {
+	pos   int
+	kind  cutKind
+	stack []entity // entities open at the position
+}
+
+// textSplitter splits text into parts no longer than limit measured with size, keeping markup entities intact
+type textSplitter struct {
+	markup markup
+	limit  int
+	size   func(string) int
+}
+
+// split returns parts of the text, with the number like "(1/3)" on the last line of every part
+func (sp textSplitter) split(text string) []string {
+	reserve := sp.size(sp.number(999, 999))
+	var parts []string
+	var stack []entity
+	for pos := 0; pos < len(text); {
+		prefix := openEntities(stack)
+		cut, next := sp.cut(text, pos, stack, sp.limit-reserve-sp.size(prefix))
+		parts = append(parts, prefix+text[pos:cut.pos]+closeEntities(cut.stack))
+		pos, stack = next, cut.stack
+	}
+	for i := range parts {
+		parts[i] += sp.number(i+1, len(parts))
+	}
+	return parts
+}
+
+// first returns the beginning of the text fitting the limit
+func (sp textSplitter) first(text string) string {
+	cut, _ := sp.cut(text, 0, nil, sp.limit)
+	return text[:cut.pos] + closeEntities(cut.stack)
+}
+
+// number returns the line with the number of the part
+func (sp textSplitter) number(i, n int) string {
+	if sp.markup == markupMarkdownV2 {
+		return fmt.Sprintf("\n\\(%d/%d\\)", i, n) // parentheses are reserved characters of MarkdownV2
+	}
+	return fmt.Sprintf("\n(%d/%d)", i, n)
+}
+
+// cut finds where the part started at pos with the entities of the stack open should end, to fit the budget
+// with the entities closed, and returns the cut point and the start of the next part. The best cut point
+// is the last paragraph boundary in the second half of the budget, then line and word ones, then the last
+// boundary of any kind, and the text is cut in the middle of the word only if there are no boundaries at all.
+func (sp textSplitter) cut(text string, pos int, stack []entity, budget int) (cutPoint, int) {
+	var best, last, hard *cutPoint
+	used, start := 0, stack
+	for i := pos; ; {
+		closing := sp.size(closeEntities(stack))
+		if i == len(text) && used+closing <= budget {
+			return cutPoint{pos: i, stack: stack}, i
+		}
+		if i > pos && used+closing <= budget {
+			cp := &cutPoint{pos: i, kind: boundaryAt(text, i), stack: stack}
+			hard = cp
+			if cp.kind > cutHard {
+				last = cp
+				if 2*(used+closing) >= budget && (best == nil || cp.kind >= best.kind) {
+					best = cp
+				}
+			}
+		}
+		if i == len(text) {
+			break
+		}
+		n, st := sp.token(text, i, stack)
+		used += sp.size(text[i : i+n])
+		if used > budget {
+			break
+		}
+		i, stack = i+n, st
+	}
+
+	cp := best
+	if cp == nil {
+		cp = last
+	}
+	if cp == nil {
+		cp = hard
+	}
+	if cp == nil {
+		// single token doesn't fit, so it's cut as plain text, at least one character to make progress
+		_, i := utf8.DecodeRuneInString(text[pos:])
+		for i += pos; i < len(text); {
+			_, n := utf8.DecodeRuneInString(text[i:])
+			if sp.size(text[pos:i+n]) > budget {
+				break
+			}
+			i += n
+		}
+		return cutPoint{pos: i, stack: start}, i
+	}
+
+	next := cp.pos
+	switch cp.kind {
+	case cutParagraph:
+		for next < len(text) && text[next] == '\n' {
+			next++
+		}
+	case cutLine:
+		next++
+	case cutWord:
+		for next < len(text) && text[next] == ' ' {
+			next++
+		}
+	}
+	return *cp, next
+}
+
+// boundaryAt returns kind of the boundary at the position of the text
+func boundaryAt(text string, i int) cutKind {
+	switch {
+	case strings.HasPrefix(text[i:], "\n\n"):
+		return cutParagraph
+	case text[i] == '\n':
+		return cutLine
+	case text[i] == ' ':
+		return cutWord
+	}
+	return cutHard
+}
+
+// token returns length of the token at the position, which can't be split, and the stack of entities after it
+func (sp textSplitter) token(text string, i int, stack []entity) (int, []entity) {
+	_, runeLen := utf8.DecodeRuneInString(text[i:])
+	switch sp.markup {
+	case markupHTML:
+		return htmlToken(text, i, runeLen, stack)
+	case markupMarkdown, markupMarkdownV2, markupSlack:
+		return sp.markdownToken(text, i, runeLen, stack)
+	}
+	return runeLen, stack
+}
+
+// htmlToken returns the token of HTML text: tag, character reference or a single character
+func htmlToken(text string, i, runeLen int, stack []entity) (int, []entity) {
+	s := text[i:]
+	switch s[0] {
+	case '<':
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return runeLen, stack
+		}
+		tag := s[:end+1]
+		if strings.HasPrefix(tag, "</") {
+			return len(tag), popEntity(stack, tagName(tag[2:]))
+		}
+		if strings.HasSuffix(tag, "/>") {
+			return len(tag), stack
+		}
+		name := tagName(tag[1:])
+		return len(tag), pushEntity(stack, entity{name: name, open: tag, close: "</" + name + ">"})
+	case '&':
+		end := strings.IndexByte(s, ';')
+		if end > 1 && end <= 10 && !strings.ContainsAny(s[1:end], " \n<&") {
+			return end + 1, stack
+		}
+	}
+	return runeLen, stack
+}
+
+// tagName returns lower-cased name at the start of the tag content
+func tagName(s string) string {
+	end := strings.IndexAny(s, " \t\n/>")
+	if end < 0 {
+		end = len(s)
+	}
+	return strings.ToLower(s[:end])
+}
+
+// markdownToken returns the token of Markdown or Slack mrkdwn text: escaped character, link, marker of the entity
+// or a single character
+func (sp textSplitter) markdownToken(text string, i, runeLen int, stack []entity) (int, []entity) {
+	s := text[i:]
+	var top entity
+	if len(stack) > 0 {
+		top = stack[len(stack)-1]
+	}
+
+	// escaped character, which is not an escape in the code of the legacy Markdown
+	if s[0] == '\\' && len(s) > 1 && (sp.markup == markupMarkdownV2 || sp.markup == markupMarkdown && !top.code) {
+		_, n := utf8.DecodeRuneInString(s[1:])
+		return 1 + n, stack
+	}
+	if top.code {
+		if strings.HasPrefix(s, top.name) {
+			return len(top.name), stack[:len(stack)-1]
+		}
+		return runeLen, stack
+	}
+
+	if strings.HasPrefix(s, "```") && strings.Contains(s[3:], "```") {
+		// code block, with the language on the first line if it's set, like "```go\n"
+		n, lang := 3, ""
+		if eol := strings.IndexByte(s[3:], '\n'); eol >= 0 && !strings.ContainsAny(s[3:3+eol], " \t`") {
+			lang, n = s[3:3+eol], 3+eol+1
+		}
+		return n, pushEntity(stack, entity{name: "```", open: "```" + lang + "\n", close: "\n```", code: true})
+	}
+	for _, m := range sp.markup.markers() {
+		if !strings.HasPrefix(s, m) {
+			continue
+		}
+		if slices.ContainsFunc(stack, func(e entity) bool { return e.name == m }) {
+			return len(m), popEntity(stack, m)
+		}
+		if strings.Contains(s[len(m):], m) {
+			return len(m), pushEntity(stack, entity{name: m, open: m, close: m, code: m == "`"})
+		}
+		return len(m), stack
+	}
+
+	switch {
+	case s[0] == '[' && sp.markup != markupSlack:
+		// link like [text](url)
+		if mid := strings.Index(s, "]("); mid > 0 && !strings.Contains(s[:mid], "\n") {
+			if end := strings.IndexByte(s[mid:], ')'); end > 0 {
+				return mid + end + 1, stack
+			}
+		}
+	case s[0] == '<' && sp.markup == markupSlack:
+		// link or mention like <https://example.org|text> or <@U123>
+		if end := strings.IndexByte(s, '>'); end > 0 && !strings.Contains(s[:end], "\n") {
+			return end + 1, stack
+		}
+	case s[0] == '&' && sp.markup == markupSlack:
+		if end := strings.IndexByte(s, ';'); end > 1 && end <= 10 && !strings.ContainsAny(s[1:end], " \n<&") {
+			return end + 1, stack
+		}
+	}
+	return runeLen, stack
+}
+
+// pushEntity returns copy of the stack with the entity added, so the stacks saved before stay intact
+func pushEntity(stack []entity, e entity) []entity {
+	return append(slices.Clip(stack), e)
+}
+
+// popEntity returns the stack with the last entity of the name and the ones opened after it removed,
+// and the stack unchanged if there is no such entity
+func popEntity(stack []entity, name string) []entity {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].name == name {
+			return stack[:i:i]
+		}
+	}
+	return stack
+}
+
+// openEntities returns text opening the entities of the stack
+func openEntities(stack []entity) string {
+	var b strings.Builder
+	for _, e := range stack {
+		b.WriteString(e.open)
+	}
+	return b.String()
+}
+
+// closeEntities returns text closing the entities of the stack, in the reverse order
+func closeEntities(stack []entity) string {
+	var b strings.Builder
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteString(stack[i].close)
+	}
+	return b.String()
+}
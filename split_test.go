@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextSplitter(t *testing.T) {
+	tbl := []struct {
+		name   string
+		markup markup
+		limit  int
+		text   string
+		parts  []string
+	}{
+		{"paragraphs and lines", markupPlain, 40, "first paragraph\n\nsecond paragraph goes on\nwith more lines\n\nlast",
+			[]string{"first paragraph\n(1/3)", "second paragraph goes on\n(2/3)", "with more lines\n\nlast\n(3/3)"}},
+		{"words", markupPlain, 30, "stack trace goes on and on and on",
+			[]string{"stack trace goes on\n(1/2)", "and on and on\n(2/2)"}},
+		{"no boundaries", markupPlain, 20, strings.Repeat("x", 25),
+			[]string{"xxxxxxxxxx\n(1/3)", "xxxxxxxxxx\n(2/3)", "xxxxx\n(3/3)"}},
+		{"html tags", markupHTML, 40, "<b>bold text that goes long and <i>italic part</i> here</b> tail &amp; more words",
+			[]string{"<b>bold text that goes</b>\n(1/4)", "<b>long and <i>italic</i></b>\n(2/4)", "<b><i>part</i> here</b> tail\n(3/4)",
+				"&amp; more words\n(4/4)"}},
+		{"html pre", markupHTML, 70, "<pre><code class=\"language-go\">line one\nline two\nline three</code></pre>",
+			[]string{"<pre><code class=\"language-go\">line one</code></pre>\n(1/3)",
+				"<pre><code class=\"language-go\">line two</code></pre>\n(2/3)",
+				"<pre><code class=\"language-go\">line three</code></pre>\n(3/3)"}},
+		{"markdown code block", markupMarkdown, 40, "intro\n```go\nline one\nline two\nline three\nline four\n```\nafter *bold words here* end",
+			[]string{"intro\n```go\nline one\n```\n(1/4)", "```go\nline two\nline three\n```\n(2/4)", "```go\nline four\n```\n(3/4)",
+				"after *bold words here* end\n(4/4)"}},
+		{"markdown link", markupMarkdown, 50, "see [the docs](https://example.org/docs) for details",
+			[]string{"see [the docs](https://example.org/docs)\n(1/2)", "for details\n(2/2)"}},
+		{"markdown v2", markupMarkdownV2, 30, "escaped \\* star and ||spoiler text is long|| end",
+			[]string{"escaped \\* star\n\\(1/4\\)", "and ||spoiler||\n\\(2/4\\)", "||text is long||\n\\(3/4\\)", "end\n\\(4/4\\)"}},
+		{"slack", markupSlack, 50, "see <https://example.org/path|the link> and *bold stuff that continues* &amp; done",
+			[]string{"see <https://example.org/path|the link>\n(1/3)", "and *bold stuff that continues* &amp;\n(2/3)", "done\n(3/3)"}},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := textSplitter{markup: tt.markup, limit: tt.limit, size: utf8.RuneCountInString}.split(tt.text)
+			assert.Equal(t, tt.parts, parts)
+			for _, p := range parts {
+				assert.LessOrEqual(t, utf8.RuneCountInString(p), tt.limit, p)
+			}
+		})
+	}
+}
+
+func TestSplitParams(t *testing.T) {
+	text := "first line\nsecond line\nthird line"
+	parts, attach := SplitParams{}.split(text, markupPlain, 100, utf8.RuneCountInString)
+	assert.Equal(t, []string{text}, parts, "text fitting the limit is not split")
+	assert.False(t, attach)
+
+	parts, attach = SplitParams{MaxLength: 30}.split(text, markupPlain, 100, utf8.RuneCountInString)
+	assert.Equal(t, []string{"first line\n(1/3)", "second line\n(2/3)", "third line\n(3/3)"}, parts)
+	assert.False(t, attach)
+
+	parts, _ = SplitParams{MaxLength: 1000}.split(text, markupPlain, 30, utf8.RuneCountInString)
+	assert.Len(t, parts, 3, "max length can't be over the limit of the service")
+
+	long := strings.Repeat("word ", 50)
+	parts, _ = SplitParams{MaxLength: 5}.split(long, markupMarkdownV2, 100, utf8.RuneCountInString)
+	want, _ := SplitParams{MaxLength: splitMinLength}.split(long, markupMarkdownV2, 100, utf8.RuneCountInString)
+	assert.Equal(t, want, parts, "max length too small for the part number is raised to the min")
+	for _, p := range parts {
+		assert.LessOrEqual(t, utf8.RuneCountInString(p), splitMinLength, p)
+		body, _, _ := strings.Cut(p, "\n")
+		assert.Greater(t, len(body), 1, p)
+	}
+
+	parts, attach = SplitParams{Mode: SplitAttachment}.split("<b>"+text+"</b>", markupHTML, 30, utf8.RuneCountInString)
+	assert.Equal(t, []string{"<b>first line\nsecond line</b>"}, parts)
+	assert.True(t, attach)
+
+	assert.Equal(t, 4, utf16Len("a😀б"), "characters outside of the basic plane take two code units")
+
+	mode, err := ParseSplitMode("Attachment")
+	require.NoError(t, err)
+	assert.Equal(t, SplitAttachment, mode)
+	_, err = ParseSplitMode("chunks")
+	require.EqualError(t, err, `unknown split mode "chunks", should be parts or attachment`)
+}
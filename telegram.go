@@ -7,8 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	neturl "net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,8 +27,8 @@ type TelegramParams struct {
 	Token                string        // token for telegram bot API interactions
 	Timeout              time.Duration // http client timeout
 	ErrorMsg, SuccessMsg string        // messages for successful and unsuccessful subscription requests to bot
-
-	apiPrefix string // changed only in tests
+	APIURL               string        // bot API URL the token and the method are appended to, "https://api.telegram.org/bot" by default
+	Split                SplitParams   // how text over 4096 characters is sent, split into numbered parts by default
 }
 
 // Telegram notifications client
@@ -78,8 +80,8 @@ const tgCleanupInterval = time.Minute * 5
 func NewTelegram(params TelegramParams) (*Telegram, error) {
 	res := Telegram{TelegramParams: params}
 
-	if res.apiPrefix == "" {
-		res.apiPrefix = telegramAPIPrefix
+	if res.APIURL == "" {
+		res.APIURL = telegramAPIPrefix
 	}
 	if res.Timeout == 0 {
 		res.Timeout = telegramTimeOut
@@ -91,7 +93,7 @@ func NewTelegram(params TelegramParams) (*Telegram, error) {
 
 	res.apiPollInterval = tgPollInterval
 	res.expiredCleanupInterval = tgCleanupInterval
-	log.Printf("[DEBUG] create new telegram notifier for api=%s, timeout=%s", res.apiPrefix, res.Timeout)
+	log.Printf("[DEBUG] create new telegram notifier for api=%s, timeout=%s", res.APIURL, res.Timeout)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -115,12 +117,76 @@ func NewTelegram(params TelegramParams) (*Telegram, error) {
 // - telegram:channel
 // - telegram:chatID // chatID is a number, like `-1001480738202`
 // - telegram:channel?parseMode=HTML
-func (t *Telegram) Send(ctx context.Context, destination, text string) error {
+//
+// Text longer than 4096 characters is split into parts, keeping HTML tags and Markdown entities intact,
+// or sent with the whole text attached as a file, see SplitParams.
+func (t *Telegram) Send(ctx context.Context, destination, text string) (err error) {
+	ctx, done := startSend(ctx, t.Schema(), destination)
+	defer done(&err)
+	chatID, parseMode, err := t.parseDestination(destination)
+	if err != nil {
+		return fmt.Errorf("problem parsing destination: %w", err)
+	}
+
+	return t.postMessage(ctx, chatID, text, parseMode)
+}
+
+// SendMessage sends Message to Telegram chat, with title in bold and link after the body.
+// Plain text and HTML messages are sent with HTML parse mode, with HTML body stripped of tags
+// not supported by Telegram using TelegramSupportedHTML. Markdown messages are sent with
+// `parseMode` from destination, Markdown by default. Attachments are sent as documents after the message.
+func (t *Telegram) SendMessage(ctx context.Context, destination string, msg Message) (err error) {
+	ctx, done := startSend(ctx, t.Schema(), destination)
+	defer done(&err)
 	chatID, parseMode, err := t.parseDestination(destination)
 	if err != nil {
 		return fmt.Errorf("problem parsing destination: %w", err)
 	}
 
+	text, parseMode := telegramMessageText(msg, parseMode)
+	if err = t.postMessage(ctx, chatID, text, parseMode); err != nil {
+		return err
+	}
+	for _, a := range msg.Attachments {
+		if err = t.sendDocument(ctx, chatID, a); err != nil {
+			return fmt.Errorf("problem sending attachment %s: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// postMessage sends text message to the chat, split into parts or with the whole text attached as a file if it's too long
+func (t *Telegram) postMessage(ctx context.Context, chatID, text, parseMode string) error {
+	parts, attach := t.Split.split(text, telegramMarkup(parseMode), telegramMaxLength, utf16Len)
+	for i, part := range parts {
+		var err error
+		if i > 0 {
+			err = waitRateLimit(ctx) // every part counts against the rate limit, as a separate message
+		}
+		if err == nil {
+			err = t.postPart(ctx, chatID, part, parseMode)
+		}
+		if err != nil {
+			if len(parts) > 1 {
+				return fmt.Errorf("problem sending part %d of %d: %w", i+1, len(parts), err)
+			}
+			return err
+		}
+	}
+	if attach {
+		err := waitRateLimit(ctx)
+		if err == nil {
+			err = t.sendDocument(ctx, chatID, Attachment{Name: splitFileName, Data: []byte(text)})
+		}
+		if err != nil {
+			return fmt.Errorf("problem sending the whole text as a file: %w", err)
+		}
+	}
+	return nil
+}
+
+// postPart sends text message to the chat as is
+func (t *Telegram) postPart(ctx context.Context, chatID, text, parseMode string) error {
 	body := telegramMsg{Text: text, ParseMode: parseMode}
 	b, err := json.Marshal(body)
 	if err != nil {
@@ -128,7 +194,58 @@ func (t *Telegram) Send(ctx context.Context, destination, text string) error {
 	}
 
 	url := fmt.Sprintf("sendMessage?chat_id=%s&disable_web_page_preview=true", chatID)
-	return t.Request(ctx, url, b, &struct{}{})
+	return t.requestOnce(ctx, url, "application/json; charset=utf-8", b, &struct{}{})
+}
+
+// sendDocument sends attachment to the chat as a file
+func (t *Telegram) sendDocument(ctx context.Context, chatID string, a Attachment) error {
+	buf := bytes.Buffer{}
+	mw := multipart.NewWriter(&buf)
+	if err := mw.WriteField("chat_id", chatID); err != nil {
+		return err
+	}
+	fw, err := mw.CreateFormFile("document", a.Name)
+	if err != nil {
+		return err
+	}
+	if _, err = fw.Write(a.Data); err != nil {
+		return err
+	}
+	if err = mw.Close(); err != nil {
+		return err
+	}
+	return t.requestOnce(ctx, "sendDocument", mw.FormDataContentType(), buf.Bytes(), &struct{}{})
+}
+
+// telegramMessageText returns text of the message along with parse mode it should be sent with
+func telegramMessageText(msg Message, parseMode string) (text, mode string) {
+	title, body, link := "", msg.Body, ""
+	switch msg.Format {
+	case FormatMarkdown:
+		mode = parseMode
+		if !strings.HasPrefix(mode, "Markdown") {
+			mode = "Markdown"
+		}
+		if msg.Title != "" {
+			title = "*" + msg.Title + "*"
+		}
+		if msg.Link != "" {
+			link = fmt.Sprintf("[%s](%s)", msg.Link, msg.Link)
+		}
+	default:
+		mode = "HTML"
+		if msg.Title != "" {
+			title = "<b>" + EscapeTelegramText(msg.Title) + "</b>"
+		}
+		body = EscapeTelegramText(msg.Body)
+		if msg.Format == FormatHTML {
+			body = TelegramSupportedHTML(msg.Body)
+		}
+		if msg.Link != "" {
+			link = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(msg.Link), EscapeTelegramText(msg.Link))
+		}
+	}
+	return Message{Title: title, Body: body, Link: link}.Text(), mode
 }
 
 // TelegramSupportedHTML returns HTML with only tags allowed in Telegram HTML message payload, also trims ending newlines
@@ -331,6 +448,9 @@ func (t *Telegram) ProcessUpdate(ctx context.Context, textUpdate string) error {
 	return nil
 }
 
+// instrumented marks Telegram as reporting its sends to Tracer and Metrics itself
+func (t *Telegram) instrumented() {}
+
 // Schema returns schema prefix supported by this client
 func (t *Telegram) Schema() string {
 	return "telegram"
@@ -346,10 +466,10 @@ func (t *Telegram) parseDestination(destination string) (chatID, parseMode strin
 	// parse URL
 	u, err := neturl.Parse(destination)
 	if err != nil {
-		return "", "", err
+		return "", "", invalidDestination(err)
 	}
 	if u.Scheme != "telegram" {
-		return "", "", fmt.Errorf("unsupported scheme %s, should be telegram", u.Scheme)
+		return "", "", unsupportedScheme(u.Scheme, "telegram")
 	}
 
 	chatID = u.Opaque
@@ -365,6 +485,47 @@ func (t *Telegram) parseDestination(destination string) (chatID, parseMode strin
 	return chatID, parseMode, nil
 }
 
+// Validate checks "telegram:" destination: that it has the chat, supported parse mode
+// and only the supported query parameters
+func (t *Telegram) Validate(destination string) error {
+	chatID, parseMode, err := t.parseDestination(destination)
+	if err != nil {
+		return err
+	}
+	if chatID == "@" {
+		return invalidDestination(errors.New("no chat in telegram destination"))
+	}
+	if !slices.ContainsFunc([]string{"Markdown", "MarkdownV2", "HTML"}, func(m string) bool { return strings.EqualFold(m, parseMode) }) {
+		return invalidDestination(fmt.Errorf("unsupported parse mode %q, should be Markdown, MarkdownV2 or HTML", parseMode))
+	}
+	u, err := neturl.Parse(destination)
+	if err != nil {
+		return invalidDestination(err)
+	}
+	return checkQueryParams(u, "parseMode")
+}
+
+// ValidateOnline checks "telegram:" destination, and that the chat exists and is available to the bot, with getChat
+func (t *Telegram) ValidateOnline(ctx context.Context, destination string) error {
+	if err := t.Validate(destination); err != nil {
+		return err
+	}
+	chatID, _, err := t.parseDestination(destination)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		OK bool `json:"ok"`
+	}
+	if err = t.Request(ctx, "getChat?chat_id="+neturl.QueryEscape(chatID), nil, &resp); err != nil {
+		return fmt.Errorf("problem checking chat %s: %w", chatID, err)
+	}
+	if !resp.OK {
+		return fmt.Errorf("problem checking chat %s: unexpected telegram API response", chatID)
+	}
+	return nil
+}
+
 // getUpdates fetches incoming updates
 func (t *Telegram) getUpdates(ctx context.Context) (*TelegramUpdate, error) {
 	url := `getUpdates?allowed_updates=["message"]`
@@ -452,40 +613,59 @@ func (t *Telegram) botInfo(ctx context.Context) (*TelegramBotInfo, error) {
 
 // Request makes a request to the Telegram API and return the result
 func (t *Telegram) Request(ctx context.Context, method string, b []byte, data any) error {
-	return repeater.NewFixed(3, time.Millisecond*250).Do(ctx, func() error {
-		url := fmt.Sprintf("%s%s/%s", t.apiPrefix, t.Token, method)
+	contentType := ""
+	if b != nil {
+		contentType = "application/json; charset=utf-8"
+	}
+	return t.request(ctx, method, contentType, b, data)
+}
 
-		var req *http.Request
-		var err error
-		if b == nil {
-			req, err = http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
-		} else {
-			req, err = http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
-		}
-		if err != nil {
-			return fmt.Errorf("failed to create request: %w", t.redactToken(err))
-		}
-		if b != nil {
-			req.Header.Set("Content-Type", "application/json; charset=utf-8")
-		}
+// request makes a request to the Telegram API with the body of provided content type, GET request if body is nil.
+// Failed request is retried, unless the error is permanent.
+func (t *Telegram) request(ctx context.Context, method, contentType string, b []byte, data any) error {
+	rpt := repeater.NewFixed(3, time.Millisecond*250)
+	rpt.SetErrorClassifier(isRetryable)
+	return rpt.Do(ctx, func() error { return t.requestOnce(ctx, method, contentType, b, data) })
+}
 
-		client := http.Client{Timeout: t.Timeout}
-		resp, err := client.Do(req)
-		if err != nil {
-			return fmt.Errorf("failed to send request: %w", t.redactToken(err))
-		}
-		defer resp.Body.Close()
+// requestOnce makes a single request to the Telegram API, used for sending messages. Failed send is not retried here,
+// so that retries of Send are controlled by WithRetry only.
+func (t *Telegram) requestOnce(ctx context.Context, method, contentType string, b []byte, data any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s%s/%s", t.APIURL, t.Token, method)
+
+	var req *http.Request
+	var err error
+	if b == nil {
+		req, err = http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", t.redactToken(err))
+	}
+	if b != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			return t.parseError(resp.Body, resp.StatusCode)
-		}
+	client := http.Client{Timeout: t.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", t.redactToken(err))
+	}
+	defer resp.Body.Close()
 
-		if err = json.NewDecoder(resp.Body).Decode(data); err != nil {
-			return fmt.Errorf("failed to decode json response: %w", err)
-		}
+	if resp.StatusCode != http.StatusOK {
+		return t.parseError(resp.Body, resp.StatusCode)
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(data); err != nil {
+		return fmt.Errorf("failed to decode json response: %w", err)
+	}
 
-		return nil
-	})
+	return nil
 }
 
 // redactToken hides the bot token in the URL of *url.Error returned by the http client,
@@ -498,12 +678,64 @@ func (t *Telegram) redactToken(err error) error {
 	return &neturl.Error{Op: urlErr.Op, URL: strings.ReplaceAll(urlErr.URL, t.Token, "<redacted>"), Err: urlErr.Err}
 }
 
+// parseError returns HTTPStatusError for non-OK response of Telegram API, matching ErrRecipientBlocked
+// or ErrInvalidDestination if the description tells so. Client errors are permanent as the same request
+// fails again, except for 429 Too Many Requests.
 func (t *Telegram) parseError(r io.Reader, statusCode int) error {
 	tgErr := struct {
 		Description string `json:"description"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
 	}{}
+	res := &HTTPStatusError{StatusCode: statusCode}
 	if err := json.NewDecoder(r).Decode(&tgErr); err != nil {
-		return fmt.Errorf("unexpected telegram API status code %d", statusCode)
+		res.msg = fmt.Sprintf("unexpected telegram API status code %d", statusCode)
+		return statusError(res)
+	}
+	res.Body = tgErr.Description
+	res.RetryAfter = time.Duration(tgErr.Parameters.RetryAfter) * time.Second
+	res.msg = fmt.Sprintf("unexpected telegram API status code %d, error: %q", statusCode, tgErr.Description)
+
+	description := strings.ToLower(tgErr.Description)
+	switch {
+	case containsAny(description, telegramBlockedErrors):
+		return Permanent(markError(res, ErrRecipientBlocked))
+	case containsAny(description, telegramDestinationErrors):
+		return invalidDestination(res)
+	}
+	return statusError(res)
+}
+
+// descriptions of Telegram API errors, by the sentinel errors they match
+var (
+	telegramBlockedErrors = []string{"bot was blocked by the user", "user is deactivated", "bot was kicked",
+		"bot is not a member", "have no rights to send", "not enough rights to send"}
+	telegramDestinationErrors = []string{"chat not found", "user not found", "peer_id_invalid"}
+)
+
+// containsAny reports whether s contains any of substrings
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRateLimit returns rate limit of Telegram Bot API: 30 messages per second overall
+// and 1 message per second in a single chat, see https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+func (t *Telegram) DefaultRateLimit() RateLimit {
+	return RateLimit{
+		Global:         Rate{Every: time.Second / 30, Burst: 30},
+		PerDestination: Rate{Every: time.Second, Burst: 1},
+		Key: func(destination string) string {
+			chatID, _, err := t.parseDestination(destination)
+			if err != nil {
+				return destination
+			}
+			return chatID
+		},
 	}
-	return fmt.Errorf("unexpected telegram API status code %d, error: %q", statusCode, tgErr.Description)
 }
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	neturl "net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -24,8 +25,8 @@ func TestTelegram_New(t *testing.T) {
 	defer ts.Close()
 
 	tb, err := NewTelegram(TelegramParams{
-		Token:     "good-token",
-		apiPrefix: ts.URL + "/",
+		Token:  "good-token",
+		APIURL: ts.URL + "/",
 	})
 	require.NoError(t, err)
 	assert.NotNil(t, tb)
@@ -34,46 +35,44 @@ func TestTelegram_New(t *testing.T) {
 	assert.Equal(t, "telegram notifications destination", tb.String())
 
 	_, err = NewTelegram(TelegramParams{
-		Token:     "empty-json",
-		apiPrefix: ts.URL + "/",
+		Token:  "empty-json",
+		APIURL: ts.URL + "/",
 	})
 	require.EqualError(t, err, "can't retrieve bot info from Telegram API: received empty result")
 
-	st := time.Now()
 	_, err = NewTelegram(TelegramParams{ //nolint:gosec // G101: test fixture token, not a real credential
-		Token:     "non-json-resp",
-		Timeout:   2 * time.Second,
-		apiPrefix: ts.URL + "/",
+		Token:   "non-json-resp",
+		Timeout: 2 * time.Second,
+		APIURL:  ts.URL + "/",
 	})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to decode json response:")
-	assert.GreaterOrEqual(t, time.Since(st), 250*2*time.Millisecond)
 
 	_, err = NewTelegram(TelegramParams{
-		Token:     "404",
-		Timeout:   2 * time.Second,
-		apiPrefix: ts.URL + "/",
+		Token:   "404",
+		Timeout: 2 * time.Second,
+		APIURL:  ts.URL + "/",
 	})
 	require.EqualError(t, err, "can't retrieve bot info from Telegram API: unexpected telegram API status code 404")
 
 	_, err = NewTelegram(TelegramParams{
-		Token:     "no-such-thing",
-		apiPrefix: "http://127.0.0.1:4321/",
+		Token:  "no-such-thing",
+		APIURL: "http://127.0.0.1:4321/",
 	})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "can't retrieve bot info from Telegram API")
 	assert.Contains(t, err.Error(), "dial tcp 127.0.0.1:4321: connect: connection refused")
 
 	_, err = NewTelegram(TelegramParams{
-		Token:     "",
-		apiPrefix: "",
+		Token:  "",
+		APIURL: "",
 	})
 	require.Error(t, err, "empty api url not allowed")
 
 	_, err = NewTelegram(TelegramParams{
-		Token:     "good-token",
-		Timeout:   2 * time.Second,
-		apiPrefix: ts.URL + "/",
+		Token:   "good-token",
+		Timeout: 2 * time.Second,
+		APIURL:  ts.URL + "/",
 	})
 	require.NoError(t, err, "0 timeout allowed as default")
 }
@@ -83,8 +82,8 @@ func TestTelegram_Send(t *testing.T) {
 	defer ts.Close()
 
 	tb, err := NewTelegram(TelegramParams{
-		Token:     "good-token",
-		apiPrefix: ts.URL + "/",
+		Token:  "good-token",
+		APIURL: ts.URL + "/",
 	})
 	require.NoError(t, err)
 	assert.NotNil(t, tb)
@@ -94,15 +93,15 @@ func TestTelegram_Send(t *testing.T) {
 
 	tb = &Telegram{
 		TelegramParams: TelegramParams{ //nolint:gosec // G101: test fixture token, not a real credential
-			Token:     "non-json-resp",
-			apiPrefix: ts.URL + "/",
+			Token:  "non-json-resp",
+			APIURL: ts.URL + "/",
 		}}
 	err = tb.Send(context.Background(), "telegram:test_user_channel", "test message")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "unexpected telegram API status code 404", "send on broken tg")
 
 	// bad API URL
-	tb.apiPrefix = "http://non-existent"
+	tb.APIURL = "http://non-existent"
 	err = tb.Send(context.Background(), "telegram:test_user_channel", "test message")
 	require.Error(t, err)
 }
@@ -195,8 +194,8 @@ func TestTelegramSendClientError(t *testing.T) {
 	defer ts.Close()
 
 	tg, err := NewTelegram(TelegramParams{
-		Token:     "good-token",
-		apiPrefix: ts.URL + "/",
+		Token:  "good-token",
+		APIURL: ts.URL + "/",
 	})
 	require.NoError(t, err)
 	assert.NotNil(t, tg)
@@ -224,8 +223,8 @@ func TestTelegram_GetBotUsername(t *testing.T) {
 	defer ts.Close()
 
 	tb, err := NewTelegram(TelegramParams{
-		Token:     "good-token",
-		apiPrefix: ts.URL + "/",
+		Token:  "good-token",
+		APIURL: ts.URL + "/",
 	})
 	require.NoError(t, err)
 	assert.NotNil(t, tb)
@@ -302,8 +301,8 @@ func TestTelegram_GetUpdatesFlow(t *testing.T) {
 	})
 	defer ts.Close()
 	tb, err := NewTelegram(TelegramParams{
-		Token:     "xxxsupersecretxxx",
-		apiPrefix: ts.URL + "/",
+		Token:  "xxxsupersecretxxx",
+		APIURL: ts.URL + "/",
 	})
 	require.NoError(t, err)
 
@@ -336,8 +335,8 @@ func TestTelegram_ProcessUpdateFlow(t *testing.T) {
 	})
 	defer ts.Close()
 	tb, err := NewTelegram(TelegramParams{
-		Token:     "xxxsupersecretxxx",
-		apiPrefix: ts.URL + "/",
+		Token:  "xxxsupersecretxxx",
+		APIURL: ts.URL + "/",
 	})
 	require.NoError(t, err)
 
@@ -390,8 +389,8 @@ func TestTelegram_SendText(t *testing.T) {
 	})
 	defer ts.Close()
 	tb, err := NewTelegram(TelegramParams{
-		Token:     "xxxsupersecretxxx",
-		apiPrefix: ts.URL + "/",
+		Token:  "xxxsupersecretxxx",
+		APIURL: ts.URL + "/",
 	})
 	require.NoError(t, err)
 
@@ -409,7 +408,7 @@ func TestTelegram_RequestDoesNotLeakToken(t *testing.T) {
 	ts := mockTelegramServer(func(w http.ResponseWriter, _ *http.Request) {
 		_, _ = w.Write([]byte(getMeResp))
 	})
-	tb, err := NewTelegram(TelegramParams{Token: token, apiPrefix: ts.URL + "/"})
+	tb, err := NewTelegram(TelegramParams{Token: token, APIURL: ts.URL + "/"})
 	require.NoError(t, err)
 
 	t.Run("connection error", func(t *testing.T) {
@@ -427,7 +426,7 @@ func TestTelegram_RequestDoesNotLeakToken(t *testing.T) {
 			_, _ = w.Write([]byte(getMeResp))
 		}))
 		defer slow.Close()
-		tbSlow := &Telegram{TelegramParams: TelegramParams{Token: token, Timeout: time.Millisecond, apiPrefix: slow.URL + "/"}}
+		tbSlow := &Telegram{TelegramParams: TelegramParams{Token: token, Timeout: time.Millisecond, APIURL: slow.URL + "/"}}
 		err = tbSlow.Request(context.Background(), "getUpdates", nil, &struct{}{})
 		require.Error(t, err)
 		assert.NotContains(t, err.Error(), token)
@@ -468,7 +467,7 @@ func TestTelegram_RequestKeepsDefaultTransportPool(t *testing.T) {
 		_, _ = w.Write([]byte(getMeResp))
 	})
 	defer ts.Close()
-	tb, err := NewTelegram(TelegramParams{Token: "good-token", apiPrefix: ts.URL + "/"})
+	tb, err := NewTelegram(TelegramParams{Token: "good-token", APIURL: ts.URL + "/"})
 	require.NoError(t, err)
 	require.NoError(t, tb.Request(context.Background(), "getMe", nil, &struct{}{}))
 
@@ -485,8 +484,8 @@ func TestTelegram_Error(t *testing.T) {
 	})
 	defer ts.Close()
 	tb, err := NewTelegram(TelegramParams{
-		Token:     "xxxsupersecretxxx",
-		apiPrefix: ts.URL + "/",
+		Token:  "xxxsupersecretxxx",
+		APIURL: ts.URL + "/",
 	})
 	require.NoError(t, err)
 
@@ -507,8 +506,8 @@ func TestTelegram_TokenVerification(t *testing.T) {
 	defer ts.Close()
 
 	tb, err := NewTelegram(TelegramParams{
-		Token:     "good-token",
-		apiPrefix: ts.URL + "/",
+		Token:  "good-token",
+		APIURL: ts.URL + "/",
 	})
 	require.NoError(t, err)
 	assert.NotNil(t, tb)
@@ -578,7 +577,7 @@ func TestTelegram_TokenVerification(t *testing.T) {
 func TestTelegram_CheckTokenIsSingleUse(t *testing.T) {
 	ts := mockTelegramServer(nil)
 	defer ts.Close()
-	tb, err := NewTelegram(TelegramParams{Token: "good-token", apiPrefix: ts.URL + "/"})
+	tb, err := NewTelegram(TelegramParams{Token: "good-token", APIURL: ts.URL + "/"})
 	require.NoError(t, err)
 
 	for i := 0; i < 50; i++ {
@@ -611,7 +610,7 @@ func TestTelegram_ConcurrentConfirmAndCheck(t *testing.T) {
 		_, _ = w.Write([]byte(`{}`))
 	})
 	defer ts.Close()
-	tb, err := NewTelegram(TelegramParams{Token: "good-token", apiPrefix: ts.URL + "/"})
+	tb, err := NewTelegram(TelegramParams{Token: "good-token", APIURL: ts.URL + "/"})
 	require.NoError(t, err)
 
 	for i := 0; i < 30; i++ {
@@ -662,7 +661,7 @@ func TestTelegram_RunSingleInstance(t *testing.T) {
 		_, _ = w.Write([]byte(`{"result":[]}`))
 	})
 	defer ts.Close()
-	tb, err := NewTelegram(TelegramParams{Token: "good-token", apiPrefix: ts.URL + "/"})
+	tb, err := NewTelegram(TelegramParams{Token: "good-token", APIURL: ts.URL + "/"})
 	require.NoError(t, err)
 	tb.apiPollInterval = time.Millisecond * 10
 	tb.expiredCleanupInterval = time.Millisecond * 10
@@ -708,6 +707,43 @@ const getMeResp = `{"ok": true,
 					"username": "remark42_test_bot"
 				}}`
 
+func TestTelegram_Validate(t *testing.T) {
+	ts := mockTelegramServer(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "getChat") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("chat_id") != "@channel" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "result": {"id": -1001480738202, "type": "channel"}}`))
+	})
+	defer ts.Close()
+	tb, err := NewTelegram(TelegramParams{Token: "good-token", APIURL: ts.URL + "/"})
+	require.NoError(t, err)
+
+	require.NoError(t, tb.Validate("telegram:channel?parseMode=HTML"))
+	require.NoError(t, tb.Validate("telegram:-1001480738202?parseMode=markdownv2"))
+	for destination, errText := range map[string]string{
+		"telegram:":                        "no chat in telegram destination",
+		"telegram:channel?parseMode=html5": `unsupported parse mode "html5", should be Markdown, MarkdownV2 or HTML`,
+		"telegram:channel?parse_mode=HTML": "unknown query parameters parse_mode, supported are parseMode",
+		"slack:channel":                    "unsupported scheme slack, should be telegram",
+	} {
+		err = tb.Validate(destination)
+		require.EqualError(t, err, errText, destination)
+		require.ErrorIs(t, err, ErrInvalidDestination, destination)
+	}
+
+	require.NoError(t, tb.ValidateOnline(context.Background(), "telegram:channel"))
+	require.ErrorIs(t, tb.ValidateOnline(context.Background(), "telegram:"), ErrInvalidDestination)
+	err = tb.ValidateOnline(context.Background(), "telegram:other")
+	require.EqualError(t, err, "problem checking chat @other: unexpected telegram API status code 400, error: \"Bad Request: chat not found\"")
+	require.ErrorIs(t, err, ErrInvalidDestination)
+}
+
 func mockTelegramServer(h http.HandlerFunc) *httptest.Server {
 	if h != nil {
 		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -738,3 +774,247 @@ func mockTelegramServer(h http.HandlerFunc) *httptest.Server {
 
 	return httptest.NewServer(mux)
 }
+
+func TestTelegram_SendMessage(t *testing.T) {
+	var sent []telegramMsg
+	var documents []string
+	ts := mockTelegramServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "sendMessage"):
+			assert.Equal(t, "@channel", r.URL.Query().Get("chat_id"))
+			var msg telegramMsg
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+			sent = append(sent, msg)
+		case strings.Contains(r.URL.Path, "sendDocument"):
+			assert.Equal(t, "@channel", r.FormValue("chat_id"))
+			f, h, err := r.FormFile("document")
+			if !assert.NoError(t, err) {
+				return
+			}
+			data, _ := io.ReadAll(f)
+			documents = append(documents, h.Filename+":"+string(data))
+		}
+		_, _ = w.Write([]byte(`{"ok": true}`))
+	})
+	defer ts.Close()
+
+	tb, err := NewTelegram(TelegramParams{Token: "good-token", APIURL: ts.URL + "/"})
+	require.NoError(t, err)
+
+	tbl := []struct {
+		name, destination string
+		msg               Message
+		res               telegramMsg
+	}{
+		{"plain", "telegram:channel", Message{Title: "<title>", Body: "a < b", Link: "https://example.org/?a=1&b=2"},
+			telegramMsg{Text: "<b>&lt;title&gt;</b>\n\na &lt; b\n\n<a href=\"https://example.org/?a=1&amp;b=2\">https://example.org/?a=1&amp;b=2</a>",
+				ParseMode: "HTML"}},
+		{"html", "telegram:channel", Message{Body: "<h1>header</h1><p>text</p>", Format: FormatHTML},
+			telegramMsg{Text: "<b>header</b>text", ParseMode: "HTML"}},
+		{"markdown", "telegram:channel", Message{Title: "title", Body: "_text_", Format: FormatMarkdown},
+			telegramMsg{Text: "*title*\n\n_text_", ParseMode: "Markdown"}},
+		{"markdown v2", "telegram:channel?parseMode=MarkdownV2", Message{Body: "text", Link: "https://example.org", Format: FormatMarkdown},
+			telegramMsg{Text: "text\n\n[https://example.org](https://example.org)", ParseMode: "MarkdownV2"}},
+		{"markdown with html destination", "telegram:channel?parseMode=HTML", Message{Body: "text", Format: FormatMarkdown},
+			telegramMsg{Text: "text", ParseMode: "Markdown"}},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			sent = nil
+			require.NoError(t, tb.SendMessage(context.Background(), tt.destination, tt.msg))
+			assert.Equal(t, []telegramMsg{tt.res}, sent)
+		})
+	}
+
+	sent = nil
+	require.NoError(t, tb.SendMessage(context.Background(), "telegram:channel", Message{Body: "logs",
+		Attachments: []Attachment{{Name: "a.log", Data: []byte("line a")}, {Name: "b.log", Data: []byte("line b")}}}))
+	assert.Len(t, sent, 1)
+	assert.Equal(t, []string{"a.log:line a", "b.log:line b"}, documents)
+
+	require.EqualError(t, tb.SendMessage(context.Background(), "slack:channel", Message{}),
+		"problem parsing destination: unsupported scheme slack, should be telegram")
+}
+
+func TestTelegram_Split(t *testing.T) {
+	var sent []telegramMsg
+	var documents []string
+	ts := mockTelegramServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "sendMessage"):
+			var msg telegramMsg
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+			if strings.HasPrefix(msg.Text, "fail") {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"ok": false, "error_code": 400, "description": "Bad Request"}`))
+				return
+			}
+			sent = append(sent, msg)
+		case strings.Contains(r.URL.Path, "sendDocument"):
+			f, h, err := r.FormFile("document")
+			if !assert.NoError(t, err) {
+				return
+			}
+			data, _ := io.ReadAll(f)
+			documents = append(documents, h.Filename+":"+string(data))
+		}
+		_, _ = w.Write([]byte(`{"ok": true}`))
+	})
+	defer ts.Close()
+
+	text := "<b>build failed</b>\n\n<pre>error one\nerror two</pre>"
+	tb, err := NewTelegram(TelegramParams{Token: "good-token", APIURL: ts.URL + "/", Split: SplitParams{MaxLength: 35}})
+	require.NoError(t, err)
+	require.NoError(t, tb.Send(context.Background(), "telegram:channel?parseMode=HTML", text))
+	assert.Equal(t, []telegramMsg{
+		{Text: "<b>build failed</b>\n(1/3)", ParseMode: "HTML"},
+		{Text: "<pre>error one</pre>\n(2/3)", ParseMode: "HTML"},
+		{Text: "<pre>error two</pre>\n(3/3)", ParseMode: "HTML"},
+	}, sent)
+	assert.Empty(t, documents)
+
+	// parts are separate messages, each counting against the rate limit of the chat
+	sent = nil
+	st := time.Now()
+	require.NoError(t, WithRateLimit(tb, RateLimit{PerDestination: Rate{Every: time.Millisecond * 50}}).
+		Send(context.Background(), "telegram:channel?parseMode=HTML", text))
+	assert.Len(t, sent, 3)
+	assert.GreaterOrEqual(t, time.Since(st), time.Millisecond*90, "parts are paced")
+
+	err = tb.Send(context.Background(), "telegram:channel", "first part is ok, really\n\nfail of the second one")
+	require.ErrorContains(t, err, "problem sending part 2 of 2")
+
+	sent = nil
+	tb, err = NewTelegram(TelegramParams{Token: "good-token", APIURL: ts.URL + "/", Split: SplitParams{MaxLength: 35, Mode: SplitAttachment}})
+	require.NoError(t, err)
+	require.NoError(t, tb.Send(context.Background(), "telegram:channel?parseMode=HTML", text))
+	assert.Equal(t, []telegramMsg{{Text: "<b>build failed</b>", ParseMode: "HTML"}}, sent)
+	assert.Equal(t, []string{"message.txt:" + text}, documents)
+}
+
+func TestTelegram_Retry(t *testing.T) {
+	for _, tc := range []struct {
+		status    int
+		requests  int32
+		permanent bool
+	}{
+		{status: http.StatusBadRequest, requests: 1, permanent: true},
+		{status: http.StatusForbidden, requests: 1, permanent: true},
+		{status: http.StatusTooManyRequests, requests: 3},
+		{status: http.StatusInternalServerError, requests: 3},
+	} {
+		t.Run(strconv.Itoa(tc.status), func(t *testing.T) {
+			var requests atomic.Int32
+			ts := mockTelegramServer(func(w http.ResponseWriter, _ *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(errorResp))
+			})
+			defer ts.Close()
+			tb, err := NewTelegram(TelegramParams{Token: "test-token", APIURL: ts.URL + "/"})
+			require.NoError(t, err)
+
+			err = tb.Send(context.Background(), "telegram:test", "text")
+			require.Error(t, err)
+			assert.Equal(t, tc.permanent, IsPermanent(err))
+			assert.Equal(t, int32(1), requests.Load(), "telegram doesn't retry by itself")
+
+			requests.Store(0)
+			err = WithRetry(tb, RetryPolicy{Delay: time.Millisecond}).Send(context.Background(), "telegram:test", "text")
+			require.Error(t, err)
+			assert.Equal(t, tc.requests, requests.Load(), "retries are made by WithRetry only")
+		})
+	}
+}
+
+func TestTelegram_RetryInternalRequests(t *testing.T) {
+	var getMe, getUpdates atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "getMe"):
+			if getMe.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(getMeResp))
+		case strings.Contains(r.URL.Path, "getUpdates"):
+			if getUpdates.Add(1) < 3 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(`{"ok": true, "result": []}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	tb, err := NewTelegram(TelegramParams{Token: "test-token", APIURL: ts.URL + "/"})
+	require.NoError(t, err, "failed getMe is retried")
+	assert.Equal(t, int32(2), getMe.Load())
+
+	updates, err := tb.getUpdates(context.Background())
+	require.NoError(t, err, "failed getUpdates is retried")
+	assert.Empty(t, updates.Result)
+	assert.Equal(t, int32(3), getUpdates.Load())
+}
+
+func TestTelegram_RetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	ts := mockTelegramServer(func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true}`))
+	})
+	defer ts.Close()
+	tb, err := NewTelegram(TelegramParams{Token: "test-token", APIURL: ts.URL + "/"})
+	require.NoError(t, err)
+
+	st := time.Now()
+	require.NoError(t, WithRetry(tb, RetryPolicy{Delay: time.Millisecond}).Send(context.Background(), "telegram:test", "text"))
+	assert.Equal(t, int32(2), requests.Load())
+	assert.GreaterOrEqual(t, time.Since(st), time.Second, "retry waits as long as telegram asked")
+}
+
+func TestTelegram_StatusError(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		status     int
+		resp       string
+		sentinel   error
+		retryAfter time.Duration
+	}{
+		{name: "blocked", status: http.StatusForbidden, sentinel: ErrRecipientBlocked,
+			resp: `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`},
+		{name: "unknown chat", status: http.StatusBadRequest, sentinel: ErrInvalidDestination,
+			resp: `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`},
+		{name: "rate limited", status: http.StatusTooManyRequests, sentinel: ErrRateLimited, retryAfter: 5 * time.Second,
+			resp: `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 5","parameters":{"retry_after":5}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tb := &Telegram{}
+			err := tb.parseError(strings.NewReader(tc.resp), tc.status)
+			require.ErrorIs(t, err, tc.sentinel)
+			var statusErr *HTTPStatusError
+			require.ErrorAs(t, err, &statusErr)
+			assert.Equal(t, tc.status, statusErr.StatusCode)
+			assert.Equal(t, tc.retryAfter, statusErr.RetryAfter)
+			assert.NotEmpty(t, statusErr.Body)
+			assert.Contains(t, err.Error(), fmt.Sprintf("unexpected telegram API status code %d, error: ", tc.status))
+		})
+	}
+
+	err := (&Telegram{}).parseError(strings.NewReader("not json"), http.StatusBadGateway)
+	require.EqualError(t, err, "unexpected telegram API status code 502")
+	require.NotErrorIs(t, err, ErrRateLimited)
+	assert.False(t, IsPermanent(err))
+
+	ts := mockTelegramServer(nil)
+	defer ts.Close()
+	tb, err := NewTelegram(TelegramParams{Token: "good-token", APIURL: ts.URL + "/"})
+	require.NoError(t, err)
+	require.ErrorIs(t, tb.Send(context.Background(), "slack:general", "text"), ErrUnsupportedSchema)
+}
@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"unicode/utf8"
+)
+
+// Templates keeps templates of messages, with the template of the same name rendered differently for every
+// destination. Template is registered for the key, which is either the full destination, the schema of destinations,
+// or empty string for any destination. Templates have TemplateFuncs available.
+//
+// Example:
+//
+//	tmpl := notify.NewTemplates()
+//	err := tmpl.AddHTML("deploy", "mailto", `<p>{{.Service}} is deployed</p>`)
+//	err = tmpl.AddText("deploy", "slack", `*{{.Service | slackEscape}}* is deployed`)
+//	err = tmpl.AddText("deploy", "https", `{"text": {{printf "%s is deployed" .Service | json}}}`)
+type Templates struct {
+	mu        sync.RWMutex
+	templates map[string]map[string]templateExecutor // by name and key
+}
+
+// templateExecutor is either text or HTML template
+type templateExecutor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// TemplateFuncs returns functions available in Templates:
+//
+//   - telegramHTML: TelegramSupportedHTML
+//   - escapeTelegram: EscapeTelegramText
+//   - slackEscape: escapes "&", "<" and ">" for Slack mrkdwn
+//   - json: JSON encoding of the value, quoted and escaped string for strings
+//   - truncate: cuts string to the number of characters, with "…" at the end if it was longer, as `{{.Text | truncate 100}}`
+func TemplateFuncs() map[string]any {
+	return map[string]any{
+		"telegramHTML":   TelegramSupportedHTML,
+		"escapeTelegram": EscapeTelegramText,
+		"slackEscape":    slackEscape,
+		"json":           jsonValue,
+		"truncate":       truncate,
+	}
+}
+
+// NewTemplates makes empty Templates
+func NewTemplates() *Templates {
+	return &Templates{templates: map[string]map[string]templateExecutor{}}
+}
+
+// AddText parses text/template for the name and key, for plain text, Markdown or JSON messages
+func (t *Templates) AddText(name, key, text string) error {
+	tmpl, err := texttemplate.New(name).Funcs(TemplateFuncs()).Parse(text)
+	if err != nil {
+		return fmt.Errorf("problem parsing template %q for %q: %w", name, key, err)
+	}
+	t.add(name, key, tmpl)
+	return nil
+}
+
+// AddHTML parses html/template for the name and key, for HTML messages, like email with "text/html" content type
+// or Telegram with HTML parse mode. Output of telegramHTML func is not escaped.
+func (t *Templates) AddHTML(name, key, text string) error {
+	funcs := TemplateFuncs()
+	funcs["telegramHTML"] = func(s string) htmltemplate.HTML { return htmltemplate.HTML(TelegramSupportedHTML(s)) } //nolint:gosec // only tags allowed by Telegram are kept
+	tmpl, err := htmltemplate.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("problem parsing template %q for %q: %w", name, key, err)
+	}
+	t.add(name, key, tmpl)
+	return nil
+}
+
+// Render renders the template of the name for the destination with the data. Template registered for the full
+// destination is used first, then the one for its schema, and then the one for any destination.
+func (t *Templates) Render(name, destination string, data any) (string, error) {
+	t.mu.RLock()
+	byKey := t.templates[name]
+	tmpl, ok := byKey[destination]
+	if !ok {
+		tmpl, ok = byKey[destinationScheme(destination)]
+	}
+	if !ok {
+		tmpl, ok = byKey[""]
+	}
+	t.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("template %q for %s is not found", name, redactDestination(destination))
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("problem rendering template %q for %s: %w", name, redactDestination(destination), err)
+	}
+	return buf.String(), nil
+}
+
+// SendTemplate renders the template of the name for the destination and sends it,
+// picking the notifier the same way Send does
+func (t *Templates) SendTemplate(ctx context.Context, notifiers []Notifier, destination, name string, data any) error {
+	n, err := findNotifier(notifiers, destination)
+	if err != nil {
+		return err
+	}
+	text, err := t.Render(name, destination, data)
+	if err != nil {
+		return Permanent(err)
+	}
+	return n.Send(ctx, destination, text)
+}
+
+// add registers parsed template
+func (t *Templates) add(name, key string, tmpl templateExecutor) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.templates[name] == nil {
+		t.templates[name] = map[string]templateExecutor{}
+	}
+	t.templates[name][key] = tmpl
+}
+
+// slackEscape escapes control characters of Slack mrkdwn
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// jsonValue returns JSON encoding of the value
+func jsonValue(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("problem encoding to json: %w", err)
+	}
+	return string(b), nil
+}
+
+// truncate cuts the string to n characters, with "…" as the last one if it was longer
+func truncate(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
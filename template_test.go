@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplates_Render(t *testing.T) {
+	tmpl := NewTemplates()
+	require.NoError(t, tmpl.AddHTML("deploy", "mailto", `<p>{{.Service}} is deployed</p>{{.Notes | telegramHTML}}`))
+	require.NoError(t, tmpl.AddHTML("deploy", "telegram", `<b>{{.Service}}</b> {{.Notes | telegramHTML}}`))
+	require.NoError(t, tmpl.AddText("deploy", "slack", `*{{.Service | slackEscape}}* is deployed`))
+	require.NoError(t, tmpl.AddText("deploy", "https", `{"text": {{printf "%s is deployed" .Service | json}}}`))
+	require.NoError(t, tmpl.AddText("deploy", "https://example.org/special", `special {{.Service | truncate 4}}`))
+	require.NoError(t, tmpl.AddText("deploy", "", `{{.Service}} is deployed`))
+
+	data := struct{ Service, Notes string }{Service: `api<"v2">`, Notes: "<p>all <b>good</b></p>"}
+	tbl := []struct {
+		destination, res string
+	}{
+		{"mailto:ops@example.org", `<p>api&lt;&#34;v2&#34;&gt; is deployed</p>all <b>good</b>`},
+		{"telegram:ops?parseMode=HTML", `<b>api&lt;&#34;v2&#34;&gt;</b> all <b>good</b>`},
+		{"slack:ops", `*api&lt;"v2"&gt;* is deployed`},
+		{"https://example.org/hook", `{"text": "api\u003c\"v2\"\u003e is deployed"}`},
+		{"https://example.org/special", `special api…`},
+		{"test:dst", `api<"v2"> is deployed`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.destination, func(t *testing.T) {
+			res, err := tmpl.Render("deploy", tt.destination, data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, res)
+		})
+	}
+
+	_, err := tmpl.Render("unknown", "slack:ops", data)
+	require.EqualError(t, err, `template "unknown" for slack:ops is not found`)
+	_, err = tmpl.Render("deploy", "slack:ops", 1)
+	require.ErrorContains(t, err, `problem rendering template "deploy" for slack:ops`)
+	require.ErrorContains(t, tmpl.AddText("broken", "", "{{.Service"), `problem parsing template "broken" for ""`)
+	require.ErrorContains(t, tmpl.AddHTML("broken", "", "{{.Service"), `problem parsing template "broken" for ""`)
+}
+
+func TestTemplates_SendTemplate(t *testing.T) {
+	rec := &recordingNotifier{}
+	tmpl := NewTemplates()
+	require.NoError(t, tmpl.AddText("greeting", "test", "hello, {{.}}"))
+	require.NoError(t, tmpl.SendTemplate(context.Background(), []Notifier{rec}, "test:dst", "greeting", "world"))
+	assert.Equal(t, []string{"test:dst hello, world"}, rec.get())
+
+	err := tmpl.SendTemplate(context.Background(), []Notifier{rec}, "test:dst", "unknown", nil)
+	require.Error(t, err)
+	assert.True(t, IsPermanent(err))
+	require.ErrorIs(t, tmpl.SendTemplate(context.Background(), []Notifier{rec}, "other:dst", "greeting", nil), ErrUnsupportedSchema)
+
+	rec.err = errors.New("send failed")
+	require.EqualError(t, tmpl.SendTemplate(context.Background(), []Notifier{rec}, "test:dst", "greeting", "world"), "send failed")
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	assert.Equal(t, "hello", truncate(5, "hello"))
+	assert.Equal(t, "hel…", truncate(4, "hello"))
+	assert.Equal(t, "при…", truncate(4, "привет"))
+	assert.Empty(t, truncate(0, "hello"))
+	_, err := jsonValue(func() {})
+	require.ErrorContains(t, err, "problem encoding to json")
+	assert.Equal(t, "a &amp; &lt;b&gt;", slackEscape("a & <b>"))
+}
@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// CorrelationIDHeader is the header Webhook sends the correlation ID of the context with
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// Tracer starts a span for every send made by the built-in notifiers, and by Send, SendMessage, SendAll
+// and Router with other notifiers. Span is started with name "notify.send" and attributes:
+//
+//   - notify.schema: schema of the destination, like "telegram" or "https"
+//   - notify.destination.host: host of the webhook URL or domain of the email address, if any
+//   - notify.correlation_id: correlation ID of the context, if it's set
+//
+// and gets "notify.status" attribute before it's ended: "ok" on success, or ErrorClass of the error.
+// Tracer should be safe for concurrent use.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+}
+
+// Span is a single traced send started by Tracer
+type Span interface {
+	SetAttribute(key, value string)
+	End(err error) // ends the span with the error of the send, nil on success
+}
+
+var tracer atomic.Pointer[Tracer]
+
+// SetTracer sets Tracer for all sends, nil disables tracing
+func SetTracer(t Tracer) {
+	if t == nil {
+		tracer.Store(nil)
+		return
+	}
+	tracer.Store(&t)
+}
+
+// startSpan starts the span of the send with Tracer, if it's set
+func startSpan(ctx context.Context, schema, destination string) (context.Context, Span) {
+	t := tracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	attrs := map[string]string{"notify.schema": schema}
+	if host := destinationHost(destination); host != "" {
+		attrs["notify.destination.host"] = host
+	}
+	if id := CorrelationID(ctx); id != "" {
+		attrs["notify.correlation_id"] = id
+	}
+	return (*t).StartSpan(ctx, "notify.send", attrs)
+}
+
+// endSpan sets status of the send and ends the span, if it was started
+func endSpan(span Span, err error) {
+	if span == nil {
+		return
+	}
+	status := "ok"
+	if err != nil {
+		status = ErrorClass(err)
+	}
+	span.SetAttribute("notify.status", status)
+	span.End(err)
+}
+
+// destinationHost returns host of the destination URL, or domain of the first address for mailto destinations,
+// empty for destinations without them, like telegram or slack
+func destinationHost(destination string) string {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return ""
+	}
+	if u.Host != "" {
+		return u.Hostname()
+	}
+	if u.Scheme != "mailto" {
+		return ""
+	}
+	addr, _, _ := strings.Cut(u.Opaque, ",")
+	_, domain, ok := strings.Cut(addr, "@")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSuffix(domain, ">")
+}
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns context with the correlation ID, which is sent by Webhook in X-Correlation-ID header,
+// added to the spans and logged when the send fails
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns correlation ID of the context, empty if it's not set
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
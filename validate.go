@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Validator is implemented by notifiers which can check the destination without sending anything
+type Validator interface {
+	Validate(destination string) error // returns error if destination is malformed
+}
+
+// OnlineValidator is implemented by notifiers which can check the destination with the service they send to,
+// like whether the chat exists or the recipient is accepted, still without sending anything
+type OnlineValidator interface {
+	ValidateOnline(ctx context.Context, destination string) error // returns error if destination is malformed or unknown
+}
+
+// Validate checks destination without sending anything: that there is a notifier for its scheme,
+// picked the same way Send does, and that the notifier accepts it. Errors of malformed destinations
+// match ErrInvalidDestination.
+func Validate(notifiers []Notifier, destination string) error {
+	n, err := findNotifier(notifiers, destination)
+	if err != nil {
+		return err
+	}
+	if v, ok := unwrapAs[Validator](n); ok {
+		return v.Validate(destination)
+	}
+	return nil
+}
+
+// ValidateOnline checks destination the same way Validate does, and then with the service of the notifier,
+// if the notifier implements OnlineValidator. It makes requests to the service, but doesn't send anything.
+func ValidateOnline(ctx context.Context, notifiers []Notifier, destination string) error {
+	n, err := findNotifier(notifiers, destination)
+	if err != nil {
+		return err
+	}
+	if v, ok := unwrapAs[OnlineValidator](n); ok {
+		return v.ValidateOnline(ctx, destination)
+	}
+	if v, ok := unwrapAs[Validator](n); ok {
+		return v.Validate(destination)
+	}
+	return nil
+}
+
+// Validate checks destination with notifier registered for its scheme
+func (r *Router) Validate(destination string) error {
+	n, err := r.route(destination)
+	if err != nil {
+		return err
+	}
+	return Validate([]Notifier{n}, destination)
+}
+
+// ValidateOnline checks destination with notifier registered for its scheme, and with its service
+func (r *Router) ValidateOnline(ctx context.Context, destination string) error {
+	n, err := r.route(destination)
+	if err != nil {
+		return err
+	}
+	return ValidateOnline(ctx, []Notifier{n}, destination)
+}
+
+// checkQueryParams returns error for the query parameters of URL not in the supported list
+func checkQueryParams(u *url.URL, supported ...string) error {
+	var unknown []string
+	for name := range u.Query() {
+		if !slices.Contains(supported, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return invalidDestination(fmt.Errorf("unknown query parameters %s, supported are %s",
+		strings.Join(unknown, ", "), strings.Join(supported, ", ")))
+}
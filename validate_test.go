@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validatingNotifier is a "test" notifier accepting destinations with "ok" in them
+type validatingNotifier struct {
+	funcNotifier
+	online []string // destinations checked online
+}
+
+func (n *validatingNotifier) Validate(destination string) error {
+	u, err := url.Parse(destination)
+	if err != nil || u.Opaque != "ok" {
+		return invalidDestination(errors.New("destination is not ok"))
+	}
+	return nil
+}
+
+func (n *validatingNotifier) ValidateOnline(_ context.Context, destination string) error {
+	n.online = append(n.online, destination)
+	return n.Validate(destination)
+}
+
+func TestValidate(t *testing.T) {
+	vn := &validatingNotifier{funcNotifier: func(context.Context, string, string) error { return nil }}
+	wrapped := WithRetry(vn, DefaultRetryPolicy())
+
+	require.NoError(t, Validate([]Notifier{wrapped}, "test:ok"))
+	require.ErrorIs(t, Validate([]Notifier{wrapped}, "test:bad"), ErrInvalidDestination, "validator of the wrapped notifier")
+	require.ErrorIs(t, Validate([]Notifier{wrapped}, "other:ok"), ErrUnsupportedSchema)
+	assert.Empty(t, vn.online)
+
+	require.NoError(t, ValidateOnline(context.Background(), []Notifier{wrapped}, "test:ok"))
+	require.ErrorIs(t, ValidateOnline(context.Background(), []Notifier{wrapped}, "test:bad"), ErrInvalidDestination)
+	assert.Equal(t, []string{"test:ok", "test:bad"}, vn.online)
+
+	// notifier without validation accepts any destination of its scheme
+	rec := &recordingNotifier{}
+	require.NoError(t, Validate([]Notifier{rec}, "test:anything"))
+	require.NoError(t, ValidateOnline(context.Background(), []Notifier{rec}, "test:anything"))
+	assert.Empty(t, rec.get())
+}
+
+func TestRouter_Validate(t *testing.T) {
+	vn := &validatingNotifier{funcNotifier: func(context.Context, string, string) error { return nil }}
+	r := NewRouter()
+	require.NoError(t, r.Register(vn))
+
+	require.NoError(t, r.Validate("test:ok"))
+	require.ErrorIs(t, r.Validate("test:bad"), ErrInvalidDestination)
+	require.ErrorIs(t, r.Validate("other:ok"), ErrUnsupportedSchema)
+	require.NoError(t, r.ValidateOnline(context.Background(), "test:ok"))
+	require.ErrorIs(t, r.ValidateOnline(context.Background(), "other:ok"), ErrUnsupportedSchema)
+	require.NoError(t, Validate([]Notifier{r}, "test:ok"), "router is a validator")
+	assert.Equal(t, []string{"test:ok"}, vn.online)
+}
+
+func TestCheckQueryParams(t *testing.T) {
+	u, err := url.Parse("test:dst?a=1&c=2&b=3&d=4")
+	require.NoError(t, err)
+	require.NoError(t, checkQueryParams(u, "a", "b", "c", "d"))
+	err = checkQueryParams(u, "a", "b")
+	require.EqualError(t, err, "unknown query parameters c, d, supported are a, b")
+	require.ErrorIs(t, err, ErrInvalidDestination)
+	assert.True(t, IsPermanent(err))
+}
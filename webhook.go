@@ -3,10 +3,11 @@ package notify
 import (
 	"bytes"
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -51,17 +52,51 @@ func NewWebhook(params WebhookParams) *Webhook {
 }
 
 // Send sends Webhook notification. Destination field is expected to have http:// or https:// schema.
+// Correlation ID of the context is sent in X-Correlation-ID header.
 //
 // Example:
 //
 // - https://example.com/webhook
-func (wh *Webhook) Send(ctx context.Context, destination, text string) error {
-	payload := bytes.NewBufferString(text)
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", destination, payload)
+func (wh *Webhook) Send(ctx context.Context, destination, text string) (err error) {
+	ctx, done := startSend(ctx, sendSchema(wh, destination), destination)
+	defer done(&err)
+	return wh.send(ctx, destination, []byte(text), "")
+}
+
+// SendMessage sends Message encoded to JSON to the webhook, with "Content-Type: application/json" header
+// unless the header is set in WebhookParams. Attachments data is encoded to base64.
+//
+// Example of the payload:
+//
+//	{"title":"Disk is full","body":"Only 1% left","format":"plain","severity":"critical","link":"https://example.org"}
+func (wh *Webhook) SendMessage(ctx context.Context, destination string, msg Message) (err error) {
+	ctx, done := startSend(ctx, sendSchema(wh, destination), destination)
+	defer done(&err)
+	if msg.Format == "" {
+		msg.Format = FormatPlain
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return Permanent(fmt.Errorf("unable to encode webhook message: %w", err))
+	}
+	return wh.send(ctx, destination, payload, "application/json")
+}
+
+// send posts payload to destination, with Content-Type header set to contentType if it's not empty
+// and X-Correlation-ID header set to the correlation ID of the context if it's set, unless they are
+// overridden by the headers from WebhookParams
+func (wh *Webhook) send(ctx context.Context, destination string, payload []byte, contentType string) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", destination, bytes.NewReader(payload))
 	if err != nil {
-		return fmt.Errorf("unable to create webhook request: %w", err)
+		return invalidDestination(fmt.Errorf("unable to create webhook request: %w", err))
 	}
 
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if id := CorrelationID(ctx); id != "" {
+		httpReq.Header.Set(CorrelationIDHeader, id)
+	}
 	for _, h := range wh.Headers {
 		elems := strings.SplitN(h, ":", 2)
 		if len(elems) != 2 {
@@ -81,25 +116,58 @@ func (wh *Webhook) Send(ctx context.Context, destination, text string) error {
 	}()
 
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		errMsg := fmt.Sprintf("webhook request failed with non-OK status code: %d", resp.StatusCode)
-		respBody, e := io.ReadAll(io.LimitReader(resp.Body, webhookErrBodyLimit+1))
-		if e != nil {
-			return errors.New(errMsg)
-		}
-		if len(respBody) > webhookErrBodyLimit {
-			return fmt.Errorf("%s, body: %s... (truncated)", errMsg, respBody[:webhookErrBodyLimit])
-		}
-		return fmt.Errorf("%s, body: %s", errMsg, respBody)
+		return statusError(webhookStatusError(resp))
+	}
+
+	return nil
+}
+
+// webhookStatusError returns error for non-OK response, with the beginning of the response body in it
+func webhookStatusError(resp *http.Response) *HTTPStatusError {
+	res := &HTTPStatusError{StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	res.msg = fmt.Sprintf("webhook request failed with non-OK status code: %d", resp.StatusCode)
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, webhookErrBodyLimit+1))
+	if err != nil {
+		return res
+	}
+	if len(respBody) > webhookErrBodyLimit {
+		res.Body = string(respBody[:webhookErrBodyLimit])
+		res.msg += fmt.Sprintf(", body: %s... (truncated)", res.Body)
+		return res
 	}
+	res.Body = string(respBody)
+	res.msg += ", body: " + res.Body
+	return res
+}
 
+// Validate checks webhook destination is an absolute http or https URL
+func (wh *Webhook) Validate(destination string) error {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return invalidDestination(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return unsupportedScheme(u.Scheme, "http or https")
+	}
+	if u.Host == "" {
+		return invalidDestination(fmt.Errorf("no host in webhook destination %s", redactDestination(destination)))
+	}
 	return nil
 }
 
+// instrumented marks Webhook as reporting its sends to Tracer and Metrics itself
+func (wh *Webhook) instrumented() {}
+
 // Schema returns schema prefix supported by this client
 func (wh *Webhook) Schema() string {
 	return "http"
 }
 
+// Schemes returns all destination schemes supported by this client
+func (wh *Webhook) Schemes() []string {
+	return []string{"http", "https"}
+}
+
 // String describes the webhook instance
 func (wh *Webhook) String() string {
 	str := fmt.Sprintf("webhook notification with timeout %s", wh.Timeout)
@@ -109,3 +177,17 @@ func (wh *Webhook) String() string {
 	}
 	return str
 }
+
+// DefaultRateLimit returns rate limit for webhooks: 10 requests per second to a single host
+func (wh *Webhook) DefaultRateLimit() RateLimit {
+	return RateLimit{
+		PerDestination: Rate{Every: time.Second / 10, Burst: 10},
+		Key: func(destination string) string {
+			u, err := url.Parse(destination)
+			if err != nil {
+				return destination
+			}
+			return u.Host
+		},
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -190,3 +191,91 @@ func TestWebhook_SendReusesConnection(t *testing.T) {
 	}
 	assert.Equal(t, int32(1), atomic.LoadInt32(&newConns), "response body is drained, so the connection is reused")
 }
+
+func TestWebhook_SendMessage(t *testing.T) {
+	var body []byte
+	var contentType string
+	ts := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	wh := NewWebhook(WebhookParams{})
+	msg := Message{Title: "title", Body: "body", Severity: SeverityCritical, Link: "https://example.org",
+		Tags: []string{"a", "b"}, Attachments: []Attachment{{Name: "file.txt", Data: []byte("data")}}}
+	require.NoError(t, wh.SendMessage(context.Background(), ts.URL, msg))
+	assert.Equal(t, "application/json", contentType)
+	assert.JSONEq(t, `{"title":"title","body":"body","format":"plain","severity":"critical","link":"https://example.org",
+		"tags":["a","b"],"attachments":[{"name":"file.txt","data":"ZGF0YQ=="}]}`, string(body))
+
+	// content type set in params takes precedence
+	wh = NewWebhook(WebhookParams{Headers: []string{"Content-Type: application/vnd.custom+json"}})
+	require.NoError(t, wh.SendMessage(context.Background(), ts.URL, Message{Body: "body", Format: FormatHTML}))
+	assert.Equal(t, "application/vnd.custom+json", contentType)
+	assert.JSONEq(t, `{"body":"body","format":"html","severity":"info"}`, string(body))
+
+	err := wh.SendMessage(context.Background(), ts.URL, Message{Severity: Severity(42)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to encode webhook message")
+}
+
+func TestWebhook_SendPermanentErrors(t *testing.T) {
+	wh := NewWebhook(WebhookParams{})
+	for status, permanent := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusNotFound:            true,
+		http.StatusTooManyRequests:     false,
+		http.StatusInternalServerError: false,
+	} {
+		wh.webhookClient = funcWebhookClient(func(*http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("error"))}, nil
+		})
+		err := wh.Send(context.Background(), "http://example.org/url", "")
+		require.Error(t, err)
+		assert.Equal(t, permanent, IsPermanent(err), "status %d", status)
+	}
+
+	wh.webhookClient = funcWebhookClient(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	assert.False(t, IsPermanent(wh.Send(context.Background(), "http://example.org/url", "")), "network error is temporary")
+	assert.True(t, IsPermanent(wh.Send(context.Background(), "%", "")), "bad destination is permanent")
+}
+
+func TestWebhook_SendStatusError(t *testing.T) {
+	wh := NewWebhook(WebhookParams{})
+	wh.webhookClient = funcWebhookClient(func(*http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After": []string{"30"}},
+			Body:       io.NopCloser(strings.NewReader("slow down")),
+		}, nil
+	})
+	err := wh.Send(context.Background(), "http://example.org/url", "")
+	require.EqualError(t, err, "webhook request failed with non-OK status code: 429, body: slow down")
+	require.ErrorIs(t, err, ErrRateLimited)
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+	assert.Equal(t, "slow down", statusErr.Body)
+	assert.Equal(t, 30*time.Second, statusErr.RetryAfter)
+
+	require.ErrorIs(t, wh.Send(context.Background(), "%", ""), ErrInvalidDestination)
+}
+
+func TestWebhook_Validate(t *testing.T) {
+	wh := NewWebhook(WebhookParams{})
+	require.NoError(t, wh.Validate("https://example.org/hook?token=any"))
+	require.NoError(t, wh.Validate("http://localhost:8080"))
+	for destination, errText := range map[string]string{
+		"https:///hook":             "no host in webhook destination https:///hook",
+		"ftp://example.org":         "unsupported scheme ftp, should be http or https",
+		"https://user:secret@/path": "no host in webhook destination https://user:xxxxx@/path",
+		"https://example.org/%zz":   `parse "https://example.org/%zz": invalid URL escape "%zz"`,
+	} {
+		err := wh.Validate(destination)
+		require.EqualError(t, err, errText, destination)
+		require.ErrorIs(t, err, ErrInvalidDestination, destination)
+	}
+}